@@ -7,10 +7,13 @@ import (
 
 	"github.com/cachatto/master-slave-server/internal/config"
 	"github.com/cachatto/master-slave-server/internal/handler"
+	"github.com/cachatto/master-slave-server/internal/limiter"
+	"github.com/cachatto/master-slave-server/internal/mail"
 	"github.com/cachatto/master-slave-server/internal/middleware"
-	"github.com/cachatto/master-slave-server/internal/models"
+	"github.com/cachatto/master-slave-server/internal/pwhash"
 	"github.com/cachatto/master-slave-server/internal/repository"
 	"github.com/cachatto/master-slave-server/internal/service"
+	"github.com/cachatto/master-slave-server/migrations"
 	"github.com/gin-gonic/gin"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
@@ -39,32 +42,162 @@ func main() {
 	sqlDB.SetMaxOpenConns(100)
 	sqlDB.SetConnMaxLifetime(time.Hour)
 
-	// ─── Auto-Migrate Models ─────────────────────────────────────────
-	// Only auto-migrate if tables don't exist yet (avoids conflict with SQL migration)
-	if !db.Migrator().HasTable(&models.User{}) {
-		if err := db.AutoMigrate(
-			&models.User{},
-			&models.App{},
-			&models.UserAppPermission{},
-			&models.OneTimeCode{},
-		); err != nil {
-			log.Fatalf("❌ Failed to auto-migrate: %v", err)
-		}
-		log.Println("✅ Database migration complete (auto-migrate)")
-	} else {
-		log.Println("✅ Database tables already exist (SQL migration)")
+	// ─── Run Migrations ──────────────────────────────────────────────
+	// Every SQL file in migrations/ the database has not run yet is applied
+	// in order; schema_migrations records the ones that ran
+	applied, err := migrations.Apply(db)
+	if err != nil {
+		log.Fatalf("❌ Failed to migrate database: %v", err)
 	}
+	for _, version := range applied {
+		log.Printf("✅ Applied migration %s", version)
+	}
+	log.Println("✅ Database schema is up to date")
 
 	// ─── Initialize Repositories ─────────────────────────────────────
+	tenantRepo := repository.NewTenantRepository(db)
 	userRepo := repository.NewUserRepository(db)
 	appRepo := repository.NewAppRepository(db)
+	permRepo := repository.NewPermissionRepository(db)
+	groupRepo := repository.NewGroupRepository(db)
+	accessRequestRepo := repository.NewAccessRequestRepository(db)
 	otcRepo := repository.NewOTCRepository(db)
+	refreshRepo := repository.NewRefreshTokenRepository(db)
+	authCodeRepo := repository.NewAuthorizationCodeRepository(db)
+	attemptRepo := repository.NewAttemptRepository(db)
+	recoveryRepo := repository.NewRecoveryCodeRepository(db)
+	resetRepo := repository.NewPasswordResetRepository(db)
+	webauthnCredRepo := repository.NewWebAuthnCredentialRepository(db)
+	webauthnSessionRepo := repository.NewWebAuthnSessionRepository(db)
+
+	// ─── Load Signing Keys ───────────────────────────────────────────
+	keys, err := service.NewKeySet(cfg)
+	if err != nil {
+		log.Fatalf("❌ Failed to load JWT signing keys: %v", err)
+	}
+	if len(cfg.JWTSigningKeys) == 0 {
+		log.Println("⚠️  WARNING: No JWT_SIGNING_KEYS configured, signing with HS256 and JWT_SECRET")
+	}
+
+	// ─── Initialize Password Hasher ──────────────────────────────────
+	// New hashes use the configured algorithm; hashes of the other one still
+	// verify and are upgraded on the next successful login.
+	bcryptHasher := &pwhash.Bcrypt{Cost: cfg.BcryptCost}
+	argon2Hasher := &pwhash.Argon2id{
+		Memory:      uint32(cfg.Argon2Memory),
+		Iterations:  uint32(cfg.Argon2Iterations),
+		Parallelism: uint8(cfg.Argon2Parallelism),
+	}
+	hasher := pwhash.NewHasher(argon2Hasher, bcryptHasher)
+	if cfg.PasswordHashAlgorithm == "bcrypt" {
+		hasher = pwhash.NewHasher(bcryptHasher, argon2Hasher)
+	}
+	log.Printf("✅ Hashing new passwords with %s", cfg.PasswordHashAlgorithm)
+
+	// ─── Initialize Brute-Force Limiters ─────────────────────────────
+	newLimiter := func(scope string, policy limiter.Policy) limiter.Limiter {
+		if cfg.LimiterBackend == "postgres" {
+			return limiter.NewPostgresLimiter(attemptRepo, scope, policy)
+		}
+		return limiter.NewMemoryLimiter(policy)
+	}
+	claimIPLimiter := newLimiter("claim-ip", limiter.Policy{
+		MaxFailures: cfg.ClaimMaxFailuresPerIP,
+		BaseLockout: cfg.ClaimLockoutBase,
+		MaxLockout:  cfg.ClaimLockoutMax,
+		Window:      cfg.ClaimFailureWindow,
+	})
+	claimAppLimiter := newLimiter("claim-app", limiter.Policy{
+		MaxFailures: cfg.ClaimMaxFailuresPerApp,
+		BaseLockout: cfg.ClaimLockoutBase,
+		MaxLockout:  cfg.ClaimLockoutMax,
+		Window:      cfg.ClaimFailureWindow,
+	})
+	claimPackageLimiter := newLimiter("claim-package", limiter.Policy{
+		MaxFailures: cfg.ClaimMaxFailuresPerPackage,
+		BaseLockout: min(cfg.ClaimLockoutBase, cfg.ClaimPackageLockoutMax),
+		MaxLockout:  cfg.ClaimPackageLockoutMax,
+		Window:      cfg.ClaimFailureWindow,
+	})
+	loginIPLimiter := newLimiter("login-ip", limiter.Policy{
+		MaxFailures: cfg.LoginMaxFailuresPerIP,
+		BaseLockout: cfg.LoginLockoutBase,
+		MaxLockout:  cfg.LoginLockoutMax,
+		Window:      cfg.LoginFailureWindow,
+	})
+	loginUnknownLimiter := newLimiter("login-unknown", limiter.Policy{
+		MaxFailures: cfg.LoginMaxFailuresPerAccount,
+		BaseLockout: cfg.LoginLockoutBase,
+		MaxLockout:  cfg.LoginLockoutMax,
+		Window:      cfg.LoginFailureWindow,
+	})
+	forgotIPLimiter := newLimiter("forgot-ip", limiter.Policy{
+		MaxFailures: cfg.ForgotPasswordMaxPerIP,
+		BaseLockout: cfg.ForgotPasswordWindow,
+		MaxLockout:  cfg.ForgotPasswordWindow,
+		Window:      cfg.ForgotPasswordWindow,
+	})
+	forgotEmailLimiter := newLimiter("forgot-email", limiter.Policy{
+		MaxFailures: cfg.ForgotPasswordMaxPerEmail,
+		BaseLockout: cfg.ForgotPasswordWindow,
+		MaxLockout:  cfg.ForgotPasswordWindow,
+		Window:      cfg.ForgotPasswordWindow,
+	})
+	signupIPLimiter := newLimiter("signup-ip", limiter.Policy{
+		MaxFailures: cfg.SignupMaxPerIP,
+		BaseLockout: cfg.SignupWindow,
+		MaxLockout:  cfg.SignupWindow,
+		Window:      cfg.SignupWindow,
+	})
+	signupEmailLimiter := newLimiter("signup-email", limiter.Policy{
+		MaxFailures: cfg.SignupMaxPerEmail,
+		BaseLockout: cfg.SignupWindow,
+		MaxLockout:  cfg.SignupWindow,
+		Window:      cfg.SignupWindow,
+	})
+	log.Printf("✅ Using %s brute-force limiter", cfg.LimiterBackend)
+
+	// ─── Initialize Mail Sender ──────────────────────────────────────
+	var mailer mail.Sender
+	switch cfg.MailBackend {
+	case "smtp":
+		mailer = mail.NewSMTPSender(cfg.MailFrom, cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword)
+	case "file":
+		mailer, err = mail.NewFileSender(cfg.MailFrom, cfg.MailFileDir)
+		if err != nil {
+			log.Fatalf("❌ Failed to create mail directory: %v", err)
+		}
+	default:
+		mailer = mail.NewLogSender()
+	}
+	log.Printf("✅ Using %s mail sender", cfg.MailBackend)
 
 	// ─── Initialize Services ─────────────────────────────────────────
-	authService := service.NewAuthService(userRepo, appRepo, cfg)
-	otcService := service.NewOTCService(otcRepo, appRepo, authService, cfg)
+	tenantService := service.NewTenantService(tenantRepo, cfg)
+	mfaService := service.NewMFAService(userRepo, recoveryRepo, cfg)
+	authService := service.NewAuthService(userRepo, appRepo, refreshRepo, tenantService, keys, hasher, mfaService, loginIPLimiter, loginUnknownLimiter, cfg)
+	otcService := service.NewOTCService(otcRepo, appRepo, authService, claimIPLimiter, claimAppLimiter, claimPackageLimiter, cfg)
+	oidcService := service.NewOIDCService(authCodeRepo, appRepo, userRepo, authService, keys, cfg)
+	registrationService := service.NewRegistrationService(userRepo, tenantService, authService, keys, hasher, mailer, signupIPLimiter, signupEmailLimiter, cfg)
+	appService := service.NewAppService(appRepo, userRepo, tenantService)
+	passwordService := service.NewPasswordService(userRepo, resetRepo, tenantService, hasher, authService, mailer, forgotIPLimiter, forgotEmailLimiter, cfg)
+	userService := service.NewUserService(userRepo, hasher, authService, passwordService, tenantService, cfg)
+	permissionService := service.NewPermissionService(permRepo, appRepo, userRepo, groupRepo)
+	groupService := service.NewGroupService(groupRepo, userRepo, tenantService)
+	accessRequestService := service.NewAccessRequestService(accessRequestRepo, appRepo, userRepo, permRepo)
+	defaultTenant, err := tenantService.EnsureDefaultTenant()
+	if err != nil {
+		log.Fatalf("❌ Failed to set up the default tenant: %v", err)
+	}
+	if err := userService.PromoteSuperadmins(defaultTenant.ID, cfg.AdminEmails); err != nil {
+		log.Fatalf("❌ Failed to promote ADMIN_EMAILS to superadmin: %v", err)
+	}
+	webauthnService, err := service.NewWebAuthnService(webauthnCredRepo, webauthnSessionRepo, userRepo, authService, cfg)
+	if err != nil {
+		log.Fatalf("❌ Invalid WebAuthn configuration: %v", err)
+	}
 
-	// ─── Start OTC Cleanup Ticker ────────────────────────────────────
+	// ─── Start Cleanup Ticker ────────────────────────────────────────
 	go func() {
 		ticker := time.NewTicker(5 * time.Minute)
 		defer ticker.Stop()
@@ -72,15 +205,75 @@ func main() {
 			if err := otcService.CleanExpiredCodes(); err != nil {
 				log.Printf("⚠️  OTC cleanup error: %v", err)
 			}
+			if err := authService.CleanExpiredRefreshTokens(); err != nil {
+				log.Printf("⚠️  Refresh token cleanup error: %v", err)
+			}
+			if err := oidcService.CleanExpiredCodes(); err != nil {
+				log.Printf("⚠️  Authorization code cleanup error: %v", err)
+			}
+			if err := passwordService.CleanExpiredResetTokens(); err != nil {
+				log.Printf("⚠️  Password reset token cleanup error: %v", err)
+			}
+			if err := webauthnService.CleanExpiredSessions(); err != nil {
+				log.Printf("⚠️  WebAuthn session cleanup error: %v", err)
+			}
+			if err := otcService.CleanLimiters(); err != nil {
+				log.Printf("⚠️  Limiter cleanup error: %v", err)
+			}
+			if err := authService.CleanLimiters(); err != nil {
+				log.Printf("⚠️  Limiter cleanup error: %v", err)
+			}
+			if err := passwordService.CleanLimiters(); err != nil {
+				log.Printf("⚠️  Limiter cleanup error: %v", err)
+			}
+			if err := registrationService.CleanLimiters(); err != nil {
+				log.Printf("⚠️  Limiter cleanup error: %v", err)
+			}
+		}
+	}()
+
+	// ─── Start Grant Expiry Ticker ───────────────────────────────────
+	// Each expiry is recorded in grant_events by ExpireGrants.
+	if cfg.GrantExpiryInterval <= 0 {
+		log.Fatalf("❌ GRANT_EXPIRY_INTERVAL must be positive, got %s", cfg.GrantExpiryInterval)
+	}
+	go func() {
+		ticker := time.NewTicker(cfg.GrantExpiryInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			expired, err := permissionService.ExpireGrants()
+			if err != nil {
+				log.Printf("⚠️  Grant expiry error: %v", err)
+			}
+			for _, perm := range expired {
+				log.Printf("⌛ Grant expired: user %s, app %s (valid until %s)",
+					perm.UserID, perm.AppID, perm.ValidUntil.Format(time.RFC3339))
+			}
 		}
 	}()
 
 	// ─── Initialize Handlers ─────────────────────────────────────────
 	authHandler := handler.NewAuthHandler(authService)
 	otcHandler := handler.NewOTCHandler(otcService)
+	oidcHandler := handler.NewOIDCHandler(oidcService, authService)
+	mfaHandler := handler.NewMFAHandler(mfaService, authService)
+	webauthnHandler := handler.NewWebAuthnHandler(webauthnService)
+	registrationHandler := handler.NewRegistrationHandler(registrationService)
+	passwordHandler := handler.NewPasswordHandler(passwordService)
+	adminUserHandler := handler.NewAdminUserHandler(userService)
+	adminAppHandler := handler.NewAdminAppHandler(appService)
+	adminPermissionHandler := handler.NewAdminPermissionHandler(permissionService)
+	adminGroupHandler := handler.NewAdminGroupHandler(groupService)
+	adminTenantHandler := handler.NewAdminTenantHandler(tenantService)
+	accessRequestHandler := handler.NewAccessRequestHandler(accessRequestService)
+	adminAccessRequestHandler := handler.NewAdminAccessRequestHandler(accessRequestService)
+	wellKnownHandler := handler.NewWellKnownHandler(keys, oidcService)
 
 	// ─── Setup Gin Router ────────────────────────────────────────────
 	router := gin.Default()
+	if err := router.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		log.Fatalf("❌ Invalid TRUSTED_PROXIES: %v", err)
+	}
 
 	// Health check
 	router.GET("/health", func(c *gin.Context) {
@@ -91,23 +284,119 @@ func main() {
 		})
 	})
 
+	// Discovery documents for slave backends and OIDC clients
+	router.GET("/.well-known/jwks.json", wellKnownHandler.JWKS)
+	router.GET("/.well-known/openid-configuration", wellKnownHandler.OpenIDConfiguration)
+
+	// OpenID Connect provider routes
+	oauth2 := router.Group("/oauth2")
+	{
+		oauth2.GET("/authorize", oidcHandler.Authorize)
+		oauth2.POST("/authorize", oidcHandler.AuthorizeLogin)
+		oauth2.POST("/token", oidcHandler.Token)
+		oauth2.GET("/userinfo", oidcHandler.UserInfo)
+		oauth2.POST("/userinfo", oidcHandler.UserInfo)
+	}
+
 	// Auth routes
 	auth := router.Group("/auth")
 	{
 		// Public endpoints (no auth required)
+		auth.POST("/register", registrationHandler.Register)
+		auth.GET("/verify-email", registrationHandler.VerifyEmail)
+		auth.POST("/verify-email/resend", registrationHandler.ResendVerification)
 		auth.POST("/login", authHandler.Login)
+		auth.POST("/login/mfa", authHandler.LoginMFA)
 		auth.POST("/refresh", authHandler.Refresh)
+		auth.POST("/password/forgot", passwordHandler.ForgotPassword)
+		auth.POST("/password/reset", passwordHandler.ResetPassword)
 		auth.POST("/claim-token", otcHandler.ClaimToken)
+		auth.POST("/webauthn/login/begin", webauthnHandler.BeginLogin)
+		auth.POST("/webauthn/login/finish", webauthnHandler.FinishLogin)
 
 		// Protected endpoints (JWT required)
 		protected := auth.Group("")
-		protected.Use(middleware.JWTAuth(authService))
+		protected.Use(middleware.JWTAuth(authService, service.MasterAudience))
 		{
 			protected.GET("/verify", authHandler.Verify)
 			protected.POST("/exchange-code", otcHandler.ExchangeCode)
+			protected.POST("/logout", authHandler.Logout)
+			protected.POST("/logout-all", authHandler.LogoutAll)
+			protected.POST("/password/change", passwordHandler.ChangePassword)
+			protected.GET("/mfa", mfaHandler.Status)
+			protected.POST("/mfa/totp/enroll", mfaHandler.EnrollTOTP)
+			protected.POST("/mfa/totp/confirm", mfaHandler.ConfirmTOTP)
+			protected.POST("/mfa/totp/disable", mfaHandler.DisableTOTP)
+			protected.POST("/mfa/recovery-codes", mfaHandler.RegenerateRecoveryCodes)
+			protected.POST("/webauthn/register/begin", webauthnHandler.BeginRegistration)
+			protected.POST("/webauthn/register/finish", webauthnHandler.FinishRegistration)
+			protected.GET("/webauthn/credentials", webauthnHandler.ListCredentials)
+			protected.DELETE("/webauthn/credentials/:id", webauthnHandler.DeleteCredential)
 		}
 	}
 
+	// App routes for signed-in users (JWT required)
+	apps := router.Group("/apps")
+	apps.Use(middleware.JWTAuth(authService, service.MasterAudience))
+	{
+		apps.POST("/:id/access-requests", accessRequestHandler.CreateAccessRequest)
+	}
+
+	// Admin routes (JWT + admin role required; each route checks a permission)
+	manageUsers := middleware.RequirePermission(service.PermManageUsers)
+	readUsers := middleware.RequirePermission(service.PermReadUsers)
+	createApps := middleware.RequirePermission(service.PermCreateApps)
+	manageApps := middleware.RequirePermission(service.PermManageApps)
+	manageGroups := middleware.RequirePermission(service.PermManageGroups)
+	manageTenants := middleware.RequirePermission(service.PermManageTenants)
+
+	admin := router.Group("/admin")
+	admin.Use(middleware.JWTAuth(authService, service.MasterAudience), middleware.RequireRole(service.RoleSuperadmin, service.RoleTenantAdmin, service.RoleAppAdmin))
+	{
+		admin.POST("/users", manageUsers, adminUserHandler.CreateUser)
+		admin.GET("/users", readUsers, adminUserHandler.ListUsers)
+		admin.GET("/users/:id", readUsers, adminUserHandler.GetUser)
+		admin.DELETE("/users/:id", manageUsers, adminUserHandler.DeleteUser)
+		admin.PUT("/users/:id/role", manageUsers, adminUserHandler.SetRole)
+		admin.POST("/users/:id/disable", manageUsers, adminUserHandler.DisableUser)
+		admin.POST("/users/:id/enable", manageUsers, adminUserHandler.EnableUser)
+		admin.POST("/users/:id/restore", manageUsers, adminUserHandler.RestoreUser)
+		admin.POST("/users/:id/force-password-reset", manageUsers, adminUserHandler.ForcePasswordReset)
+		admin.POST("/users/:id/unlock", manageUsers, adminUserHandler.UnlockUser)
+		admin.GET("/users/:id/apps", manageApps, adminPermissionHandler.ListUserApps)
+		admin.POST("/users/:id/apps", manageApps, adminPermissionHandler.GrantUserApps)
+		admin.DELETE("/users/:id/apps", manageApps, adminPermissionHandler.RevokeUserApps)
+
+		admin.POST("/apps", createApps, adminAppHandler.CreateApp)
+		admin.GET("/apps", manageApps, adminAppHandler.ListApps)
+		admin.GET("/apps/:id", manageApps, adminAppHandler.GetApp)
+		admin.PATCH("/apps/:id", manageApps, adminAppHandler.UpdateApp)
+		admin.DELETE("/apps/:id", createApps, adminAppHandler.DeleteApp)
+		admin.GET("/apps/:id/users", manageApps, adminPermissionHandler.ListAppUsers)
+		admin.POST("/apps/:id/users", manageApps, adminPermissionHandler.GrantAppUsers)
+		admin.DELETE("/apps/:id/users", manageApps, adminPermissionHandler.RevokeAppUsers)
+		admin.GET("/apps/:id/access-requests", manageApps, adminAccessRequestHandler.ListAppRequests)
+		admin.POST("/access-requests/:id/approve", manageApps, adminAccessRequestHandler.ApproveRequest)
+		admin.POST("/access-requests/:id/deny", manageApps, adminAccessRequestHandler.DenyRequest)
+
+		admin.POST("/groups", manageGroups, adminGroupHandler.CreateGroup)
+		admin.GET("/groups", readUsers, adminGroupHandler.ListGroups)
+		admin.GET("/groups/:id", readUsers, adminGroupHandler.GetGroup)
+		admin.PATCH("/groups/:id", manageGroups, adminGroupHandler.UpdateGroup)
+		admin.DELETE("/groups/:id", manageGroups, adminGroupHandler.DeleteGroup)
+		admin.GET("/groups/:id/members", readUsers, adminGroupHandler.ListMembers)
+		admin.POST("/groups/:id/members", manageGroups, adminGroupHandler.AddMembers)
+		admin.DELETE("/groups/:id/members", manageGroups, adminGroupHandler.RemoveMembers)
+		admin.GET("/groups/:id/apps", manageApps, adminPermissionHandler.ListGroupApps)
+		admin.POST("/groups/:id/apps", manageApps, adminPermissionHandler.GrantGroupApps)
+		admin.DELETE("/groups/:id/apps", manageApps, adminPermissionHandler.RevokeGroupApps)
+
+		admin.POST("/tenants", manageTenants, adminTenantHandler.CreateTenant)
+		admin.GET("/tenants", manageTenants, adminTenantHandler.ListTenants)
+		admin.GET("/tenants/:id", manageTenants, adminTenantHandler.GetTenant)
+		admin.PATCH("/tenants/:id", manageTenants, adminTenantHandler.UpdateTenant)
+	}
+
 	// ─── Start Server ────────────────────────────────────────────────
 	addr := fmt.Sprintf(":%s", cfg.ServerPort)
 	log.Printf("🚀 Server starting on %s", addr)
@@ -43,11 +43,15 @@ echo "✅ Deployment complete!"
 echo ""
 echo "📡 Endpoints available at:"
 echo "   Health:         http://${DOMAIN}:8080/health"
+echo "   Register:       POST http://${DOMAIN}:8080/auth/register"
 echo "   Login:          POST http://${DOMAIN}:8080/auth/login"
 echo "   Verify:         GET  http://${DOMAIN}:8080/auth/verify"
 echo "   Refresh:        POST http://${DOMAIN}:8080/auth/refresh"
 echo "   Exchange Code:  POST http://${DOMAIN}:8080/auth/exchange-code"
 echo "   Claim Token:    POST http://${DOMAIN}:8080/auth/claim-token"
+echo "   Logout:         POST http://${DOMAIN}:8080/auth/logout"
+echo "   Logout All:     POST http://${DOMAIN}:8080/auth/logout-all"
+echo "   Passkey Login:  POST http://${DOMAIN}:8080/auth/webauthn/login/{begin,finish}"
 echo ""
 echo "🧪 Test with:"
 echo "   curl -X POST http://${DOMAIN}:8080/auth/login \\"
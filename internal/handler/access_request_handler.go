@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/cachatto/master-slave-server/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+// AccessRequestHandler handles the endpoint users ask for app access with.
+type AccessRequestHandler struct {
+	accessRequestService *service.AccessRequestService
+}
+
+// NewAccessRequestHandler creates a new AccessRequestHandler.
+func NewAccessRequestHandler(accessRequestService *service.AccessRequestService) *AccessRequestHandler {
+	return &AccessRequestHandler{accessRequestService: accessRequestService}
+}
+
+// CreateAccessRequestRequest is the expected JSON body for
+// POST /apps/:id/access-requests. Scopes lists the app scopes the user asks
+// for; Reason is shown to the admins deciding the request.
+type CreateAccessRequestRequest struct {
+	Scopes []string `json:"scopes"`
+	Reason string   `json:"reason" binding:"max=1000"`
+}
+
+// CreateAccessRequest handles POST /apps/:id/access-requests
+// Requires a valid access token (via JWT middleware). Files a request to use
+// the app, for the app's admins to approve or deny. Responds 409 if a
+// request is already pending or the user already has the requested access.
+func (h *AccessRequestHandler) CreateAccessRequest(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	appID, ok := appIDParam(c)
+	if !ok {
+		return
+	}
+
+	var req CreateAccessRequestRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid request: reason must be at most 1000 characters",
+		})
+		return
+	}
+
+	request, err := h.accessRequestService.RequestAccess(userID, appID, req.Scopes, req.Reason)
+	if err != nil {
+		respondAccessRequestError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, request)
+}
+
+// respondAccessRequestError maps AccessRequestService errors to HTTP
+// responses.
+func respondAccessRequestError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch err {
+	case service.ErrUnknownScope, service.ErrInvalidRequestStatus, service.ErrInvalidWindow:
+		status = http.StatusBadRequest
+	case service.ErrUserNotFound, service.ErrAppNotFound, service.ErrAccessRequestNotFound:
+		status = http.StatusNotFound
+	case service.ErrAccessRequestPending, service.ErrAccessRequestDecided, service.ErrAlreadyPermitted:
+		status = http.StatusConflict
+	}
+	c.JSON(status, gin.H{
+		"error": err.Error(),
+	})
+}
@@ -0,0 +1,151 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/cachatto/master-slave-server/internal/service"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// AdminAccessRequestHandler handles the admin-only endpoints that list and
+// decide access requests.
+type AdminAccessRequestHandler struct {
+	accessRequestService *service.AccessRequestService
+}
+
+// NewAdminAccessRequestHandler creates a new AdminAccessRequestHandler.
+func NewAdminAccessRequestHandler(accessRequestService *service.AccessRequestService) *AdminAccessRequestHandler {
+	return &AdminAccessRequestHandler{accessRequestService: accessRequestService}
+}
+
+// ApproveAccessRequestRequest is the optional JSON body for
+// POST /admin/access-requests/:id/approve. Without scopes the requested
+// scopes are granted; the RFC 3339 validity window is optional. Without a
+// window an existing grant keeps its window, and a new grant is permanent.
+type ApproveAccessRequestRequest struct {
+	Scopes     []string   `json:"scopes"`
+	ValidFrom  *time.Time `json:"valid_from"`
+	ValidUntil *time.Time `json:"valid_until"`
+	Note       string     `json:"note" binding:"max=1000"`
+}
+
+// DenyAccessRequestRequest is the optional JSON body for
+// POST /admin/access-requests/:id/deny.
+type DenyAccessRequestRequest struct {
+	Note string `json:"note" binding:"max=1000"`
+}
+
+// ListAppRequests handles GET /admin/apps/:id/access-requests?status=&page=1&page_size=20
+// Returns one page of the access requests for the app, newest first, with
+// the total number of matches. status filters by pending, approved or
+// denied.
+func (h *AdminAccessRequestHandler) ListAppRequests(c *gin.Context) {
+	actor, ok := currentActor(c)
+	if !ok {
+		return
+	}
+	appID, ok := appIDParam(c)
+	if !ok {
+		return
+	}
+	page, pageSize, ok := pagination(c)
+	if !ok {
+		return
+	}
+
+	result, err := h.accessRequestService.ListAppRequests(actor, appID, c.Query("status"), page, pageSize)
+	if err != nil {
+		respondAccessRequestError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// ApproveRequest handles POST /admin/access-requests/:id/approve
+// Grants the app to the user who asked for it, adding the scopes to the
+// user's existing grant. Responds 409 if the request has already been
+// decided.
+func (h *AdminAccessRequestHandler) ApproveRequest(c *gin.Context) {
+	actor, ok := currentActor(c)
+	if !ok {
+		return
+	}
+	requestID, ok := accessRequestIDParam(c)
+	if !ok {
+		return
+	}
+
+	var req ApproveAccessRequestRequest
+	if !bindOptionalJSON(c, &req) {
+		return
+	}
+
+	var window *service.GrantWindow
+	if req.ValidFrom != nil || req.ValidUntil != nil {
+		window = &service.GrantWindow{ValidFrom: req.ValidFrom, ValidUntil: req.ValidUntil}
+	}
+
+	request, err := h.accessRequestService.ApproveRequest(actor, requestID, req.Scopes, window, req.Note)
+	if err != nil {
+		respondAccessRequestError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, request)
+}
+
+// DenyRequest handles POST /admin/access-requests/:id/deny
+// Responds 409 if the request has already been decided.
+func (h *AdminAccessRequestHandler) DenyRequest(c *gin.Context) {
+	actor, ok := currentActor(c)
+	if !ok {
+		return
+	}
+	requestID, ok := accessRequestIDParam(c)
+	if !ok {
+		return
+	}
+
+	var req DenyAccessRequestRequest
+	if !bindOptionalJSON(c, &req) {
+		return
+	}
+
+	request, err := h.accessRequestService.DenyRequest(actor, requestID, req.Note)
+	if err != nil {
+		respondAccessRequestError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, request)
+}
+
+// bindOptionalJSON binds the JSON body into req, leaving req zero if the
+// body is empty, and writes a 400 and returns false if it is invalid.
+func bindOptionalJSON(c *gin.Context, req interface{}) bool {
+	if err := c.ShouldBindJSON(req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid request body",
+		})
+		return false
+	}
+	return true
+}
+
+// accessRequestIDParam parses the :id path parameter, writing a 400 and
+// returning false if it is not a UUID.
+func accessRequestIDParam(c *gin.Context) (uuid.UUID, bool) {
+	requestID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid access request id format",
+		})
+		return uuid.Nil, false
+	}
+	return requestID, true
+}
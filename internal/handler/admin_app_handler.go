@@ -0,0 +1,215 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/cachatto/master-slave-server/internal/service"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// AdminAppHandler handles the admin-only slave app registry endpoints.
+type AdminAppHandler struct {
+	appService *service.AppService
+}
+
+// NewAdminAppHandler creates a new AdminAppHandler.
+func NewAdminAppHandler(appService *service.AppService) *AdminAppHandler {
+	return &AdminAppHandler{appService: appService}
+}
+
+// CreateAppRequest is the expected JSON body for POST /admin/apps.
+// Without a tenant_id the app is created in the admin's own tenant; only
+// superadmins may name another tenant.
+type CreateAppRequest struct {
+	TenantID       *uuid.UUID `json:"tenant_id"`
+	AppName        string     `json:"app_name" binding:"required"`
+	PackageID      string     `json:"package_id" binding:"required"`
+	DeepLinkScheme string     `json:"deep_link_scheme" binding:"required"`
+	RedirectURIs   []string   `json:"redirect_uris"`
+	RequirePKCE    bool       `json:"require_pkce"`
+	OwnerID        *uuid.UUID `json:"owner_id"` // app-admin who will manage the app
+	Scopes         []string   `json:"scopes"`   // scopes that can be granted to users, e.g. ["read", "write"]
+}
+
+// UpdateAppRequest is the expected JSON body for PATCH /admin/apps/:id.
+// Omitted fields are left unchanged. Only superadmins may set owner_id; the
+// nil UUID removes the owner.
+type UpdateAppRequest struct {
+	AppName        *string    `json:"app_name"`
+	PackageID      *string    `json:"package_id"`
+	DeepLinkScheme *string    `json:"deep_link_scheme"`
+	RedirectURIs   []string   `json:"redirect_uris"`
+	RequirePKCE    *bool      `json:"require_pkce"`
+	OwnerID        *uuid.UUID `json:"owner_id"`
+	Scopes         []string   `json:"scopes"`
+}
+
+// CreateApp handles POST /admin/apps
+// Registers a new slave app. Responds 409 if the package ID is taken in any
+// tenant.
+func (h *AdminAppHandler) CreateApp(c *gin.Context) {
+	actor, ok := currentActor(c)
+	if !ok {
+		return
+	}
+
+	var req CreateAppRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid request: app_name, package_id and deep_link_scheme are required",
+		})
+		return
+	}
+
+	app, err := h.appService.CreateApp(actor, &service.AppInput{
+		TenantID:       req.TenantID,
+		AppName:        &req.AppName,
+		PackageID:      &req.PackageID,
+		DeepLinkScheme: &req.DeepLinkScheme,
+		RedirectURIs:   req.RedirectURIs,
+		RequirePKCE:    &req.RequirePKCE,
+		OwnerID:        req.OwnerID,
+		Scopes:         req.Scopes,
+	})
+	if err != nil {
+		respondAppError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, app)
+}
+
+// ListApps handles GET /admin/apps?page=1&page_size=20
+// Returns one page of the registry with the total number of apps.
+// App-admins only see the apps they own.
+func (h *AdminAppHandler) ListApps(c *gin.Context) {
+	actor, ok := currentActor(c)
+	if !ok {
+		return
+	}
+	page, pageSize, ok := pagination(c)
+	if !ok {
+		return
+	}
+
+	result, err := h.appService.ListApps(actor, page, pageSize)
+	if err != nil {
+		respondAppError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// GetApp handles GET /admin/apps/:id
+func (h *AdminAppHandler) GetApp(c *gin.Context) {
+	actor, ok := currentActor(c)
+	if !ok {
+		return
+	}
+	appID, ok := appIDParam(c)
+	if !ok {
+		return
+	}
+
+	app, err := h.appService.GetApp(actor, appID)
+	if err != nil {
+		respondAppError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, app)
+}
+
+// UpdateApp handles PATCH /admin/apps/:id
+// Changes the given fields of an app. Responds 409 if the new package ID is taken.
+func (h *AdminAppHandler) UpdateApp(c *gin.Context) {
+	actor, ok := currentActor(c)
+	if !ok {
+		return
+	}
+	appID, ok := appIDParam(c)
+	if !ok {
+		return
+	}
+
+	var req UpdateAppRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid request body",
+		})
+		return
+	}
+
+	app, err := h.appService.UpdateApp(actor, appID, &service.AppInput{
+		AppName:        req.AppName,
+		PackageID:      req.PackageID,
+		DeepLinkScheme: req.DeepLinkScheme,
+		RedirectURIs:   req.RedirectURIs,
+		RequirePKCE:    req.RequirePKCE,
+		OwnerID:        req.OwnerID,
+		Scopes:         req.Scopes,
+	})
+	if err != nil {
+		respondAppError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, app)
+}
+
+// DeleteApp handles DELETE /admin/apps/:id
+// Removes the app with its permissions, outstanding codes and sessions.
+func (h *AdminAppHandler) DeleteApp(c *gin.Context) {
+	actor, ok := currentActor(c)
+	if !ok {
+		return
+	}
+	appID, ok := appIDParam(c)
+	if !ok {
+		return
+	}
+
+	if err := h.appService.DeleteApp(actor, appID); err != nil {
+		respondAppError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "app deleted",
+	})
+}
+
+// appIDParam parses the :id path parameter, writing a 400 and returning
+// false if it is not a UUID.
+func appIDParam(c *gin.Context) (uuid.UUID, bool) {
+	appID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid app id format",
+		})
+		return uuid.Nil, false
+	}
+	return appID, true
+}
+
+// respondAppError maps AppService errors to HTTP responses.
+func respondAppError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch err {
+	case service.ErrInvalidAppName, service.ErrInvalidPackageID,
+		service.ErrInvalidDeepLinkScheme, service.ErrInvalidRedirectURIs, service.ErrInvalidOwner, service.ErrInvalidScopes,
+		service.ErrTenantNotFound:
+		status = http.StatusBadRequest
+	case service.ErrForbidden:
+		status = http.StatusForbidden
+	case service.ErrAppNotFound:
+		status = http.StatusNotFound
+	case service.ErrPackageIDTaken:
+		status = http.StatusConflict
+	}
+	c.JSON(status, gin.H{
+		"error": err.Error(),
+	})
+}
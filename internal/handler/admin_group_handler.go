@@ -0,0 +1,286 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/cachatto/master-slave-server/internal/service"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// AdminGroupHandler handles the admin-only group management endpoints.
+type AdminGroupHandler struct {
+	groupService *service.GroupService
+}
+
+// NewAdminGroupHandler creates a new AdminGroupHandler.
+func NewAdminGroupHandler(groupService *service.GroupService) *AdminGroupHandler {
+	return &AdminGroupHandler{groupService: groupService}
+}
+
+// CreateGroupRequest is the expected JSON body for POST /admin/groups.
+// Without a tenant_id the group is created in the admin's own tenant; only
+// superadmins may name another tenant.
+type CreateGroupRequest struct {
+	TenantID    *uuid.UUID `json:"tenant_id"`
+	Name        string     `json:"name" binding:"required"`
+	Description string     `json:"description"`
+}
+
+// UpdateGroupRequest is the expected JSON body for PATCH /admin/groups/:id.
+// Omitted fields are left unchanged.
+type UpdateGroupRequest struct {
+	Name        *string `json:"name"`
+	Description *string `json:"description"`
+}
+
+// GroupMembersRequest is the expected JSON body for POST and DELETE
+// /admin/groups/:id/members.
+type GroupMembersRequest struct {
+	UserIDs []uuid.UUID `json:"user_ids" binding:"required,min=1,max=100"`
+}
+
+// CreateGroup handles POST /admin/groups
+// Responds 409 if the name is taken.
+func (h *AdminGroupHandler) CreateGroup(c *gin.Context) {
+	actor, ok := currentActor(c)
+	if !ok {
+		return
+	}
+
+	var req CreateGroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid request: name is required",
+		})
+		return
+	}
+
+	group, err := h.groupService.CreateGroup(actor, &service.GroupInput{
+		TenantID:    req.TenantID,
+		Name:        &req.Name,
+		Description: &req.Description,
+	})
+	if err != nil {
+		respondGroupError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, group)
+}
+
+// ListGroups handles GET /admin/groups?page=1&page_size=20
+// Returns one page of groups with the total number of groups. Admins other
+// than superadmins only see the groups of their tenant.
+func (h *AdminGroupHandler) ListGroups(c *gin.Context) {
+	actor, ok := currentActor(c)
+	if !ok {
+		return
+	}
+	page, pageSize, ok := pagination(c)
+	if !ok {
+		return
+	}
+
+	result, err := h.groupService.ListGroups(actor, page, pageSize)
+	if err != nil {
+		respondGroupError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// GetGroup handles GET /admin/groups/:id
+func (h *AdminGroupHandler) GetGroup(c *gin.Context) {
+	actor, ok := currentActor(c)
+	if !ok {
+		return
+	}
+	groupID, ok := groupIDParam(c)
+	if !ok {
+		return
+	}
+
+	group, err := h.groupService.GetGroup(actor, groupID)
+	if err != nil {
+		respondGroupError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, group)
+}
+
+// UpdateGroup handles PATCH /admin/groups/:id
+// Changes the given fields of a group. Responds 409 if the new name is taken.
+func (h *AdminGroupHandler) UpdateGroup(c *gin.Context) {
+	actor, ok := currentActor(c)
+	if !ok {
+		return
+	}
+	groupID, ok := groupIDParam(c)
+	if !ok {
+		return
+	}
+
+	var req UpdateGroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid request body",
+		})
+		return
+	}
+
+	group, err := h.groupService.UpdateGroup(actor, groupID, &service.GroupInput{
+		Name:        req.Name,
+		Description: req.Description,
+	})
+	if err != nil {
+		respondGroupError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, group)
+}
+
+// DeleteGroup handles DELETE /admin/groups/:id
+// Removes the group with its memberships and app permissions. Members lose
+// the codes and sessions of the apps they could only use through the group.
+func (h *AdminGroupHandler) DeleteGroup(c *gin.Context) {
+	actor, ok := currentActor(c)
+	if !ok {
+		return
+	}
+	groupID, ok := groupIDParam(c)
+	if !ok {
+		return
+	}
+
+	if err := h.groupService.DeleteGroup(actor, groupID); err != nil {
+		respondGroupError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "group deleted",
+	})
+}
+
+// ListMembers handles GET /admin/groups/:id/members?page=1&page_size=20
+// Returns one page of the members of the group.
+func (h *AdminGroupHandler) ListMembers(c *gin.Context) {
+	actor, ok := currentActor(c)
+	if !ok {
+		return
+	}
+	groupID, ok := groupIDParam(c)
+	if !ok {
+		return
+	}
+	page, pageSize, ok := pagination(c)
+	if !ok {
+		return
+	}
+
+	result, err := h.groupService.ListMembers(actor, groupID, page, pageSize)
+	if err != nil {
+		respondGroupError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// AddMembers handles POST /admin/groups/:id/members
+// Adds up to 100 users of the group's tenant at once to the group.
+func (h *AdminGroupHandler) AddMembers(c *gin.Context) {
+	actor, ok := currentActor(c)
+	if !ok {
+		return
+	}
+	groupID, userIDs, ok := h.bindMembers(c)
+	if !ok {
+		return
+	}
+
+	if err := h.groupService.AddMembers(actor, groupID, userIDs); err != nil {
+		respondGroupError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "members added",
+	})
+}
+
+// RemoveMembers handles DELETE /admin/groups/:id/members
+// Removes up to 100 users at once from the group. They lose the codes and
+// sessions of the apps they could only use through the group.
+func (h *AdminGroupHandler) RemoveMembers(c *gin.Context) {
+	actor, ok := currentActor(c)
+	if !ok {
+		return
+	}
+	groupID, userIDs, ok := h.bindMembers(c)
+	if !ok {
+		return
+	}
+
+	if err := h.groupService.RemoveMembers(actor, groupID, userIDs); err != nil {
+		respondGroupError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "members removed",
+	})
+}
+
+// bindMembers reads the group ID and the user IDs of a GroupMembersRequest,
+// writing a 400 and returning false if either is invalid.
+func (h *AdminGroupHandler) bindMembers(c *gin.Context) (uuid.UUID, []uuid.UUID, bool) {
+	groupID, ok := groupIDParam(c)
+	if !ok {
+		return uuid.Nil, nil, false
+	}
+
+	var req GroupMembersRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid request: user_ids must list between 1 and 100 user ids",
+		})
+		return uuid.Nil, nil, false
+	}
+	return groupID, req.UserIDs, true
+}
+
+// groupIDParam parses the :id path parameter, writing a 400 and returning
+// false if it is not a UUID.
+func groupIDParam(c *gin.Context) (uuid.UUID, bool) {
+	groupID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid group id format",
+		})
+		return uuid.Nil, false
+	}
+	return groupID, true
+}
+
+// respondGroupError maps GroupService errors to HTTP responses.
+func respondGroupError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch err {
+	case service.ErrInvalidGroupName, service.ErrUnknownUsers, service.ErrTenantNotFound:
+		status = http.StatusBadRequest
+	case service.ErrForbidden:
+		status = http.StatusForbidden
+	case service.ErrGroupNotFound:
+		status = http.StatusNotFound
+	case service.ErrGroupNameTaken:
+		status = http.StatusConflict
+	}
+	c.JSON(status, gin.H{
+		"error": err.Error(),
+	})
+}
@@ -0,0 +1,336 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/cachatto/master-slave-server/internal/service"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// AdminPermissionHandler handles the admin-only endpoints that grant and
+// revoke user ↔ app and group ↔ app permissions.
+type AdminPermissionHandler struct {
+	permissionService *service.PermissionService
+}
+
+// NewAdminPermissionHandler creates a new AdminPermissionHandler.
+func NewAdminPermissionHandler(permissionService *service.PermissionService) *AdminPermissionHandler {
+	return &AdminPermissionHandler{permissionService: permissionService}
+}
+
+// UserAppsRequest is the expected JSON body for POST and DELETE
+// /admin/users/:id/apps and /admin/groups/:id/apps. Scopes and the RFC 3339
+// validity window are only read when granting; groups take no window.
+type UserAppsRequest struct {
+	AppIDs     []uuid.UUID `json:"app_ids" binding:"required,min=1,max=100"`
+	Scopes     []string    `json:"scopes"`
+	ValidFrom  *time.Time  `json:"valid_from"`
+	ValidUntil *time.Time  `json:"valid_until"`
+}
+
+// AppUsersRequest is the expected JSON body for POST and DELETE
+// /admin/apps/:id/users. Scopes and the RFC 3339 validity window are only
+// read when granting.
+type AppUsersRequest struct {
+	UserIDs    []uuid.UUID `json:"user_ids" binding:"required,min=1,max=100"`
+	Scopes     []string    `json:"scopes"`
+	ValidFrom  *time.Time  `json:"valid_from"`
+	ValidUntil *time.Time  `json:"valid_until"`
+}
+
+// ListUserApps handles GET /admin/users/:id/apps
+// Returns the apps the user is permitted to use, directly or through a
+// group, with the effective scopes. App-admins only see the apps they own.
+func (h *AdminPermissionHandler) ListUserApps(c *gin.Context) {
+	actor, ok := currentActor(c)
+	if !ok {
+		return
+	}
+	userID, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+
+	apps, err := h.permissionService.ListUserApps(actor, userID)
+	if err != nil {
+		respondPermissionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"apps": apps,
+	})
+}
+
+// GrantUserApps handles POST /admin/users/:id/apps
+// Permits the user to use up to 100 apps at once with the given scopes,
+// from valid_from until valid_until when set, replacing the scopes and
+// window of existing grants. Every app must declare every scope.
+func (h *AdminPermissionHandler) GrantUserApps(c *gin.Context) {
+	actor, ok := currentActor(c)
+	if !ok {
+		return
+	}
+	userID, req, ok := h.bindUserApps(c)
+	if !ok {
+		return
+	}
+
+	if err := h.permissionService.GrantApps(actor, userID, req.AppIDs, req.Scopes, service.GrantWindow{
+		ValidFrom:  req.ValidFrom,
+		ValidUntil: req.ValidUntil,
+	}); err != nil {
+		respondPermissionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "permissions granted",
+	})
+}
+
+// RevokeUserApps handles DELETE /admin/users/:id/apps
+// Withdraws the user's permission for up to 100 apps at once, deleting
+// their outstanding codes and revoking their sessions with those apps.
+func (h *AdminPermissionHandler) RevokeUserApps(c *gin.Context) {
+	actor, ok := currentActor(c)
+	if !ok {
+		return
+	}
+	userID, req, ok := h.bindUserApps(c)
+	if !ok {
+		return
+	}
+
+	if err := h.permissionService.RevokeApps(actor, userID, req.AppIDs); err != nil {
+		respondPermissionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "permissions revoked",
+	})
+}
+
+// ListAppUsers handles GET /admin/apps/:id/users?page=1&page_size=20
+// Returns one page of the users directly permitted to use the app with the
+// granted scopes. Group grants are listed under /admin/groups/:id/apps.
+func (h *AdminPermissionHandler) ListAppUsers(c *gin.Context) {
+	actor, ok := currentActor(c)
+	if !ok {
+		return
+	}
+	appID, ok := appIDParam(c)
+	if !ok {
+		return
+	}
+	page, pageSize, ok := pagination(c)
+	if !ok {
+		return
+	}
+
+	result, err := h.permissionService.ListAppUsers(actor, appID, page, pageSize)
+	if err != nil {
+		respondPermissionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// GrantAppUsers handles POST /admin/apps/:id/users
+// Permits up to 100 users at once to use the app with the given scopes,
+// from valid_from until valid_until when set, replacing the scopes and
+// window of existing grants. The app must declare every scope.
+func (h *AdminPermissionHandler) GrantAppUsers(c *gin.Context) {
+	actor, ok := currentActor(c)
+	if !ok {
+		return
+	}
+	appID, req, ok := h.bindAppUsers(c)
+	if !ok {
+		return
+	}
+
+	if err := h.permissionService.GrantUsers(actor, appID, req.UserIDs, req.Scopes, service.GrantWindow{
+		ValidFrom:  req.ValidFrom,
+		ValidUntil: req.ValidUntil,
+	}); err != nil {
+		respondPermissionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "permissions granted",
+	})
+}
+
+// RevokeAppUsers handles DELETE /admin/apps/:id/users
+// Withdraws the permission of up to 100 users at once, deleting their
+// outstanding codes and revoking their sessions with the app.
+func (h *AdminPermissionHandler) RevokeAppUsers(c *gin.Context) {
+	actor, ok := currentActor(c)
+	if !ok {
+		return
+	}
+	appID, req, ok := h.bindAppUsers(c)
+	if !ok {
+		return
+	}
+
+	if err := h.permissionService.RevokeUsers(actor, appID, req.UserIDs); err != nil {
+		respondPermissionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "permissions revoked",
+	})
+}
+
+// ListGroupApps handles GET /admin/groups/:id/apps
+// Returns the apps the group is permitted to use with the granted scopes.
+// App-admins only see the apps they own.
+func (h *AdminPermissionHandler) ListGroupApps(c *gin.Context) {
+	actor, ok := currentActor(c)
+	if !ok {
+		return
+	}
+	groupID, ok := groupIDParam(c)
+	if !ok {
+		return
+	}
+
+	apps, err := h.permissionService.ListGroupApps(actor, groupID)
+	if err != nil {
+		respondPermissionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"apps": apps,
+	})
+}
+
+// GrantGroupApps handles POST /admin/groups/:id/apps
+// Permits every member of the group to use up to 100 apps at once with the
+// given scopes, replacing the scopes of existing group grants. Every app
+// must declare every scope.
+func (h *AdminPermissionHandler) GrantGroupApps(c *gin.Context) {
+	actor, ok := currentActor(c)
+	if !ok {
+		return
+	}
+	groupID, req, ok := h.bindGroupApps(c)
+	if !ok {
+		return
+	}
+
+	if err := h.permissionService.GrantGroupApps(actor, groupID, req.AppIDs, req.Scopes); err != nil {
+		respondPermissionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "permissions granted",
+	})
+}
+
+// RevokeGroupApps handles DELETE /admin/groups/:id/apps
+// Withdraws the group's permission for up to 100 apps at once. Members lose
+// the codes and sessions of the apps they could only use through the group.
+func (h *AdminPermissionHandler) RevokeGroupApps(c *gin.Context) {
+	actor, ok := currentActor(c)
+	if !ok {
+		return
+	}
+	groupID, req, ok := h.bindGroupApps(c)
+	if !ok {
+		return
+	}
+
+	if err := h.permissionService.RevokeGroupApps(actor, groupID, req.AppIDs); err != nil {
+		respondPermissionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "permissions revoked",
+	})
+}
+
+// bindUserApps reads the user ID and a UserAppsRequest, writing a 400 and
+// returning false if either is invalid.
+func (h *AdminPermissionHandler) bindUserApps(c *gin.Context) (uuid.UUID, UserAppsRequest, bool) {
+	var req UserAppsRequest
+	userID, ok := userIDParam(c)
+	if !ok {
+		return uuid.Nil, req, false
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid request: app_ids must list between 1 and 100 app ids",
+		})
+		return uuid.Nil, req, false
+	}
+	return userID, req, true
+}
+
+// bindAppUsers reads the app ID and an AppUsersRequest, writing a 400 and
+// returning false if either is invalid.
+func (h *AdminPermissionHandler) bindAppUsers(c *gin.Context) (uuid.UUID, AppUsersRequest, bool) {
+	var req AppUsersRequest
+	appID, ok := appIDParam(c)
+	if !ok {
+		return uuid.Nil, req, false
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid request: user_ids must list between 1 and 100 user ids",
+		})
+		return uuid.Nil, req, false
+	}
+	return appID, req, true
+}
+
+// bindGroupApps reads the group ID and a UserAppsRequest, writing a 400 and
+// returning false if either is invalid.
+func (h *AdminPermissionHandler) bindGroupApps(c *gin.Context) (uuid.UUID, UserAppsRequest, bool) {
+	var req UserAppsRequest
+	groupID, ok := groupIDParam(c)
+	if !ok {
+		return uuid.Nil, req, false
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid request: app_ids must list between 1 and 100 app ids",
+		})
+		return uuid.Nil, req, false
+	}
+	if req.ValidFrom != nil || req.ValidUntil != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid request: group grants cannot have a validity window",
+		})
+		return uuid.Nil, req, false
+	}
+	return groupID, req, true
+}
+
+// respondPermissionError maps PermissionService errors to HTTP responses.
+func respondPermissionError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch err {
+	case service.ErrUnknownApps, service.ErrUnknownUsers, service.ErrScopeNotDeclared, service.ErrInvalidWindow:
+		status = http.StatusBadRequest
+	case service.ErrUserNotFound, service.ErrAppNotFound, service.ErrGroupNotFound:
+		status = http.StatusNotFound
+	}
+	c.JSON(status, gin.H{
+		"error": err.Error(),
+	})
+}
@@ -0,0 +1,147 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/cachatto/master-slave-server/internal/service"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// AdminTenantHandler handles the superadmin-only tenant management endpoints.
+type AdminTenantHandler struct {
+	tenantService *service.TenantService
+}
+
+// NewAdminTenantHandler creates a new AdminTenantHandler.
+func NewAdminTenantHandler(tenantService *service.TenantService) *AdminTenantHandler {
+	return &AdminTenantHandler{tenantService: tenantService}
+}
+
+// CreateTenantRequest is the expected JSON body for POST /admin/tenants.
+// Slug is the name clients sign in and sign up with.
+type CreateTenantRequest struct {
+	Name string `json:"name" binding:"required"`
+	Slug string `json:"slug" binding:"required"`
+}
+
+// UpdateTenantRequest is the expected JSON body for PATCH /admin/tenants/:id.
+// Omitted fields are left unchanged.
+type UpdateTenantRequest struct {
+	Name *string `json:"name"`
+	Slug *string `json:"slug"`
+}
+
+// CreateTenant handles POST /admin/tenants
+// Responds 409 if the slug is taken.
+func (h *AdminTenantHandler) CreateTenant(c *gin.Context) {
+	var req CreateTenantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid request: name and slug are required",
+		})
+		return
+	}
+
+	tenant, err := h.tenantService.CreateTenant(&service.TenantInput{
+		Name: &req.Name,
+		Slug: &req.Slug,
+	})
+	if err != nil {
+		respondTenantError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, tenant)
+}
+
+// ListTenants handles GET /admin/tenants?page=1&page_size=20
+// Returns one page of tenants with the total number of tenants.
+func (h *AdminTenantHandler) ListTenants(c *gin.Context) {
+	page, pageSize, ok := pagination(c)
+	if !ok {
+		return
+	}
+
+	result, err := h.tenantService.ListTenants(page, pageSize)
+	if err != nil {
+		respondTenantError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// GetTenant handles GET /admin/tenants/:id
+func (h *AdminTenantHandler) GetTenant(c *gin.Context) {
+	tenantID, ok := tenantIDParam(c)
+	if !ok {
+		return
+	}
+
+	tenant, err := h.tenantService.GetTenant(tenantID)
+	if err != nil {
+		respondTenantError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, tenant)
+}
+
+// UpdateTenant handles PATCH /admin/tenants/:id
+// Changes the given fields of a tenant. Responds 409 if the new slug is taken
+// or the tenant is the default tenant, whose slug cannot change.
+func (h *AdminTenantHandler) UpdateTenant(c *gin.Context) {
+	tenantID, ok := tenantIDParam(c)
+	if !ok {
+		return
+	}
+
+	var req UpdateTenantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid request body",
+		})
+		return
+	}
+
+	tenant, err := h.tenantService.UpdateTenant(tenantID, &service.TenantInput{
+		Name: req.Name,
+		Slug: req.Slug,
+	})
+	if err != nil {
+		respondTenantError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, tenant)
+}
+
+// tenantIDParam parses the :id path parameter, writing a 400 and returning
+// false if it is not a UUID.
+func tenantIDParam(c *gin.Context) (uuid.UUID, bool) {
+	tenantID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid tenant id format",
+		})
+		return uuid.Nil, false
+	}
+	return tenantID, true
+}
+
+// respondTenantError maps TenantService errors to HTTP responses.
+func respondTenantError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch err {
+	case service.ErrInvalidTenantName, service.ErrInvalidTenantSlug:
+		status = http.StatusBadRequest
+	case service.ErrTenantNotFound:
+		status = http.StatusNotFound
+	case service.ErrTenantSlugTaken, service.ErrDefaultTenantSlug:
+		status = http.StatusConflict
+	}
+	c.JSON(status, gin.H{
+		"error": err.Error(),
+	})
+}
@@ -0,0 +1,239 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/cachatto/master-slave-server/internal/service"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// AdminUserHandler handles the admin-only user management endpoints.
+type AdminUserHandler struct {
+	userService *service.UserService
+}
+
+// NewAdminUserHandler creates a new AdminUserHandler.
+func NewAdminUserHandler(userService *service.UserService) *AdminUserHandler {
+	return &AdminUserHandler{userService: userService}
+}
+
+// CreateUserRequest is the expected JSON body for POST /admin/users.
+// Without a password the user is emailed an invite to choose one; without
+// a role they get the "user" role. Without a tenant_id the user is created
+// in the admin's own tenant; only superadmins may name another tenant.
+type CreateUserRequest struct {
+	TenantID *uuid.UUID `json:"tenant_id"`
+	Email    string     `json:"email" binding:"required,email,max=255"`
+	Password string     `json:"password"`
+	Role     string     `json:"role"`
+}
+
+// SetRoleRequest is the expected JSON body for PUT /admin/users/:id/role.
+type SetRoleRequest struct {
+	Role string `json:"role" binding:"required"`
+}
+
+// CreateUser handles POST /admin/users
+// Creates a user with a verified email. Responds 409 if the email is taken
+// in the tenant, including by a deleted user. The user is created even if
+// the invite email fails; POST /admin/users/:id/force-password-reset sends
+// a new link.
+func (h *AdminUserHandler) CreateUser(c *gin.Context) {
+	actor, ok := currentActor(c)
+	if !ok {
+		return
+	}
+
+	var req CreateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid request: a valid email is required",
+		})
+		return
+	}
+
+	user, err := h.userService.CreateUser(actor, req.TenantID, req.Email, req.Password, req.Role)
+	if err != nil {
+		respondUserError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, user)
+}
+
+// ListUsers handles GET /admin/users?email=&deleted=false&page=1&page_size=20
+// Returns one page of users whose email contains the "email" query, with
+// the total number of matches. deleted=true lists soft-deleted users.
+// Admins other than superadmins only see the users of their tenant.
+func (h *AdminUserHandler) ListUsers(c *gin.Context) {
+	actor, ok := currentActor(c)
+	if !ok {
+		return
+	}
+	page, pageSize, ok := pagination(c)
+	if !ok {
+		return
+	}
+
+	deleted := false
+	if raw := c.Query("deleted"); raw != "" {
+		var err error
+		if deleted, err = strconv.ParseBool(raw); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "deleted must be true or false",
+			})
+			return
+		}
+	}
+
+	result, err := h.userService.ListUsers(actor, c.Query("email"), deleted, page, pageSize)
+	if err != nil {
+		respondUserError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// GetUser handles GET /admin/users/:id
+// Deleted users are returned too, with deleted_at set.
+func (h *AdminUserHandler) GetUser(c *gin.Context) {
+	actor, ok := currentActor(c)
+	if !ok {
+		return
+	}
+	userID, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+
+	user, err := h.userService.GetUser(actor, userID)
+	if err != nil {
+		respondUserError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// SetRole handles PUT /admin/users/:id/role
+// Changes the user's role and revokes all their sessions.
+func (h *AdminUserHandler) SetRole(c *gin.Context) {
+	var req SetRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "role is required",
+		})
+		return
+	}
+
+	h.act(c, "role updated", func(actor service.Actor, userID uuid.UUID) error {
+		return h.userService.SetRole(actor, userID, req.Role)
+	})
+}
+
+// DisableUser handles POST /admin/users/:id/disable
+// Blocks the user from logging in, refreshing tokens and claiming OTCs, and
+// revokes all their sessions.
+func (h *AdminUserHandler) DisableUser(c *gin.Context) {
+	h.act(c, "user disabled", func(actor service.Actor, userID uuid.UUID) error {
+		return h.userService.DisableUser(actor, userID)
+	})
+}
+
+// EnableUser handles POST /admin/users/:id/enable
+func (h *AdminUserHandler) EnableUser(c *gin.Context) {
+	h.act(c, "user enabled", func(actor service.Actor, userID uuid.UUID) error {
+		return h.userService.EnableUser(actor, userID)
+	})
+}
+
+// DeleteUser handles DELETE /admin/users/:id
+// Soft-deletes the user and revokes all their sessions.
+func (h *AdminUserHandler) DeleteUser(c *gin.Context) {
+	h.act(c, "user deleted", func(actor service.Actor, userID uuid.UUID) error {
+		return h.userService.DeleteUser(actor, userID)
+	})
+}
+
+// RestoreUser handles POST /admin/users/:id/restore
+// Undoes a soft delete.
+func (h *AdminUserHandler) RestoreUser(c *gin.Context) {
+	h.act(c, "user restored", func(actor service.Actor, userID uuid.UUID) error {
+		return h.userService.RestoreUser(actor, userID)
+	})
+}
+
+// ForcePasswordReset handles POST /admin/users/:id/force-password-reset
+// Clears the user's password, revokes all their sessions and emails them a
+// password reset link.
+func (h *AdminUserHandler) ForcePasswordReset(c *gin.Context) {
+	h.act(c, "password reset required; the user has been emailed a reset link", func(actor service.Actor, userID uuid.UUID) error {
+		return h.userService.ForcePasswordReset(actor, userID)
+	})
+}
+
+// UnlockUser handles POST /admin/users/:id/unlock
+// Clears the user's failed-login counter and account lockout.
+func (h *AdminUserHandler) UnlockUser(c *gin.Context) {
+	h.act(c, "user unlocked", func(actor service.Actor, userID uuid.UUID) error {
+		return h.userService.UnlockUser(actor, userID)
+	})
+}
+
+// act runs an admin action on the user in the :id path parameter on behalf
+// of the signed-in admin and writes the response.
+func (h *AdminUserHandler) act(c *gin.Context, message string, action func(actor service.Actor, userID uuid.UUID) error) {
+	actor, ok := currentActor(c)
+	if !ok {
+		return
+	}
+	userID, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+
+	if err := action(actor, userID); err != nil {
+		respondUserError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": message,
+	})
+}
+
+// userIDParam parses the :id path parameter, writing a 400 and returning
+// false if it is not a UUID.
+func userIDParam(c *gin.Context) (uuid.UUID, bool) {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid user id format",
+		})
+		return uuid.Nil, false
+	}
+	return userID, true
+}
+
+// respondUserError maps UserService errors to HTTP responses.
+func respondUserError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	var policyErr *service.PasswordPolicyError
+	switch {
+	case errors.As(err, &policyErr), err == service.ErrInvalidRole, err == service.ErrTenantNotFound:
+		status = http.StatusBadRequest
+	case err == service.ErrCannotModifySelf, err == service.ErrForbidden:
+		status = http.StatusForbidden
+	case err == service.ErrUserNotFound:
+		status = http.StatusNotFound
+	case err == service.ErrEmailTaken:
+		status = http.StatusConflict
+	}
+	c.JSON(status, gin.H{
+		"error": err.Error(),
+	})
+}
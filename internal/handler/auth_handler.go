@@ -18,11 +18,21 @@ func NewAuthHandler(authService *service.AuthService) *AuthHandler {
 }
 
 // LoginRequest is the expected JSON body for POST /auth/login.
+// Tenant is the slug of the user's organization; omitted, it is the default
+// tenant.
 type LoginRequest struct {
+	Tenant   string `json:"tenant"`
 	Email    string `json:"email" binding:"required,email"`
 	Password string `json:"password" binding:"required,min=6"`
 }
 
+// LoginMFARequest is the expected JSON body for POST /auth/login/mfa.
+// Code is either a 6-digit TOTP code or a recovery code.
+type LoginMFARequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
 // RefreshRequest is the expected JSON body for POST /auth/refresh.
 type RefreshRequest struct {
 	RefreshToken string `json:"refresh_token" binding:"required"`
@@ -30,6 +40,8 @@ type RefreshRequest struct {
 
 // Login handles POST /auth/login
 // Validates credentials and returns an access + refresh token pair.
+// Responds 429 with Retry-After while the client IP or account is locked out,
+// and 403 if the user has not verified their email address yet.
 func (h *AuthHandler) Login(c *gin.Context) {
 	var req LoginRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -39,9 +51,55 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	tokens, err := h.authService.Login(req.Email, req.Password)
+	result, err := h.authService.Login(req.Tenant, req.Email, req.Password, c.ClientIP())
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{
+		if respondLocked(c, err) {
+			return
+		}
+		status := unauthorizedStatus(err)
+		if err == service.ErrEmailNotVerified || err == service.ErrUserDisabled {
+			status = http.StatusForbidden
+		}
+		c.JSON(status, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if result.MFAToken != "" {
+		c.JSON(http.StatusOK, gin.H{
+			"message":      "two-factor authentication required",
+			"mfa_required": true,
+			"mfa_token":    result.MFAToken,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "login successful",
+		"access_token":  result.Tokens.AccessToken,
+		"refresh_token": result.Tokens.RefreshToken,
+	})
+}
+
+// LoginMFA handles POST /auth/login/mfa
+// Completes a two-step login with the mfa_token returned by /auth/login and
+// a TOTP or recovery code, and returns an access + refresh token pair.
+func (h *AuthHandler) LoginMFA(c *gin.Context) {
+	var req LoginMFARequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid request: mfa_token and code are required",
+		})
+		return
+	}
+
+	tokens, err := h.authService.LoginMFA(req.MFAToken, req.Code, c.ClientIP())
+	if err != nil {
+		if respondLocked(c, err) {
+			return
+		}
+		c.JSON(unauthorizedStatus(err), gin.H{
 			"error": err.Error(),
 		})
 		return
@@ -66,7 +124,7 @@ func (h *AuthHandler) Verify(c *gin.Context) {
 
 	profile, err := h.authService.VerifyToken(tokenString)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{
+		c.JSON(unauthorizedStatus(err), gin.H{
 			"error": err.Error(),
 		})
 		return
@@ -90,7 +148,7 @@ func (h *AuthHandler) Refresh(c *gin.Context) {
 
 	tokens, err := h.authService.RefreshToken(req.RefreshToken)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{
+		c.JSON(unauthorizedStatus(err), gin.H{
 			"error": err.Error(),
 		})
 		return
@@ -102,3 +160,45 @@ func (h *AuthHandler) Refresh(c *gin.Context) {
 		"refresh_token": tokens.RefreshToken,
 	})
 }
+
+// Logout handles POST /auth/logout
+// Requires a valid access token (via JWT middleware).
+// Revokes the session the access token belongs to, including its refresh token.
+func (h *AuthHandler) Logout(c *gin.Context) {
+	sessionID, ok := currentSessionID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.authService.Logout(sessionID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "logged out",
+	})
+}
+
+// LogoutAll handles POST /auth/logout-all
+// Requires a valid access token (via JWT middleware).
+// Revokes every session of the user, including slave app sessions.
+func (h *AuthHandler) LogoutAll(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.authService.LogoutAll(userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "logged out of all sessions",
+	})
+}
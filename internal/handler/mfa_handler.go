@@ -0,0 +1,173 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/cachatto/master-slave-server/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+// MFAHandler handles two-factor authentication enrollment endpoints.
+// Endpoints that check a code of an enabled second factor go through
+// AuthService, which counts failures towards the login lockouts.
+type MFAHandler struct {
+	mfaService  *service.MFAService
+	authService *service.AuthService
+}
+
+// NewMFAHandler creates a new MFAHandler.
+func NewMFAHandler(mfaService *service.MFAService, authService *service.AuthService) *MFAHandler {
+	return &MFAHandler{mfaService: mfaService, authService: authService}
+}
+
+// MFACodeRequest is the expected JSON body for endpoints that require a
+// TOTP or recovery code.
+type MFACodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// Status handles GET /auth/mfa
+// Requires a valid access token (via JWT middleware).
+// Reports whether TOTP is enabled and how many unused recovery codes remain,
+// so clients can prompt for new codes before they run out.
+func (h *MFAHandler) Status(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	status, err := h.mfaService.Status(userID)
+	if err != nil {
+		respondMFAError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// EnrollTOTP handles POST /auth/mfa/totp/enroll
+// Requires a valid access token (via JWT middleware).
+// Returns a new TOTP secret and its otpauth:// provisioning URI (for a QR code).
+func (h *MFAHandler) EnrollTOTP(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	enrollment, err := h.mfaService.BeginTOTPEnrollment(userID)
+	if err != nil {
+		respondMFAError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"secret":           enrollment.Secret,
+		"provisioning_uri": enrollment.ProvisioningURI,
+	})
+}
+
+// ConfirmTOTP handles POST /auth/mfa/totp/confirm
+// Requires a valid access token (via JWT middleware).
+// Enables TOTP after verifying a code and returns the recovery codes.
+func (h *MFAHandler) ConfirmTOTP(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "code is required",
+		})
+		return
+	}
+
+	codes, err := h.mfaService.ConfirmTOTPEnrollment(userID, req.Code)
+	if err != nil {
+		respondMFAError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "two-factor authentication enabled",
+		"recovery_codes": codes,
+	})
+}
+
+// DisableTOTP handles POST /auth/mfa/totp/disable
+// Requires a valid access token (via JWT middleware).
+// Disables TOTP after verifying a TOTP or recovery code. Wrong codes count
+// towards the login lockouts; while locked out it responds 429.
+func (h *MFAHandler) DisableTOTP(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "code is required",
+		})
+		return
+	}
+
+	if err := h.authService.DisableTOTP(userID, req.Code, c.ClientIP()); err != nil {
+		respondMFAError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "two-factor authentication disabled",
+	})
+}
+
+// RegenerateRecoveryCodes handles POST /auth/mfa/recovery-codes
+// Requires a valid access token (via JWT middleware).
+// Replaces the recovery codes after verifying a TOTP or recovery code. Wrong
+// codes count towards the login lockouts; while locked out it responds 429.
+func (h *MFAHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "code is required",
+		})
+		return
+	}
+
+	codes, err := h.authService.RegenerateRecoveryCodes(userID, req.Code, c.ClientIP())
+	if err != nil {
+		respondMFAError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"recovery_codes": codes,
+	})
+}
+
+// respondMFAError maps MFAService errors to HTTP responses.
+func respondMFAError(c *gin.Context, err error) {
+	if respondLocked(c, err) {
+		return
+	}
+
+	status := http.StatusInternalServerError
+	switch err {
+	case service.ErrInvalidMFACode:
+		status = http.StatusUnauthorized
+	case service.ErrTOTPAlreadyEnabled, service.ErrTOTPNotEnabled, service.ErrTOTPNotEnrolling:
+		status = http.StatusConflict
+	case service.ErrUserNotFound:
+		status = http.StatusNotFound
+	}
+	c.JSON(status, gin.H{
+		"error": err.Error(),
+	})
+}
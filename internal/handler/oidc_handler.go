@@ -0,0 +1,263 @@
+package handler
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"html/template"
+	"net/http"
+	"strings"
+
+	"github.com/cachatto/master-slave-server/internal/limiter"
+	"github.com/cachatto/master-slave-server/internal/models"
+	"github.com/cachatto/master-slave-server/internal/service"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// loginPage is the sign-in form shown by /oauth2/authorize when the request
+// does not carry a Master app access token.
+var loginPage = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Sign in to {{.AppName}}</title>
+</head>
+<body>
+<h1>Sign in to {{.AppName}}</h1>
+{{if .Error}}<p role="alert">{{.Error}}</p>{{end}}
+<form method="post" action="/oauth2/authorize">
+<input type="hidden" name="csrf_token" value="{{.CSRFToken}}">
+<input type="hidden" name="client_id" value="{{.Req.ClientID}}">
+<input type="hidden" name="redirect_uri" value="{{.Req.RedirectURI}}">
+<input type="hidden" name="response_type" value="{{.Req.ResponseType}}">
+<input type="hidden" name="scope" value="{{.Req.Scope}}">
+<input type="hidden" name="state" value="{{.Req.State}}">
+<input type="hidden" name="nonce" value="{{.Req.Nonce}}">
+<input type="hidden" name="code_challenge" value="{{.Req.CodeChallenge}}">
+<input type="hidden" name="code_challenge_method" value="{{.Req.CodeChallengeMethod}}">
+<label>Email <input type="email" name="email" autocomplete="username" required></label>
+<label>Password <input type="password" name="password" autocomplete="current-password" required></label>
+<label>Authentication code (if two-factor is enabled) <input type="text" name="otp" autocomplete="one-time-code" inputmode="numeric"></label>
+<button type="submit">Sign in</button>
+</form>
+</body>
+</html>
+`))
+
+// csrfCookie holds the CSRF token of the sign-in form. The form must post
+// the same token back, which a cross-site page cannot read (double-submit
+// cookie).
+const csrfCookie = "oauth2_csrf"
+
+// OIDCHandler handles the OpenID Connect provider endpoints under /oauth2.
+type OIDCHandler struct {
+	oidcService *service.OIDCService
+	authService *service.AuthService
+}
+
+// NewOIDCHandler creates a new OIDCHandler.
+func NewOIDCHandler(oidcService *service.OIDCService, authService *service.AuthService) *OIDCHandler {
+	return &OIDCHandler{oidcService: oidcService, authService: authService}
+}
+
+// AuthorizeLoginRequest is the form body for POST /oauth2/authorize.
+type AuthorizeLoginRequest struct {
+	service.AuthorizeRequest
+	Email     string `form:"email"`
+	Password  string `form:"password"`
+	OTP       string `form:"otp"` // TOTP or recovery code for users with two-factor enabled
+	CSRFToken string `form:"csrf_token"`
+}
+
+// Authorize handles GET /oauth2/authorize
+// If the request carries a Master app access token the code is issued
+// immediately; otherwise a sign-in form is shown.
+func (h *OIDCHandler) Authorize(c *gin.Context) {
+	var req service.AuthorizeRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.String(http.StatusBadRequest, "invalid authorization request")
+		return
+	}
+
+	app, ok := h.validate(c, &req)
+	if !ok {
+		return
+	}
+
+	if tokenString, found := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer "); found {
+		claims, err := h.authService.ParseAccessToken(tokenString, service.MasterAudience)
+		if err != nil {
+			c.Redirect(http.StatusFound, h.oidcService.ErrorRedirect(&req, &service.OAuthError{
+				Code:        service.OAuthAccessDenied,
+				Description: err.Error(),
+			}))
+			return
+		}
+		h.issueCode(c, http.StatusFound, claims.UserID, &req)
+		return
+	}
+
+	h.renderLogin(c, http.StatusOK, app.AppName, &req, "")
+}
+
+// AuthorizeLogin handles POST /oauth2/authorize
+// Authenticates the user from the sign-in form and issues the code.
+func (h *OIDCHandler) AuthorizeLogin(c *gin.Context) {
+	var req AuthorizeLoginRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.String(http.StatusBadRequest, "invalid authorization request")
+		return
+	}
+
+	app, ok := h.validate(c, &req.AuthorizeRequest)
+	if !ok {
+		return
+	}
+
+	if cookie, err := c.Cookie(csrfCookie); err != nil || req.CSRFToken == "" ||
+		subtle.ConstantTimeCompare([]byte(cookie), []byte(req.CSRFToken)) != 1 {
+		h.renderLogin(c, http.StatusForbidden, app.AppName, &req.AuthorizeRequest, "your sign-in session expired, please try again")
+		return
+	}
+
+	user, err := h.authService.Authenticate(app.TenantID, req.Email, req.Password, c.ClientIP())
+	if err == nil && user.TOTPEnabledAt != nil {
+		if req.OTP == "" {
+			h.renderLogin(c, http.StatusUnauthorized, app.AppName, &req.AuthorizeRequest, "enter your authentication code")
+			return
+		}
+		err = h.authService.VerifySecondFactor(user, req.OTP, c.ClientIP())
+	}
+	if err != nil {
+		status := unauthorizedStatus(err)
+		var locked *limiter.LockedError
+		switch {
+		case errors.As(err, &locked):
+			status = http.StatusTooManyRequests
+		case err == service.ErrEmailNotVerified || err == service.ErrUserDisabled:
+			status = http.StatusForbidden
+		}
+		h.renderLogin(c, status, app.AppName, &req.AuthorizeRequest, err.Error())
+		return
+	}
+
+	h.issueCode(c, http.StatusSeeOther, user.ID, &req.AuthorizeRequest)
+}
+
+// Token handles POST /oauth2/token
+// Redeems an authorization code (with PKCE verifier) or a refresh token.
+func (h *OIDCHandler) Token(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+
+	var req service.TokenRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, &service.OAuthError{Code: service.OAuthInvalidRequest})
+		return
+	}
+
+	resp, err := h.oidcService.Token(&req)
+	if err != nil {
+		var oauthErr *service.OAuthError
+		if !errors.As(err, &oauthErr) {
+			c.JSON(http.StatusInternalServerError, &service.OAuthError{Code: service.OAuthServerError})
+			return
+		}
+		status := http.StatusBadRequest
+		if oauthErr.Code == service.OAuthInvalidClient {
+			status = http.StatusUnauthorized
+		}
+		c.JSON(status, oauthErr)
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// UserInfo handles GET/POST /oauth2/userinfo
+// Returns the claims about the user behind a client access token.
+func (h *OIDCHandler) UserInfo(c *gin.Context) {
+	tokenString, found := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !found {
+		c.Header("WWW-Authenticate", `Bearer error="invalid_request"`)
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "authorization header must be in the format: Bearer <token>",
+		})
+		return
+	}
+
+	info, err := h.oidcService.UserInfo(tokenString)
+	if err != nil {
+		status := unauthorizedStatus(err)
+		if status == http.StatusUnauthorized {
+			c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+		}
+		c.JSON(status, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, info)
+}
+
+// validate checks an authorization request, writing the error response and
+// returning false if it is invalid.
+func (h *OIDCHandler) validate(c *gin.Context, req *service.AuthorizeRequest) (*models.App, bool) {
+	app, err := h.oidcService.ValidateAuthorizeRequest(req)
+	if err == nil {
+		return app, true
+	}
+
+	var oauthErr *service.OAuthError
+	if errors.As(err, &oauthErr) {
+		c.Redirect(http.StatusFound, h.oidcService.ErrorRedirect(req, oauthErr))
+		return nil, false
+	}
+
+	// Never redirect to an unverified redirect_uri
+	c.String(http.StatusBadRequest, err.Error())
+	return nil, false
+}
+
+// issueCode issues an authorization code and redirects back to the client.
+func (h *OIDCHandler) issueCode(c *gin.Context, status int, userID uuid.UUID, req *service.AuthorizeRequest) {
+	location, err := h.oidcService.Authorize(userID, req)
+	if err != nil {
+		var oauthErr *service.OAuthError
+		if errors.As(err, &oauthErr) {
+			c.Redirect(status, h.oidcService.ErrorRedirect(req, oauthErr))
+			return
+		}
+		c.Redirect(status, h.oidcService.ErrorRedirect(req, &service.OAuthError{Code: service.OAuthServerError}))
+		return
+	}
+	c.Redirect(status, location)
+}
+
+// renderLogin writes the sign-in form for an authorization request, with a
+// new CSRF token set in both the form and csrfCookie.
+func (h *OIDCHandler) renderLogin(c *gin.Context, status int, appName string, req *service.AuthorizeRequest, errMsg string) {
+	tokenBytes := make([]byte, 32)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		c.String(http.StatusInternalServerError, "failed to render the sign-in form")
+		return
+	}
+	csrfToken := hex.EncodeToString(tokenBytes)
+	secure := strings.HasPrefix(h.oidcService.Discovery().Issuer, "https://")
+	c.SetSameSite(http.SameSiteStrictMode)
+	c.SetCookie(csrfCookie, csrfToken, 0, "/oauth2/authorize", "", secure, true)
+
+	c.Header("Cache-Control", "no-store")
+	c.Header("X-Frame-Options", "DENY")
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Status(status)
+	_ = loginPage.Execute(c.Writer, gin.H{
+		"AppName":   appName,
+		"Req":       req,
+		"Error":     errMsg,
+		"CSRFToken": csrfToken,
+	})
+}
@@ -19,19 +19,28 @@ func NewOTCHandler(otcService *service.OTCService) *OTCHandler {
 }
 
 // ExchangeCodeRequest is the expected JSON body for POST /auth/exchange-code.
+// CodeChallenge is forwarded from the slave app's deep link; the method
+// defaults to S256, the only supported method. Scopes lists the app scopes
+// the token should carry; omitted, all scopes granted to the user are used.
 type ExchangeCodeRequest struct {
-	AppID string `json:"app_id" binding:"required"`
+	AppID               string   `json:"app_id" binding:"required"`
+	CodeChallenge       string   `json:"code_challenge"`
+	CodeChallengeMethod string   `json:"code_challenge_method"`
+	Scopes              []string `json:"scopes"`
 }
 
 // ClaimTokenRequest is the expected JSON body for POST /auth/claim-token.
+// CodeVerifier is required when the code was bound to a code_challenge.
 type ClaimTokenRequest struct {
-	Code      string `json:"code" binding:"required"`
-	PackageID string `json:"package_id" binding:"required"`
+	Code         string `json:"code" binding:"required"`
+	PackageID    string `json:"package_id" binding:"required"`
+	CodeVerifier string `json:"code_verifier"`
 }
 
 // ExchangeCode handles POST /auth/exchange-code
 // Requires a valid access token (via JWT middleware).
-// Generates a short-lived one-time code for a specific slave app.
+// Generates a short-lived one-time code for a specific slave app. Responds
+// 403 with an access_request_url if the user may not use the app.
 func (h *OTCHandler) ExchangeCode(c *gin.Context) {
 	var req ExchangeCodeRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -59,8 +68,9 @@ func (h *OTCHandler) ExchangeCode(c *gin.Context) {
 		return
 	}
 	userID := userIDVal.(uuid.UUID)
+	tenantID := c.MustGet("tenantID").(uuid.UUID)
 
-	result, err := h.otcService.ExchangeCode(userID, appID)
+	result, err := h.otcService.ExchangeCode(userID, tenantID, appID, req.CodeChallenge, req.CodeChallengeMethod, req.Scopes)
 	if err != nil {
 		status := http.StatusInternalServerError
 		switch err {
@@ -68,22 +78,31 @@ func (h *OTCHandler) ExchangeCode(c *gin.Context) {
 			status = http.StatusNotFound
 		case service.ErrNoPermission:
 			status = http.StatusForbidden
+		case service.ErrInvalidCodeChallenge, service.ErrPKCERequired, service.ErrUnknownScope:
+			status = http.StatusBadRequest
 		}
-		c.JSON(status, gin.H{
+		body := gin.H{
 			"error": err.Error(),
-		})
+		}
+		if err == service.ErrNoPermission {
+			// Point the user at where to ask the app's admins for access
+			body["access_request_url"] = "/apps/" + appID.String() + "/access-requests"
+		}
+		c.JSON(status, body)
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"code":       result.Code,
 		"expires_at": result.ExpiresAt,
+		"scopes":     result.Scopes,
 	})
 }
 
 // ClaimToken handles POST /auth/claim-token
 // Does NOT require authentication (the code IS the authentication).
 // Validates the one-time code and returns a JWT token pair.
+// Responds 429 with Retry-After while the client IP or app is locked out.
 func (h *OTCHandler) ClaimToken(c *gin.Context) {
 	var req ClaimTokenRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -93,14 +112,22 @@ func (h *OTCHandler) ClaimToken(c *gin.Context) {
 		return
 	}
 
-	tokens, err := h.otcService.ClaimToken(req.Code, req.PackageID)
+	tokens, err := h.otcService.ClaimToken(req.Code, req.PackageID, req.CodeVerifier, c.ClientIP())
 	if err != nil {
-		status := http.StatusUnauthorized
+		if respondLocked(c, err) {
+			return
+		}
+
+		status := unauthorizedStatus(err)
 		switch err {
 		case service.ErrAppNotFound:
 			status = http.StatusNotFound
-		case service.ErrAppMismatch:
+		case service.ErrAppMismatch, service.ErrUserDisabled, service.ErrNoPermission:
 			status = http.StatusForbidden
+		case service.ErrPKCERequired:
+			status = http.StatusBadRequest
+		case service.ErrCodeClaimed:
+			status = http.StatusConflict
 		}
 		c.JSON(status, gin.H{
 			"error": err.Error(),
@@ -0,0 +1,142 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/cachatto/master-slave-server/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+// PasswordHandler handles password change and recovery endpoints.
+type PasswordHandler struct {
+	passwordService *service.PasswordService
+}
+
+// NewPasswordHandler creates a new PasswordHandler.
+func NewPasswordHandler(passwordService *service.PasswordService) *PasswordHandler {
+	return &PasswordHandler{passwordService: passwordService}
+}
+
+// ForgotPasswordRequest is the expected JSON body for POST /auth/password/forgot.
+// Tenant is the slug of the user's organization; omitted, it is the default
+// tenant.
+type ForgotPasswordRequest struct {
+	Tenant string `json:"tenant"`
+	Email  string `json:"email" binding:"required,email"`
+}
+
+// ResetPasswordRequest is the expected JSON body for POST /auth/password/reset.
+type ResetPasswordRequest struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+// ChangePasswordRequest is the expected JSON body for POST /auth/password/change.
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+// ChangePassword handles POST /auth/password/change
+// Requires a valid access token (via JWT middleware).
+// Sets a new password after checking the current one, and signs out every
+// other session of the user while keeping this one.
+func (h *PasswordHandler) ChangePassword(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	sessionID, ok := currentSessionID(c)
+	if !ok {
+		return
+	}
+
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid request: current_password and new_password are required",
+		})
+		return
+	}
+
+	err := h.passwordService.ChangePassword(userID, sessionID, req.CurrentPassword, req.NewPassword, c.ClientIP())
+	if err != nil {
+		if respondLocked(c, err) {
+			return
+		}
+		respondPasswordError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "password changed; other sessions have been signed out",
+	})
+}
+
+// ForgotPassword handles POST /auth/password/forgot
+// Emails a single-use reset link in the background. Responds 202 whether or
+// not the account exists so accounts cannot be enumerated, and 429 once the
+// client IP or the email has requested too many links.
+func (h *PasswordHandler) ForgotPassword(c *gin.Context) {
+	var req ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid request: a valid email is required",
+		})
+		return
+	}
+
+	if err := h.passwordService.ForgotPassword(req.Tenant, req.Email, c.ClientIP()); err != nil {
+		if respondLocked(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to send password reset email",
+		})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "if the account exists, a password reset link will be sent",
+	})
+}
+
+// ResetPassword handles POST /auth/password/reset
+// Sets a new password with a token from /auth/password/forgot and signs the
+// user out everywhere.
+func (h *PasswordHandler) ResetPassword(c *gin.Context) {
+	var req ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid request: token and new_password are required",
+		})
+		return
+	}
+
+	if err := h.passwordService.ResetPassword(req.Token, req.NewPassword); err != nil {
+		respondPasswordError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "password reset; all sessions have been signed out",
+	})
+}
+
+// respondPasswordError maps PasswordService errors to HTTP responses.
+func respondPasswordError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	var policyErr *service.PasswordPolicyError
+	switch {
+	case errors.As(err, &policyErr), err == service.ErrResetTokenInvalid:
+		status = http.StatusBadRequest
+	case err == service.ErrInvalidCredentials:
+		status = http.StatusUnauthorized
+	case err == service.ErrUserNotFound:
+		status = http.StatusNotFound
+	}
+	c.JSON(status, gin.H{
+		"error": err.Error(),
+	})
+}
@@ -0,0 +1,130 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/cachatto/master-slave-server/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+// RegistrationHandler handles self-service sign-up endpoints.
+type RegistrationHandler struct {
+	registrationService *service.RegistrationService
+}
+
+// NewRegistrationHandler creates a new RegistrationHandler.
+func NewRegistrationHandler(registrationService *service.RegistrationService) *RegistrationHandler {
+	return &RegistrationHandler{registrationService: registrationService}
+}
+
+// RegisterRequest is the expected JSON body for POST /auth/register.
+// Tenant is the slug of the organization to join; omitted, it is the default
+// tenant.
+type RegisterRequest struct {
+	Tenant   string `json:"tenant"`
+	Email    string `json:"email" binding:"required,email,max=255"`
+	Password string `json:"password" binding:"required"`
+}
+
+// ResendVerificationRequest is the expected JSON body for
+// POST /auth/verify-email/resend.
+type ResendVerificationRequest struct {
+	Tenant string `json:"tenant"`
+	Email  string `json:"email" binding:"required,email"`
+}
+
+// Register handles POST /auth/register
+// Creates an account and emails a verification link. Responds 202 whether
+// or not the email was already registered, so accounts cannot be enumerated,
+// 400 if the tenant does not exist, and 429 with Retry-After once the
+// client IP or email has made too many requests.
+func (h *RegistrationHandler) Register(c *gin.Context) {
+	var req RegisterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid request: a valid email and a password are required",
+		})
+		return
+	}
+
+	if err := h.registrationService.Register(req.Tenant, req.Email, req.Password, c.ClientIP()); err != nil {
+		if respondLocked(c, err) {
+			return
+		}
+		var policyErr *service.PasswordPolicyError
+		if errors.As(err, &policyErr) || err == service.ErrTenantNotFound {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to register",
+		})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "check your email to verify your address",
+	})
+}
+
+// VerifyEmail handles GET /auth/verify-email?token=...
+// This is the link sent by Register; it marks the email address as verified.
+func (h *RegistrationHandler) VerifyEmail(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "token is required",
+		})
+		return
+	}
+
+	if err := h.registrationService.VerifyEmail(token); err != nil {
+		status := http.StatusInternalServerError
+		switch err {
+		case service.ErrInvalidToken, service.ErrInvalidTokenType:
+			status = http.StatusBadRequest
+		case service.ErrUserNotFound:
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "email address verified",
+	})
+}
+
+// ResendVerification handles POST /auth/verify-email/resend
+// Emails a new verification link to an unverified account. Responds 202
+// whether or not the account exists, so accounts cannot be enumerated, and
+// 429 with Retry-After once the client IP or email has made too many
+// requests.
+func (h *RegistrationHandler) ResendVerification(c *gin.Context) {
+	var req ResendVerificationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid request: a valid email is required",
+		})
+		return
+	}
+
+	if err := h.registrationService.ResendVerification(req.Tenant, req.Email, c.ClientIP()); err != nil {
+		if respondLocked(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to send verification email",
+		})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "if the account exists and is unverified, a new link has been sent",
+	})
+}
@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/cachatto/master-slave-server/internal/limiter"
+	"github.com/cachatto/master-slave-server/internal/service"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// currentUserID returns the authenticated user's ID set by the JWT
+// middleware, writing a 401 and returning false if it is missing.
+func currentUserID(c *gin.Context) (uuid.UUID, bool) {
+	userIDVal, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "user not authenticated",
+		})
+		return uuid.Nil, false
+	}
+	return userIDVal.(uuid.UUID), true
+}
+
+// currentSessionID returns the session (refresh token family) of the access
+// token set by the JWT middleware, writing a 401 and returning false if it
+// is missing.
+func currentSessionID(c *gin.Context) (uuid.UUID, bool) {
+	sessionIDVal, exists := c.Get("sessionID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "user not authenticated",
+		})
+		return uuid.Nil, false
+	}
+	return sessionIDVal.(uuid.UUID), true
+}
+
+// currentActor returns the authenticated user with their role and tenant set
+// by the JWT middleware, writing a 401 and returning false if they are
+// missing.
+func currentActor(c *gin.Context) (service.Actor, bool) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return service.Actor{}, false
+	}
+	return service.Actor{
+		UserID:   userID,
+		Role:     c.GetString("role"),
+		TenantID: c.MustGet("tenantID").(uuid.UUID),
+	}, true
+}
+
+// Pagination defaults for admin list endpoints.
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// pagination reads the 1-based "page" and "page_size" query parameters,
+// writing a 400 and returning false if they are invalid.
+func pagination(c *gin.Context) (page, pageSize int, ok bool) {
+	page, pageSize = 1, defaultPageSize
+	var err error
+	if raw := c.Query("page"); raw != "" {
+		if page, err = strconv.Atoi(raw); err != nil || page < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "page must be a positive integer",
+			})
+			return 0, 0, false
+		}
+	}
+	if raw := c.Query("page_size"); raw != "" {
+		if pageSize, err = strconv.Atoi(raw); err != nil || pageSize < 1 || pageSize > maxPageSize {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "page_size must be between 1 and " + strconv.Itoa(maxPageSize),
+			})
+			return 0, 0, false
+		}
+	}
+	return page, pageSize, true
+}
+
+// respondLocked writes a 429 with Retry-After if err is a lockout and
+// reports whether it did.
+func respondLocked(c *gin.Context, err error) bool {
+	var locked *limiter.LockedError
+	if !errors.As(err, &locked) {
+		return false
+	}
+
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(locked.RetryAfter.Seconds()))))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error": err.Error(),
+	})
+	return true
+}
+
+// unauthorizedStatus returns 401 for the errors that reject the caller's
+// credentials, code or token, and 500 for any other error. A database
+// failure must not look like a rejected token: clients discard tokens and
+// sign out on 401.
+func unauthorizedStatus(err error) int {
+	switch err {
+	case service.ErrInvalidCredentials, service.ErrInvalidToken, service.ErrInvalidTokenType,
+		service.ErrTokenReused, service.ErrSessionRevoked, service.ErrUserNotFound,
+		service.ErrUserDisabled, service.ErrNoPermission, service.ErrMFANotPending,
+		service.ErrInvalidMFACode, service.ErrCodeExpired, service.ErrInvalidCodeVerifier:
+		return http.StatusUnauthorized
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,186 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/cachatto/master-slave-server/internal/service"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// WebAuthnHandler handles passkey registration and login endpoints.
+type WebAuthnHandler struct {
+	webauthnService *service.WebAuthnService
+}
+
+// NewWebAuthnHandler creates a new WebAuthnHandler.
+func NewWebAuthnHandler(webauthnService *service.WebAuthnService) *WebAuthnHandler {
+	return &WebAuthnHandler{webauthnService: webauthnService}
+}
+
+// WebAuthnRegisterRequest is the expected JSON body for
+// POST /auth/webauthn/register/finish. Credential is the
+// PublicKeyCredential returned by navigator.credentials.create().
+type WebAuthnRegisterRequest struct {
+	SessionID  uuid.UUID       `json:"session_id" binding:"required"`
+	Name       string          `json:"name" binding:"max=255"`
+	Credential json.RawMessage `json:"credential" binding:"required"`
+}
+
+// WebAuthnLoginRequest is the expected JSON body for
+// POST /auth/webauthn/login/finish. Credential is the
+// PublicKeyCredential returned by navigator.credentials.get().
+type WebAuthnLoginRequest struct {
+	SessionID  uuid.UUID       `json:"session_id" binding:"required"`
+	Credential json.RawMessage `json:"credential" binding:"required"`
+}
+
+// BeginRegistration handles POST /auth/webauthn/register/begin
+// Requires a valid access token (via JWT middleware).
+// Returns the creation options for navigator.credentials.create().
+func (h *WebAuthnHandler) BeginRegistration(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	challenge, err := h.webauthnService.BeginRegistration(userID)
+	if err != nil {
+		respondWebAuthnError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, challenge)
+}
+
+// FinishRegistration handles POST /auth/webauthn/register/finish
+// Requires a valid access token (via JWT middleware).
+// Verifies the authenticator's response and stores the passkey.
+func (h *WebAuthnHandler) FinishRegistration(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req WebAuthnRegisterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid request: session_id and credential are required",
+		})
+		return
+	}
+
+	cred, err := h.webauthnService.FinishRegistration(userID, req.SessionID, req.Name, req.Credential)
+	if err != nil {
+		respondWebAuthnError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":    "passkey registered",
+		"credential": cred,
+	})
+}
+
+// ListCredentials handles GET /auth/webauthn/credentials
+// Requires a valid access token (via JWT middleware).
+// Returns the user's registered passkeys.
+func (h *WebAuthnHandler) ListCredentials(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	creds, err := h.webauthnService.ListCredentials(userID)
+	if err != nil {
+		respondWebAuthnError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"credentials": creds,
+	})
+}
+
+// DeleteCredential handles DELETE /auth/webauthn/credentials/:id
+// Requires a valid access token (via JWT middleware).
+// Removes one of the user's passkeys.
+func (h *WebAuthnHandler) DeleteCredential(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	credentialID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid credential id",
+		})
+		return
+	}
+
+	if err := h.webauthnService.DeleteCredential(userID, credentialID); err != nil {
+		respondWebAuthnError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "passkey removed",
+	})
+}
+
+// BeginLogin handles POST /auth/webauthn/login/begin
+// Returns the request options for navigator.credentials.get().
+func (h *WebAuthnHandler) BeginLogin(c *gin.Context) {
+	challenge, err := h.webauthnService.BeginLogin()
+	if err != nil {
+		respondWebAuthnError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, challenge)
+}
+
+// FinishLogin handles POST /auth/webauthn/login/finish
+// Verifies the authenticator's assertion and returns an access + refresh
+// token pair, exactly like /auth/login.
+func (h *WebAuthnHandler) FinishLogin(c *gin.Context) {
+	var req WebAuthnLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid request: session_id and credential are required",
+		})
+		return
+	}
+
+	tokens, err := h.webauthnService.FinishLogin(req.SessionID, req.Credential)
+	if err != nil {
+		respondWebAuthnError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "login successful",
+		"access_token":  tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+	})
+}
+
+// respondWebAuthnError maps WebAuthnService errors to HTTP responses.
+func respondWebAuthnError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch err {
+	case service.ErrPasskeyInvalid, service.ErrPasskeyCloned:
+		status = http.StatusUnauthorized
+	case service.ErrWebAuthnSessionInvalid:
+		status = http.StatusBadRequest
+	case service.ErrUserDisabled:
+		status = http.StatusForbidden
+	case service.ErrPasskeyNotFound, service.ErrUserNotFound:
+		status = http.StatusNotFound
+	}
+	c.JSON(status, gin.H{
+		"error": err.Error(),
+	})
+}
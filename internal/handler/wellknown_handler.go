@@ -0,0 +1,33 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/cachatto/master-slave-server/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+// WellKnownHandler serves public discovery documents under /.well-known.
+type WellKnownHandler struct {
+	keys        *service.KeySet
+	oidcService *service.OIDCService
+}
+
+// NewWellKnownHandler creates a new WellKnownHandler.
+func NewWellKnownHandler(keys *service.KeySet, oidcService *service.OIDCService) *WellKnownHandler {
+	return &WellKnownHandler{keys: keys, oidcService: oidcService}
+}
+
+// JWKS handles GET /.well-known/jwks.json
+// Returns the public keys slave backends use to verify tokens offline.
+func (h *WellKnownHandler) JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, h.keys.JWKS())
+}
+
+// OpenIDConfiguration handles GET /.well-known/openid-configuration
+// Returns the OpenID Connect provider metadata.
+func (h *WellKnownHandler) OpenIDConfiguration(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, h.oidcService.Discovery())
+}
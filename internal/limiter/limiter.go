@@ -0,0 +1,54 @@
+package limiter
+
+import (
+	"fmt"
+	"time"
+)
+
+// Limiter tracks failed attempts per key (e.g. a client IP or a package ID)
+// and locks a key out with exponential backoff once it exceeds its budget.
+type Limiter interface {
+	// Check returns how long key is still locked out, or 0 if it is not.
+	Check(key string) (time.Duration, error)
+	// Fail records a failed attempt for key and returns the lockout it triggered, if any.
+	Fail(key string) (time.Duration, error)
+	// Reset clears the failure history of key.
+	Reset(key string) error
+	// Cleanup drops state for keys that are neither locked nor within the failure window.
+	Cleanup() error
+}
+
+// Policy configures when and for how long a key is locked out.
+type Policy struct {
+	MaxFailures int           // failures allowed within Window before lockouts start
+	BaseLockout time.Duration // lockout after the first failure over MaxFailures
+	MaxLockout  time.Duration // upper bound for the doubling lockout
+	Window      time.Duration // failure counters reset after this long without a failure
+}
+
+// Lockout returns the lockout for a key that has failed `failures` times:
+// zero up to MaxFailures, then BaseLockout doubling with each further failure.
+func (p Policy) Lockout(failures int) time.Duration {
+	over := failures - p.MaxFailures
+	if over <= 0 {
+		return 0
+	}
+
+	lockout := p.BaseLockout
+	for i := 1; i < over; i++ {
+		lockout *= 2
+		if lockout >= p.MaxLockout {
+			return p.MaxLockout
+		}
+	}
+	return min(lockout, p.MaxLockout)
+}
+
+// LockedError is returned when a key is locked out.
+type LockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("too many failed attempts, retry after %s", e.RetryAfter.Round(time.Second))
+}
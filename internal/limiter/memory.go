@@ -0,0 +1,84 @@
+package limiter
+
+import (
+	"sync"
+	"time"
+)
+
+// MemoryLimiter is an in-process Limiter. Its state is not shared between
+// server instances; use PostgresLimiter for multi-instance deployments.
+type MemoryLimiter struct {
+	policy  Policy
+	mu      sync.Mutex
+	entries map[string]*memoryEntry
+}
+
+type memoryEntry struct {
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+// NewMemoryLimiter creates a new MemoryLimiter.
+func NewMemoryLimiter(policy Policy) *MemoryLimiter {
+	return &MemoryLimiter{
+		policy:  policy,
+		entries: make(map[string]*memoryEntry),
+	}
+}
+
+// Check returns how long key is still locked out.
+func (l *MemoryLimiter) Check(key string) (time.Duration, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry, ok := l.entries[key]
+	if !ok {
+		return 0, nil
+	}
+	return max(time.Until(entry.lockedUntil), 0), nil
+}
+
+// Fail records a failed attempt for key.
+func (l *MemoryLimiter) Fail(key string) (time.Duration, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	entry, ok := l.entries[key]
+	if !ok || now.Sub(entry.lastFailure) > l.policy.Window {
+		entry = &memoryEntry{}
+		l.entries[key] = entry
+	}
+
+	entry.failures++
+	entry.lastFailure = now
+	lockout := l.policy.Lockout(entry.failures)
+	if lockout > 0 {
+		entry.lockedUntil = now.Add(lockout)
+	}
+	return lockout, nil
+}
+
+// Reset clears the failure history of key.
+func (l *MemoryLimiter) Reset(key string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.entries, key)
+	return nil
+}
+
+// Cleanup drops expired entries.
+func (l *MemoryLimiter) Cleanup() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	for key, entry := range l.entries {
+		if now.After(entry.lockedUntil) && now.Sub(entry.lastFailure) > l.policy.Window {
+			delete(l.entries, key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package limiter
+
+import (
+	"time"
+
+	"github.com/cachatto/master-slave-server/internal/repository"
+)
+
+// PostgresLimiter is a Limiter whose counters live in the auth_attempts
+// table, so lockouts apply across all server instances.
+type PostgresLimiter struct {
+	policy Policy
+	scope  string
+	repo   *repository.AttemptRepository
+}
+
+// NewPostgresLimiter creates a new PostgresLimiter. Keys are namespaced by
+// scope so several limiters can share the table.
+func NewPostgresLimiter(repo *repository.AttemptRepository, scope string, policy Policy) *PostgresLimiter {
+	return &PostgresLimiter{
+		policy: policy,
+		scope:  scope,
+		repo:   repo,
+	}
+}
+
+// Check returns how long key is still locked out.
+func (l *PostgresLimiter) Check(key string) (time.Duration, error) {
+	lockedUntil, err := l.repo.LockedUntil(l.key(key))
+	if err != nil {
+		return 0, err
+	}
+	return max(time.Until(lockedUntil), 0), nil
+}
+
+// Fail records a failed attempt for key.
+func (l *PostgresLimiter) Fail(key string) (time.Duration, error) {
+	failures, err := l.repo.RecordFailure(l.key(key), l.policy.Window)
+	if err != nil {
+		return 0, err
+	}
+
+	lockout := l.policy.Lockout(failures)
+	if lockout > 0 {
+		if err := l.repo.Lock(l.key(key), time.Now().Add(lockout)); err != nil {
+			return 0, err
+		}
+	}
+	return lockout, nil
+}
+
+// Reset clears the failure history of key.
+func (l *PostgresLimiter) Reset(key string) error {
+	return l.repo.Delete(l.key(key))
+}
+
+// Cleanup drops expired rows of this limiter's scope.
+func (l *PostgresLimiter) Cleanup() error {
+	return l.repo.CleanExpired(l.scope+":", l.policy.Window)
+}
+
+func (l *PostgresLimiter) key(key string) string {
+	return l.scope + ":" + key
+}
@@ -0,0 +1,51 @@
+package mail
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// FileSender writes each email to its own file in a directory, so local
+// development setups and tests can read the messages that were sent.
+type FileSender struct {
+	from string
+	dir  string
+}
+
+// NewFileSender creates a new FileSender writing to dir, creating it if needed.
+func NewFileSender(from, dir string) (*FileSender, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &FileSender{from: from, dir: dir}, nil
+}
+
+// Send writes msg to <dir>/<timestamp>-<random>.eml.
+func (s *FileSender) Send(msg *Message) error {
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405.000000000"), uuid.NewString())
+	return os.WriteFile(filepath.Join(s.dir, name), []byte(format(s.from, msg)), 0o600)
+}
+
+// format renders msg as a minimal RFC 5322 message.
+func format(from string, msg *Message) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", headerValue(from))
+	fmt.Fprintf(&b, "To: %s\r\n", headerValue(msg.To))
+	fmt.Fprintf(&b, "Subject: %s\r\n", headerValue(msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return b.String()
+}
+
+// headerValue strips line breaks so a value cannot inject extra headers.
+func headerValue(v string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(v)
+}
@@ -0,0 +1,18 @@
+package mail
+
+import "log"
+
+// LogSender writes emails to the server log instead of sending them.
+// Intended for local development only: the log then contains live links.
+type LogSender struct{}
+
+// NewLogSender creates a new LogSender.
+func NewLogSender() *LogSender {
+	return &LogSender{}
+}
+
+// Send logs msg.
+func (s *LogSender) Send(msg *Message) error {
+	log.Printf("📧 Mail to %s: %s\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
@@ -0,0 +1,34 @@
+package mail
+
+import (
+	"net"
+	"net/smtp"
+	"strconv"
+)
+
+// SMTPSender delivers email through an SMTP relay. net/smtp upgrades the
+// connection with STARTTLS when the server offers it, and refuses to send
+// credentials over an unencrypted connection to a remote host.
+type SMTPSender struct {
+	from string
+	addr string
+	auth smtp.Auth
+}
+
+// NewSMTPSender creates a new SMTPSender. Authentication is skipped when
+// username is empty.
+func NewSMTPSender(from, host string, port int, username, password string) *SMTPSender {
+	s := &SMTPSender{
+		from: from,
+		addr: net.JoinHostPort(host, strconv.Itoa(port)),
+	}
+	if username != "" {
+		s.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return s
+}
+
+// Send delivers msg.
+func (s *SMTPSender) Send(msg *Message) error {
+	return smtp.SendMail(s.addr, s.auth, s.from, []string{msg.To}, []byte(format(s.from, msg)))
+}
@@ -10,8 +10,10 @@ import (
 
 // JWTAuth returns a Gin middleware that validates JWT access tokens.
 // It extracts the token from the Authorization header (Bearer <token>),
-// validates it, and sets "userID" and "email" in the Gin context.
-func JWTAuth(authService *service.AuthService) gin.HandlerFunc {
+// validates it for the expected audience (service.MasterAudience for Master
+// app routes, or a slave app's package ID), and sets "userID", "tenantID",
+// "email", "sessionID" and "role" in the Gin context.
+func JWTAuth(authService *service.AuthService, audience string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -32,7 +34,7 @@ func JWTAuth(authService *service.AuthService) gin.HandlerFunc {
 
 		tokenString := parts[1]
 
-		claims, err := authService.ParseAccessToken(tokenString)
+		claims, err := authService.ParseAccessToken(tokenString, audience)
 		if err != nil {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
 				"error": "invalid or expired token",
@@ -42,7 +44,10 @@ func JWTAuth(authService *service.AuthService) gin.HandlerFunc {
 
 		// Set user info in the context for downstream handlers
 		c.Set("userID", claims.UserID)
+		c.Set("tenantID", claims.TenantID)
 		c.Set("email", claims.Email)
+		c.Set("sessionID", claims.SessionID)
+		c.Set("role", claims.Role)
 
 		c.Next()
 	}
@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/cachatto/master-slave-server/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+// RequireRole returns a Gin middleware that only lets through users whose
+// role is one of roles. It must run after JWTAuth.
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !slices.Contains(roles, c.GetString("role")) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": "insufficient role",
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequirePermission returns a Gin middleware that only lets through users
+// whose role grants perm. It must run after JWTAuth.
+func RequirePermission(perm service.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !service.RoleHasPermission(c.GetString("role"), perm) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": "missing permission: " + string(perm),
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -1,29 +1,63 @@
 package models
 
 import (
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
+// Tenant is an organization with its own users, apps and groups, so that
+// several customers can share one server.
+type Tenant struct {
+	ID        uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	Name      string    `gorm:"not null;size:255" json:"name"`
+	Slug      string    `gorm:"uniqueIndex;not null;size:63" json:"slug"` // named by clients at sign-in
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TableName overrides the default table name.
+func (Tenant) TableName() string {
+	return "tenants"
+}
+
 // User represents a registered user in the system.
 type User struct {
-	ID           uuid.UUID      `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
-	Email        string         `gorm:"uniqueIndex;not null;size:255" json:"email"`
-	PasswordHash string         `gorm:"not null" json:"-"`
-	CreatedAt    time.Time      `json:"created_at"`
-	UpdatedAt    time.Time      `json:"updated_at"`
-	DeletedAt    gorm.DeletedAt `gorm:"index" json:"-"`
+	ID                uuid.UUID      `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	TenantID          uuid.UUID      `gorm:"type:uuid;not null;uniqueIndex:idx_users_tenant_email,priority:1" json:"tenant_id"`
+	Email             string         `gorm:"not null;size:255;uniqueIndex:idx_users_tenant_email,priority:2" json:"email"` // unique within the tenant
+	PasswordHash      string         `gorm:"not null" json:"-"`
+	Role              string         `gorm:"size:32;not null;default:'user'" json:"role"` // "superadmin", "tenant-admin", "app-admin" or "user"
+	EmailVerifiedAt   *time.Time     `json:"email_verified_at,omitempty"`
+	FailedLoginCount  int            `gorm:"not null;default:0" json:"failed_login_count"`
+	LastFailedLoginAt *time.Time     `json:"last_failed_login_at,omitempty"`
+	LockedUntil       *time.Time     `json:"locked_until,omitempty"`
+	TOTPSecret        string         `gorm:"column:totp_secret;size:64;not null;default:''" json:"-"`
+	TOTPEnabledAt     *time.Time     `gorm:"column:totp_enabled_at" json:"totp_enabled_at,omitempty"`
+	TOTPLastStep      int64          `gorm:"column:totp_last_step;not null;default:0" json:"-"` // last accepted TOTP time step (replay guard)
+	DisabledAt        *time.Time     `json:"disabled_at,omitempty"`                             // set by an admin; blocks login and token issuance
+	CreatedAt         time.Time      `json:"created_at"`
+	UpdatedAt         time.Time      `json:"updated_at"`
+	DeletedAt         gorm.DeletedAt `gorm:"index" json:"deleted_at"`
+	Tenant            *Tenant        `gorm:"foreignKey:TenantID" json:"-"`
 }
 
 // App represents a registered application (Slave app) in the system.
 type App struct {
-	ID             uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
-	AppName        string    `gorm:"not null;size:255" json:"app_name"`
-	PackageID      string    `gorm:"uniqueIndex;not null;size:255" json:"package_id"`
-	DeepLinkScheme string    `gorm:"not null;size:255" json:"deep_link_scheme"`
-	CreatedAt      time.Time `json:"created_at"`
+	ID             uuid.UUID  `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	TenantID       uuid.UUID  `gorm:"type:uuid;not null;index" json:"tenant_id"`
+	AppName        string     `gorm:"not null;size:255" json:"app_name"`
+	PackageID      string     `gorm:"uniqueIndex;not null;size:255" json:"package_id"` // unique across tenants: slave apps claim codes by package ID
+	DeepLinkScheme string     `gorm:"not null;size:255" json:"deep_link_scheme"`
+	RedirectURIs   string     `gorm:"type:text;not null;default:''" json:"redirect_uris"` // space-separated OIDC redirect URIs
+	RequirePKCE    bool       `gorm:"not null;default:false" json:"require_pkce"`         // OTC claims must present a code_verifier
+	OwnerID        *uuid.UUID `gorm:"type:uuid;index" json:"owner_id,omitempty"`          // app-admin who manages the app
+	Scopes         string     `gorm:"type:text;not null;default:''" json:"scopes"`        // space-separated scopes that can be granted to users
+	CreatedAt      time.Time  `json:"created_at"`
+	Owner          *User      `gorm:"foreignKey:OwnerID;constraint:OnDelete:SET NULL" json:"-"`
+	Tenant         *Tenant    `gorm:"foreignKey:TenantID" json:"-"`
 }
 
 // TableName overrides the default table name for App.
@@ -31,13 +65,27 @@ func (App) TableName() string {
 	return "app_registry"
 }
 
+// RedirectURIList returns the app's registered OIDC redirect URIs.
+func (a *App) RedirectURIList() []string {
+	return strings.Fields(a.RedirectURIs)
+}
+
+// ScopeList returns the scopes the app declares.
+func (a *App) ScopeList() []string {
+	return strings.Fields(a.Scopes)
+}
+
 // UserAppPermission links a user to a slave app they are authorized to use.
 type UserAppPermission struct {
-	ID     uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
-	UserID uuid.UUID `gorm:"type:uuid;not null;index" json:"user_id"`
-	AppID  uuid.UUID `gorm:"type:uuid;not null;index" json:"app_id"`
-	User   User      `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
-	App    App       `gorm:"foreignKey:AppID;constraint:OnDelete:CASCADE" json:"-"`
+	ID         uuid.UUID  `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	UserID     uuid.UUID  `gorm:"type:uuid;not null;index;uniqueIndex:idx_user_app_permissions_user_app" json:"user_id"`
+	AppID      uuid.UUID  `gorm:"type:uuid;not null;index;uniqueIndex:idx_user_app_permissions_user_app" json:"app_id"`
+	Scopes     string     `gorm:"type:text;not null;default:''" json:"scopes"` // space-separated subset of the app's scopes
+	ValidFrom  *time.Time `json:"valid_from,omitempty"`                        // start of the grant; nil: permitted immediately
+	ValidUntil *time.Time `gorm:"index" json:"valid_until,omitempty"`          // end of the grant (exclusive); nil: never expires
+	ExpiredAt  *time.Time `json:"-"`                                           // set by the expiry job once ValidUntil has passed
+	User       User       `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+	App        App        `gorm:"foreignKey:AppID;constraint:OnDelete:CASCADE" json:"-"`
 }
 
 // TableName overrides the default table name.
@@ -45,19 +93,268 @@ func (UserAppPermission) TableName() string {
 	return "user_app_permissions"
 }
 
+// ScopeList returns the granted scopes.
+func (p *UserAppPermission) ScopeList() []string {
+	return strings.Fields(p.Scopes)
+}
+
+// Grant event types.
+const (
+	GrantEventExpired = "expired" // the grant's validity window ended and its access was revoked
+)
+
+// GrantEvent records a change to a direct grant made by the server itself,
+// such as the expiry of a time-bounded grant. Events are history: they keep
+// the IDs of the grant, user and app after those are deleted.
+type GrantEvent struct {
+	ID           uuid.UUID  `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	Event        string     `gorm:"not null;size:20" json:"event"`
+	PermissionID uuid.UUID  `gorm:"type:uuid;not null" json:"permission_id"`
+	UserID       uuid.UUID  `gorm:"type:uuid;not null;index" json:"user_id"`
+	AppID        uuid.UUID  `gorm:"type:uuid;not null;index" json:"app_id"`
+	Scopes       string     `gorm:"type:text;not null;default:''" json:"scopes"` // the grant's scopes when the event happened
+	ValidFrom    *time.Time `json:"valid_from,omitempty"`
+	ValidUntil   *time.Time `json:"valid_until,omitempty"`
+	CreatedAt    time.Time  `gorm:"index" json:"created_at"`
+}
+
+// TableName overrides the default table name.
+func (GrantEvent) TableName() string {
+	return "grant_events"
+}
+
+// Group is a named set of users that can be granted apps together.
+type Group struct {
+	ID          uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	TenantID    uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_user_groups_tenant_name,priority:1" json:"tenant_id"`
+	Name        string    `gorm:"not null;size:255;uniqueIndex:idx_user_groups_tenant_name,priority:2" json:"name"` // unique within the tenant
+	Description string    `gorm:"type:text;not null;default:''" json:"description"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	Tenant      *Tenant   `gorm:"foreignKey:TenantID" json:"-"`
+}
+
+// TableName overrides the default table name.
+func (Group) TableName() string {
+	return "user_groups"
+}
+
+// GroupMember links a user to a group they belong to.
+type GroupMember struct {
+	ID        uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	GroupID   uuid.UUID `gorm:"type:uuid;not null;index;uniqueIndex:idx_group_members_group_user" json:"group_id"`
+	UserID    uuid.UUID `gorm:"type:uuid;not null;index;uniqueIndex:idx_group_members_group_user" json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+	Group     Group     `gorm:"foreignKey:GroupID;constraint:OnDelete:CASCADE" json:"-"`
+	User      User      `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+// TableName overrides the default table name.
+func (GroupMember) TableName() string {
+	return "group_members"
+}
+
+// GroupAppPermission grants every member of a group the use of a slave app.
+type GroupAppPermission struct {
+	ID      uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	GroupID uuid.UUID `gorm:"type:uuid;not null;index;uniqueIndex:idx_group_app_permissions_group_app" json:"group_id"`
+	AppID   uuid.UUID `gorm:"type:uuid;not null;index;uniqueIndex:idx_group_app_permissions_group_app" json:"app_id"`
+	Scopes  string    `gorm:"type:text;not null;default:''" json:"scopes"` // space-separated subset of the app's scopes
+	Group   Group     `gorm:"foreignKey:GroupID;constraint:OnDelete:CASCADE" json:"-"`
+	App     App       `gorm:"foreignKey:AppID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+// TableName overrides the default table name.
+func (GroupAppPermission) TableName() string {
+	return "group_app_permissions"
+}
+
+// ScopeList returns the granted scopes.
+func (p *GroupAppPermission) ScopeList() []string {
+	return strings.Fields(p.Scopes)
+}
+
+// Access request statuses. A request is filed as pending and decided once.
+const (
+	AccessRequestPending  = "pending"
+	AccessRequestApproved = "approved"
+	AccessRequestDenied   = "denied"
+)
+
+// AccessRequest is a user's request to be permitted to use a slave app.
+// Decided requests are kept as the history of the app's access decisions,
+// also once the app is deleted.
+type AccessRequest struct {
+	ID        uuid.UUID  `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	UserID    uuid.UUID  `gorm:"type:uuid;not null;index;uniqueIndex:idx_access_requests_pending,where:status = 'pending'" json:"user_id"`
+	AppID     *uuid.UUID `gorm:"type:uuid;index;uniqueIndex:idx_access_requests_pending" json:"app_id"` // one pending request per user and app; nil once the app is deleted
+	PackageID string     `gorm:"not null;size:255;default:''" json:"package_id"`                        // the app's package ID, kept after the app is deleted
+	Scopes    string     `gorm:"type:text;not null;default:''" json:"scopes"`                           // space-separated scopes the user asks for
+	Reason    string     `gorm:"type:text;not null;default:''" json:"reason"`
+	Status    string     `gorm:"not null;size:20;default:'pending';index" json:"status"`
+	DecidedBy *uuid.UUID `gorm:"type:uuid" json:"decided_by,omitempty"` // the admin who approved or denied the request
+	DecidedAt *time.Time `json:"decided_at,omitempty"`
+	Note      string     `gorm:"type:text;not null;default:''" json:"note"` // the admin's comment on the decision
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	User      *User      `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"user,omitempty"`
+	App       *App       `gorm:"foreignKey:AppID;constraint:OnDelete:SET NULL" json:"app,omitempty"`
+	Decider   *User      `gorm:"foreignKey:DecidedBy;constraint:OnDelete:SET NULL" json:"-"`
+}
+
+// TableName overrides the default table name.
+func (AccessRequest) TableName() string {
+	return "access_requests"
+}
+
+// ScopeList returns the requested scopes.
+func (r *AccessRequest) ScopeList() []string {
+	return strings.Fields(r.Scopes)
+}
+
 // OneTimeCode represents a short-lived code for the OTC handshake.
 type OneTimeCode struct {
+	ID            uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	UserID        uuid.UUID `gorm:"type:uuid;not null;index" json:"user_id"`
+	AppID         uuid.UUID `gorm:"type:uuid;not null" json:"app_id"`
+	CodeHash      string    `gorm:"uniqueIndex;not null;size:64" json:"-"`  // HMAC-SHA256 of the code, keyed with OTC_PEPPER
+	CodeChallenge string    `gorm:"size:128;not null;default:''" json:"-"`  // S256 PKCE challenge from the slave app, if any
+	Scopes        string    `gorm:"type:text;not null;default:''" json:"-"` // space-separated scopes requested by the Master app
+	ExpiresAt     time.Time `gorm:"not null" json:"expires_at"`
+	Claimed       bool      `gorm:"default:false" json:"claimed"`
+	User          User      `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+	App           App       `gorm:"foreignKey:AppID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+// TableName overrides the default table name.
+func (OneTimeCode) TableName() string {
+	return "one_time_codes"
+}
+
+// RefreshToken records an issued refresh token (keyed by its jti) so it can be
+// rotated on use and revoked as part of a token family.
+type RefreshToken struct {
+	ID        uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	FamilyID  uuid.UUID  `gorm:"type:uuid;not null;index" json:"family_id"`
+	UserID    uuid.UUID  `gorm:"type:uuid;not null;index" json:"user_id"`
+	AppID     *uuid.UUID `gorm:"type:uuid;index" json:"app_id,omitempty"`              // nil for Master app sessions
+	Scope     string     `gorm:"type:text;not null;default:''" json:"scope,omitempty"` // space-separated app scopes of the session
+	ExpiresAt time.Time  `gorm:"not null;index" json:"expires_at"`
+	RotatedAt *time.Time `json:"rotated_at,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	User      User       `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+	App       *App       `gorm:"foreignKey:AppID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+// TableName overrides the default table name.
+func (RefreshToken) TableName() string {
+	return "refresh_tokens"
+}
+
+// AuthorizationCode is a short-lived OIDC authorization code issued by
+// /oauth2/authorize and redeemed (with its PKCE verifier) at /oauth2/token.
+type AuthorizationCode struct {
+	ID            uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	CodeHash      string    `gorm:"uniqueIndex;not null;size:64" json:"-"` // HMAC-SHA256 of the code, keyed with OTC_PEPPER
+	UserID        uuid.UUID `gorm:"type:uuid;not null;index" json:"user_id"`
+	AppID         uuid.UUID `gorm:"type:uuid;not null" json:"app_id"`
+	RedirectURI   string    `gorm:"type:text;not null" json:"redirect_uri"`
+	Scope         string    `gorm:"type:text;not null" json:"scope"`
+	Nonce         string    `gorm:"size:255" json:"nonce"`
+	CodeChallenge string    `gorm:"size:128;not null" json:"code_challenge"`
+	AuthTime      time.Time `gorm:"not null" json:"auth_time"`
+	ExpiresAt     time.Time `gorm:"not null;index" json:"expires_at"`
+	Claimed       bool      `gorm:"default:false" json:"claimed"`
+	User          User      `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+	App           App       `gorm:"foreignKey:AppID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+// TableName overrides the default table name.
+func (AuthorizationCode) TableName() string {
+	return "oauth_authorization_codes"
+}
+
+// AuthAttempt holds the failed-attempt counter of one rate-limited key
+// (e.g. "claim-ip:203.0.113.7") for the Postgres-backed limiter.
+type AuthAttempt struct {
+	Key           string    `gorm:"primaryKey;size:255" json:"key"`
+	Failures      int       `gorm:"not null;default:0" json:"failures"`
+	LastFailureAt time.Time `gorm:"not null" json:"last_failure_at"`
+	LockedUntil   time.Time `gorm:"not null;index" json:"locked_until"`
+}
+
+// TableName overrides the default table name.
+func (AuthAttempt) TableName() string {
+	return "auth_attempts"
+}
+
+// RecoveryCode is a single-use MFA recovery code, stored as a keyed hash.
+type RecoveryCode struct {
+	ID        uuid.UUID  `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	UserID    uuid.UUID  `gorm:"type:uuid;not null;index" json:"user_id"`
+	CodeHash  string     `gorm:"not null;size:64" json:"-"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	User      User       `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+// TableName overrides the default table name.
+func (RecoveryCode) TableName() string {
+	return "mfa_recovery_codes"
+}
+
+// PasswordResetToken is a single-use token emailed by the forgot-password
+// flow, stored as a keyed hash like one-time codes.
+type PasswordResetToken struct {
 	ID        uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
 	UserID    uuid.UUID `gorm:"type:uuid;not null;index" json:"user_id"`
-	AppID     uuid.UUID `gorm:"type:uuid;not null" json:"app_id"`
-	Code      string    `gorm:"uniqueIndex;not null;size:32" json:"code"`
-	ExpiresAt time.Time `gorm:"not null" json:"expires_at"`
-	Claimed   bool      `gorm:"default:false" json:"claimed"`
+	TokenHash string    `gorm:"uniqueIndex;not null;size:64" json:"-"` // HMAC-SHA256 of the token, keyed with OTC_PEPPER
+	ExpiresAt time.Time `gorm:"not null;index" json:"expires_at"`
+	Used      bool      `gorm:"not null;default:false" json:"used"`
+	CreatedAt time.Time `json:"created_at"`
 	User      User      `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
-	App       App       `gorm:"foreignKey:AppID;constraint:OnDelete:CASCADE" json:"-"`
 }
 
 // TableName overrides the default table name.
-func (OneTimeCode) TableName() string {
-	return "one_time_codes"
+func (PasswordResetToken) TableName() string {
+	return "password_reset_tokens"
+}
+
+// WebAuthnCredential is a passkey registered by a user for WebAuthn login.
+type WebAuthnCredential struct {
+	ID              uuid.UUID  `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	UserID          uuid.UUID  `gorm:"type:uuid;not null;index" json:"user_id"`
+	Name            string     `gorm:"size:255;not null;default:''" json:"name"`
+	CredentialID    []byte     `gorm:"uniqueIndex;not null" json:"-"`
+	PublicKey       []byte     `gorm:"not null" json:"-"` // COSE-encoded public key
+	AttestationType string     `gorm:"size:32;not null;default:''" json:"-"`
+	Transports      string     `gorm:"size:255;not null;default:''" json:"transports"` // space-separated
+	AAGUID          []byte     `gorm:"column:aaguid" json:"-"`
+	SignCount       int64      `gorm:"not null;default:0" json:"-"` // last signature counter seen (clone detection)
+	BackupEligible  bool       `gorm:"not null;default:false" json:"backup_eligible"`
+	BackupState     bool       `gorm:"not null;default:false" json:"backup_state"`
+	LastUsedAt      *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	User            User       `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+// TableName overrides the default table name.
+func (WebAuthnCredential) TableName() string {
+	return "webauthn_credentials"
+}
+
+// WebAuthnSession holds the challenge of a WebAuthn ceremony between its
+// begin and finish requests. Each session can be finished only once.
+type WebAuthnSession struct {
+	ID        uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	Ceremony  string     `gorm:"size:16;not null" json:"ceremony"`         // "register" or "login"
+	UserID    *uuid.UUID `gorm:"type:uuid;index" json:"user_id,omitempty"` // nil for discoverable logins
+	Data      string     `gorm:"type:text;not null" json:"-"`              // JSON-encoded webauthn.SessionData
+	ExpiresAt time.Time  `gorm:"not null;index" json:"expires_at"`
+}
+
+// TableName overrides the default table name.
+func (WebAuthnSession) TableName() string {
+	return "webauthn_sessions"
 }
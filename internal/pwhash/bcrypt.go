@@ -0,0 +1,42 @@
+package pwhash
+
+import (
+	"errors"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Bcrypt hashes passwords with bcrypt in its modular crypt format
+// ($2a$<cost>$<salt+hash>). Only the first 72 bytes of a password are used.
+type Bcrypt struct {
+	Cost int
+}
+
+// Identifies reports whether encoded is a bcrypt hash.
+func (b *Bcrypt) Identifies(encoded string) bool {
+	return hasPrefix(encoded, "$2a$", "$2b$", "$2y$")
+}
+
+// Hash returns the bcrypt hash of password.
+func (b *Bcrypt) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), b.Cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// Verify reports whether password matches the bcrypt hash encoded.
+func (b *Bcrypt) Verify(encoded, password string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Outdated reports whether encoded was hashed with a different cost.
+func (b *Bcrypt) Outdated(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err != nil || cost != b.Cost
+}
@@ -0,0 +1,92 @@
+package pwhash
+
+import (
+	"errors"
+	"strings"
+	"sync"
+)
+
+// ErrUnknownFormat is returned when a stored hash was not produced by any
+// of the configured algorithms.
+var ErrUnknownFormat = errors.New("unknown password hash format")
+
+// Unusable is stored as the hash of accounts that have no password yet or
+// must reset it. No algorithm identifies it, so no password matches.
+const Unusable = "!"
+
+// Algorithm is a password hashing scheme with fixed cost parameters.
+type Algorithm interface {
+	// Identifies reports whether encoded was produced by this scheme.
+	Identifies(encoded string) bool
+	// Hash returns the encoded hash of password, including salt and parameters.
+	Hash(password string) (string, error)
+	// Verify reports whether password matches encoded.
+	Verify(encoded, password string) (bool, error)
+	// Outdated reports whether encoded uses weaker or different parameters
+	// than this Algorithm is configured with.
+	Outdated(encoded string) bool
+}
+
+// Hasher hashes new passwords with its current algorithm and verifies hashes
+// of the current or any legacy algorithm, reporting when a stored hash
+// should be upgraded.
+type Hasher struct {
+	current Algorithm
+	legacy  []Algorithm
+
+	dummyOnce sync.Once
+	dummyHash string // current-algorithm hash compared against by VerifyDummy
+}
+
+// NewHasher creates a new Hasher.
+func NewHasher(current Algorithm, legacy ...Algorithm) *Hasher {
+	return &Hasher{current: current, legacy: legacy}
+}
+
+// Hash hashes password with the current algorithm.
+func (h *Hasher) Hash(password string) (string, error) {
+	return h.current.Hash(password)
+}
+
+// Verify reports whether password matches encoded, and if so whether
+// encoded should be replaced by a fresh Hash because it uses a legacy
+// algorithm or outdated cost parameters.
+func (h *Hasher) Verify(encoded, password string) (ok, rehash bool, err error) {
+	if h.current.Identifies(encoded) {
+		ok, err = h.current.Verify(encoded, password)
+		return ok, ok && h.current.Outdated(encoded), err
+	}
+
+	for _, alg := range h.legacy {
+		if alg.Identifies(encoded) {
+			ok, err = alg.Verify(encoded, password)
+			return ok, ok, err
+		}
+	}
+
+	// Take as long as a mismatch so that accounts with an unusable hash
+	// cannot be told apart by timing
+	h.VerifyDummy(password)
+	return false, false, ErrUnknownFormat
+}
+
+// VerifyDummy verifies password against a fixed hash of the current
+// algorithm and discards the result. Callers with no stored hash to verify,
+// such as a login for an unknown email, use it to take as long as a real
+// verification.
+func (h *Hasher) VerifyDummy(password string) {
+	h.dummyOnce.Do(func() {
+		h.dummyHash, _ = h.current.Hash("dummy password")
+	})
+	_, _ = h.current.Verify(h.dummyHash, password)
+}
+
+// hasPrefix reports whether encoded starts with any of prefixes.
+func hasPrefix(encoded string, prefixes ...string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(encoded, p) {
+			return true
+		}
+	}
+	return false
+}
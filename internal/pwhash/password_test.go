@@ -0,0 +1,186 @@
+package pwhash
+
+import (
+	"errors"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Cheap parameters keep the tests fast; they are not meant for production.
+func testArgon2id() *Argon2id { return &Argon2id{Memory: 64, Iterations: 1, Parallelism: 1} }
+func testBcrypt() *Bcrypt     { return &Bcrypt{Cost: bcrypt.MinCost} }
+
+func TestAlgorithmRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		alg  Algorithm
+	}{
+		{"argon2id", testArgon2id()},
+		{"bcrypt", testBcrypt()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded, err := tt.alg.Hash("correct horse")
+			if err != nil {
+				t.Fatalf("Hash: %v", err)
+			}
+			if !tt.alg.Identifies(encoded) {
+				t.Errorf("Identifies(%q) = false", encoded)
+			}
+			if tt.alg.Outdated(encoded) {
+				t.Errorf("Outdated(%q) = true for a fresh hash", encoded)
+			}
+
+			for _, c := range []struct {
+				password string
+				want     bool
+			}{
+				{"correct horse", true},
+				{"Correct horse", false},
+				{"", false},
+			} {
+				ok, err := tt.alg.Verify(encoded, c.password)
+				if err != nil {
+					t.Errorf("Verify(%q): %v", c.password, err)
+				}
+				if ok != c.want {
+					t.Errorf("Verify(%q) = %v, want %v", c.password, ok, c.want)
+				}
+			}
+		})
+	}
+}
+
+func TestArgon2idSaltsEachHash(t *testing.T) {
+	a := testArgon2id()
+	first, _ := a.Hash("password")
+	second, _ := a.Hash("password")
+	if first == second {
+		t.Errorf("two hashes of the same password are identical: %q", first)
+	}
+}
+
+func TestDecodeArgon2idMalformed(t *testing.T) {
+	tests := []struct {
+		name    string
+		encoded string
+	}{
+		{"empty", ""},
+		{"bcrypt", "$2a$10$abcdefghijklmnopqrstuuABCDEFGHIJKLMNOPQRSTUVWXYZ01234"},
+		{"wrong algorithm", "$argon2i$v=19$m=64,t=1,p=1$c2FsdHNhbHQ$a2V5a2V5"},
+		{"missing hash", "$argon2id$v=19$m=64,t=1,p=1$c2FsdHNhbHQ"},
+		{"extra field", "$argon2id$v=19$m=64,t=1,p=1$c2FsdHNhbHQ$a2V5a2V5$x"},
+		{"wrong version", "$argon2id$v=16$m=64,t=1,p=1$c2FsdHNhbHQ$a2V5a2V5"},
+		{"bad version", "$argon2id$version$m=64,t=1,p=1$c2FsdHNhbHQ$a2V5a2V5"},
+		{"bad parameters", "$argon2id$v=19$m=64;t=1;p=1$c2FsdHNhbHQ$a2V5a2V5"},
+		{"zero iterations", "$argon2id$v=19$m=64,t=0,p=1$c2FsdHNhbHQ$a2V5a2V5"},
+		{"zero parallelism", "$argon2id$v=19$m=64,t=1,p=0$c2FsdHNhbHQ$a2V5a2V5"},
+		{"bad salt", "$argon2id$v=19$m=64,t=1,p=1$not*base64$a2V5a2V5"},
+		{"bad hash", "$argon2id$v=19$m=64,t=1,p=1$c2FsdHNhbHQ$not*base64"},
+		{"empty hash", "$argon2id$v=19$m=64,t=1,p=1$c2FsdHNhbHQ$"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := decodeArgon2id(tt.encoded); !errors.Is(err, ErrUnknownFormat) {
+				t.Errorf("decodeArgon2id(%q) error = %v, want ErrUnknownFormat", tt.encoded, err)
+			}
+			if ok, err := testArgon2id().Verify(tt.encoded, "password"); ok || err == nil {
+				t.Errorf("Verify(%q) = %v, %v, want false and an error", tt.encoded, ok, err)
+			}
+		})
+	}
+}
+
+func TestOutdated(t *testing.T) {
+	argon2Hash, err := testArgon2id().Hash("password")
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+	bcryptHash, err := testBcrypt().Hash("password")
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		alg     Algorithm
+		encoded string
+		want    bool
+	}{
+		{"argon2id same parameters", testArgon2id(), argon2Hash, false},
+		{"argon2id more memory", &Argon2id{Memory: 128, Iterations: 1, Parallelism: 1}, argon2Hash, true},
+		{"argon2id more iterations", &Argon2id{Memory: 64, Iterations: 2, Parallelism: 1}, argon2Hash, true},
+		{"argon2id more lanes", &Argon2id{Memory: 64, Iterations: 1, Parallelism: 2}, argon2Hash, true},
+		{"argon2id malformed", testArgon2id(), "$argon2id$garbage", true},
+		{"bcrypt same cost", testBcrypt(), bcryptHash, false},
+		{"bcrypt higher cost", &Bcrypt{Cost: bcrypt.MinCost + 1}, bcryptHash, true},
+		{"bcrypt malformed", testBcrypt(), "$2a$garbage", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.alg.Outdated(tt.encoded); got != tt.want {
+				t.Errorf("Outdated = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHasherVerify(t *testing.T) {
+	current := testArgon2id()
+	legacy := testBcrypt()
+	h := NewHasher(current, legacy)
+
+	currentHash, err := current.Hash("password")
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+	outdatedHash, err := (&Argon2id{Memory: 32, Iterations: 1, Parallelism: 1}).Hash("password")
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+	legacyHash, err := legacy.Hash("password")
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		encoded    string
+		password   string
+		wantOK     bool
+		wantRehash bool
+		wantErr    error
+	}{
+		{"current", currentHash, "password", true, false, nil},
+		{"current wrong password", currentHash, "wrong", false, false, nil},
+		{"outdated parameters", outdatedHash, "password", true, true, nil},
+		{"outdated wrong password", outdatedHash, "wrong", false, false, nil},
+		{"legacy algorithm", legacyHash, "password", true, true, nil},
+		{"legacy wrong password", legacyHash, "wrong", false, false, nil},
+		{"unusable", Unusable, "password", false, false, ErrUnknownFormat},
+		{"empty", "", "", false, false, ErrUnknownFormat},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, rehash, err := h.Verify(tt.encoded, tt.password)
+			if ok != tt.wantOK || rehash != tt.wantRehash {
+				t.Errorf("Verify = %v, %v, want %v, %v", ok, rehash, tt.wantOK, tt.wantRehash)
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Verify error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHasherHashUsesCurrent(t *testing.T) {
+	h := NewHasher(testArgon2id(), testBcrypt())
+	encoded, err := h.Hash("password")
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+	if !testArgon2id().Identifies(encoded) {
+		t.Errorf("Hash = %q, want an Argon2id hash", encoded)
+	}
+}
@@ -0,0 +1,102 @@
+package repository
+
+import (
+	"errors"
+
+	"github.com/cachatto/master-slave-server/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Common errors returned by AccessRequestRepository.
+var (
+	ErrAccessRequestPending = errors.New("access request already pending")
+	ErrAccessRequestDecided = errors.New("access request already decided")
+)
+
+// AccessRequestRepository handles database operations for access requests.
+type AccessRequestRepository struct {
+	db *gorm.DB
+}
+
+// NewAccessRequestRepository creates a new AccessRequestRepository.
+func NewAccessRequestRepository(db *gorm.DB) *AccessRequestRepository {
+	return &AccessRequestRepository{db: db}
+}
+
+// Create inserts a new access request. It returns ErrAccessRequestPending if
+// the user already has a pending request for the app.
+func (r *AccessRequestRepository) Create(request *models.AccessRequest) error {
+	if err := r.db.Create(request).Error; err != nil {
+		if isUniqueViolation(err) {
+			return ErrAccessRequestPending
+		}
+		return err
+	}
+	return nil
+}
+
+// FindByID retrieves an access request by its UUID, with its app.
+func (r *AccessRequestRepository) FindByID(id uuid.UUID) (*models.AccessRequest, error) {
+	var request models.AccessRequest
+	result := r.db.Preload("App").First(&request, "id = ?", id)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &request, nil
+}
+
+// ListForApp returns one page of the access requests for an app with their
+// users, newest first, and the total number of them. A non-empty status
+// restricts both to the requests with that status.
+func (r *AccessRequestRepository) ListForApp(appID uuid.UUID, status string, offset, limit int) ([]models.AccessRequest, int64, error) {
+	query := r.db.Model(&models.AccessRequest{}).Where("app_id = ?", appID)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	query = query.Session(&gorm.Session{})
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var requests []models.AccessRequest
+	result := query.Preload("User").Order("created_at DESC, id").Offset(offset).Limit(limit).Find(&requests)
+	if result.Error != nil {
+		return nil, 0, result.Error
+	}
+	return requests, total, nil
+}
+
+// Decide saves the decision recorded on a pending request and, if perm is
+// non-nil, grants it in the same transaction. It returns
+// ErrAccessRequestDecided if the request is no longer pending.
+func (r *AccessRequestRepository) Decide(request *models.AccessRequest, perm *models.UserAppPermission) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.AccessRequest{}).
+			Where("id = ? AND status = ?", request.ID, models.AccessRequestPending).
+			Updates(map[string]interface{}{
+				"status":     request.Status,
+				"decided_by": request.DecidedBy,
+				"decided_at": request.DecidedAt,
+				"note":       request.Note,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrAccessRequestDecided
+		}
+
+		if perm == nil {
+			return nil
+		}
+		if err := grant(tx, []models.UserAppPermission{*perm}); err != nil {
+			return err
+		}
+		// As with Grant, a window that has not started yet revokes the access
+		// the user had so far
+		return revokeUngranted(tx, "user_id = ? AND app_id = ?", perm.UserID, perm.AppID)
+	})
+}
@@ -1,11 +1,20 @@
 package repository
 
 import (
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
 	"github.com/cachatto/master-slave-server/internal/models"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
+// ErrPackageIDTaken is returned by Create and Update when another app
+// already uses the package ID.
+var ErrPackageIDTaken = errors.New("package id already registered")
+
 // AppRepository handles database operations for the app registry.
 type AppRepository struct {
 	db *gorm.DB
@@ -16,12 +25,13 @@ func NewAppRepository(db *gorm.DB) *AppRepository {
 	return &AppRepository{db: db}
 }
 
-// GetPermittedApps returns all apps a user is authorized to access.
-func (r *AppRepository) GetPermittedApps(userID uuid.UUID) ([]models.App, error) {
+// GetPermittedApps returns all apps a user is currently authorized to
+// access, directly or through a group. A non-nil tenantID keeps the apps of
+// that tenant.
+func (r *AppRepository) GetPermittedApps(tenantID *uuid.UUID, userID uuid.UUID) ([]models.App, error) {
 	var apps []models.App
-	result := r.db.
-		Joins("JOIN user_app_permissions ON user_app_permissions.app_id = app_registry.id").
-		Where("user_app_permissions.user_id = ?", userID).
+	result := inTenant(r.db, tenantID).
+		Where("id IN (?)", r.grants(userID).Select("app_id")).
 		Find(&apps)
 	if result.Error != nil {
 		return nil, result.Error
@@ -29,10 +39,22 @@ func (r *AppRepository) GetPermittedApps(userID uuid.UUID) ([]models.App, error)
 	return apps, nil
 }
 
-// FindByID retrieves an app by its UUID.
-func (r *AppRepository) FindByID(id uuid.UUID) (*models.App, error) {
+// FindByIDs retrieves the apps among ids that exist. A non-nil tenantID
+// keeps the apps of that tenant.
+func (r *AppRepository) FindByIDs(tenantID *uuid.UUID, ids []uuid.UUID) ([]models.App, error) {
+	var apps []models.App
+	result := inTenant(r.db, tenantID).Where("id IN ?", ids).Find(&apps)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return apps, nil
+}
+
+// FindByID retrieves an app by its UUID. With a non-nil tenantID, apps of
+// other tenants are reported as gorm.ErrRecordNotFound.
+func (r *AppRepository) FindByID(tenantID *uuid.UUID, id uuid.UUID) (*models.App, error) {
 	var app models.App
-	result := r.db.First(&app, "id = ?", id)
+	result := inTenant(r.db, tenantID).First(&app, "id = ?", id)
 	if result.Error != nil {
 		return nil, result.Error
 	}
@@ -49,14 +71,133 @@ func (r *AppRepository) FindByPackageID(packageID string) (*models.App, error) {
 	return &app, nil
 }
 
-// HasPermission checks if a user has permission to use a specific app.
-func (r *AppRepository) HasPermission(userID, appID uuid.UUID) (bool, error) {
-	var count int64
-	result := r.db.Model(&models.UserAppPermission{}).
-		Where("user_id = ? AND app_id = ?", userID, appID).
-		Count(&count)
+// FindPermission retrieves a user's effective permission for an app: the
+// direct grant, if within its validity window, and the grants of the user's
+// groups merged into one, with the union of their scopes. It returns
+// gorm.ErrRecordNotFound if the user has no current permission for the app.
+func (r *AppRepository) FindPermission(userID, appID uuid.UUID) (*models.UserAppPermission, error) {
+	perms, err := r.mergeGrants(userID, r.grants(userID).Where("app_id = ?", appID))
+	if err != nil {
+		return nil, err
+	}
+	if len(perms) == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &perms[0], nil
+}
+
+// FindPermissions retrieves a user's effective permissions, one per app.
+// See FindPermission.
+func (r *AppRepository) FindPermissions(userID uuid.UUID) ([]models.UserAppPermission, error) {
+	return r.mergeGrants(userID, r.grants(userID))
+}
+
+// mergeGrants runs a query on the grants of a user and merges the grants
+// into one permission per app.
+func (r *AppRepository) mergeGrants(userID uuid.UUID, query *gorm.DB) ([]models.UserAppPermission, error) {
+	var grants []models.UserAppPermission
+	result := query.Order("app_id").Find(&grants)
 	if result.Error != nil {
-		return false, result.Error
+		return nil, result.Error
+	}
+
+	var perms []models.UserAppPermission
+	for _, grant := range grants {
+		if n := len(perms); n > 0 && perms[n-1].AppID == grant.AppID {
+			perms[n-1].Scopes += " " + grant.Scopes
+			continue
+		}
+		perms = append(perms, models.UserAppPermission{UserID: userID, AppID: grant.AppID, Scopes: grant.Scopes})
+	}
+	for i := range perms {
+		perms[i].Scopes = strings.Join(uniqueFields(perms[i].Scopes), " ")
+	}
+	return perms, nil
+}
+
+// grants returns a query on the app_id and scopes of every current grant of
+// a user, direct or through a group. Direct grants outside their validity
+// window are left out. A user can have several grants for the same app.
+func (r *AppRepository) grants(userID uuid.UUID) *gorm.DB {
+	now := time.Now()
+	return r.db.Table("(?) AS grants", r.db.Raw(`SELECT app_id, scopes FROM user_app_permissions
+		WHERE user_id = ? AND (valid_from IS NULL OR valid_from <= ?) AND (valid_until IS NULL OR valid_until > ?)
+		UNION ALL
+		SELECT gp.app_id, gp.scopes FROM group_app_permissions gp
+		JOIN group_members gm ON gm.group_id = gp.group_id
+		WHERE gm.user_id = ?`, userID, now, now, userID))
+}
+
+// uniqueFields returns the space-separated fields of s without duplicates.
+func uniqueFields(s string) []string {
+	var fields []string
+	for _, f := range strings.Fields(s) {
+		if !slices.Contains(fields, f) {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// Create registers a new app.
+func (r *AppRepository) Create(app *models.App) error {
+	if err := r.db.Create(app).Error; err != nil {
+		if isUniqueViolation(err) {
+			return ErrPackageIDTaken
+		}
+		return err
+	}
+	return nil
+}
+
+// List returns one page of apps ordered by creation time, and the total
+// number of apps. A non-nil tenantID restricts both to the apps of that
+// tenant, and a non-nil ownerID to the apps it owns.
+func (r *AppRepository) List(tenantID, ownerID *uuid.UUID, offset, limit int) ([]models.App, int64, error) {
+	query := r.db.Model(&models.App{})
+	if tenantID != nil {
+		query = query.Where("tenant_id = ?", *tenantID)
+	}
+	if ownerID != nil {
+		query = query.Where("owner_id = ?", *ownerID)
+	}
+	query = query.Session(&gorm.Session{})
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var apps []models.App
+	result := query.Order("created_at, id").Offset(offset).Limit(limit).Find(&apps)
+	if result.Error != nil {
+		return nil, 0, result.Error
+	}
+	return apps, total, nil
+}
+
+// Update saves all fields of an existing app.
+func (r *AppRepository) Update(app *models.App) error {
+	if err := r.db.Save(app).Error; err != nil {
+		if isUniqueViolation(err) {
+			return ErrPackageIDTaken
+		}
+		return err
+	}
+	return nil
+}
+
+// Delete removes an app. Permissions, group permissions, one-time codes,
+// authorization codes and refresh tokens of the app are deleted by the
+// foreign key cascades.
+// It returns gorm.ErrRecordNotFound if the app does not exist.
+func (r *AppRepository) Delete(id uuid.UUID) error {
+	result := r.db.Delete(&models.App{}, "id = ?", id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
 	}
-	return count > 0, nil
+	return nil
 }
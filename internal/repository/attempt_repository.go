@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/cachatto/master-slave-server/internal/models"
+	"gorm.io/gorm"
+)
+
+// AttemptRepository handles database operations for rate-limiter counters.
+type AttemptRepository struct {
+	db *gorm.DB
+}
+
+// NewAttemptRepository creates a new AttemptRepository.
+func NewAttemptRepository(db *gorm.DB) *AttemptRepository {
+	return &AttemptRepository{db: db}
+}
+
+// LockedUntil returns the lockout deadline of key (zero time if unknown).
+func (r *AttemptRepository) LockedUntil(key string) (time.Time, error) {
+	var attempt models.AuthAttempt
+	result := r.db.Where("key = ?", key).First(&attempt)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return time.Time{}, nil
+	}
+	if result.Error != nil {
+		return time.Time{}, result.Error
+	}
+	return attempt.LockedUntil, nil
+}
+
+// RecordFailure atomically increments the failure counter of key and returns
+// the new count. A counter whose last failure is older than window restarts at 1.
+func (r *AttemptRepository) RecordFailure(key string, window time.Duration) (int, error) {
+	now := time.Now()
+	var failures int
+	result := r.db.Raw(`
+		INSERT INTO auth_attempts (key, failures, last_failure_at, locked_until)
+		VALUES (?, 1, ?, ?)
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE WHEN auth_attempts.last_failure_at < ? THEN 1 ELSE auth_attempts.failures + 1 END,
+			last_failure_at = EXCLUDED.last_failure_at
+		RETURNING failures`,
+		key, now, time.Time{}, now.Add(-window),
+	).Scan(&failures)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	return failures, nil
+}
+
+// Lock sets the lockout deadline of key.
+func (r *AttemptRepository) Lock(key string, until time.Time) error {
+	return r.db.Model(&models.AuthAttempt{}).
+		Where("key = ?", key).
+		Update("locked_until", until).Error
+}
+
+// Delete removes the counter of key.
+func (r *AttemptRepository) Delete(key string) error {
+	return r.db.Where("key = ?", key).Delete(&models.AuthAttempt{}).Error
+}
+
+// CleanExpired removes counters with the given key prefix that are neither
+// locked nor within the failure window.
+func (r *AttemptRepository) CleanExpired(prefix string, window time.Duration) error {
+	now := time.Now()
+	return r.db.Where("key LIKE ? AND locked_until < ? AND last_failure_at < ?", prefix+"%", now, now.Add(-window)).
+		Delete(&models.AuthAttempt{}).Error
+}
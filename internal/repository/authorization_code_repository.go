@@ -0,0 +1,55 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/cachatto/master-slave-server/internal/models"
+	"gorm.io/gorm"
+)
+
+// AuthorizationCodeRepository handles database operations for OIDC authorization codes.
+type AuthorizationCodeRepository struct {
+	db *gorm.DB
+}
+
+// NewAuthorizationCodeRepository creates a new AuthorizationCodeRepository.
+func NewAuthorizationCodeRepository(db *gorm.DB) *AuthorizationCodeRepository {
+	return &AuthorizationCodeRepository{db: db}
+}
+
+// Create stores a new authorization code in the database.
+func (r *AuthorizationCodeRepository) Create(code *models.AuthorizationCode) error {
+	return r.db.Create(code).Error
+}
+
+// FindByCode retrieves an authorization code by the hash of its code.
+func (r *AuthorizationCodeRepository) FindByCode(codeHash string) (*models.AuthorizationCode, error) {
+	var authCode models.AuthorizationCode
+	result := r.db.Where("code_hash = ?", codeHash).First(&authCode)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &authCode, nil
+}
+
+// MarkClaimed atomically marks an unexpired, unclaimed authorization code as
+// claimed. Only one caller can claim a given code; the others receive
+// ErrCodeAlreadyClaimed.
+func (r *AuthorizationCodeRepository) MarkClaimed(code *models.AuthorizationCode) error {
+	result := r.db.Model(&models.AuthorizationCode{}).
+		Where("id = ? AND claimed = ? AND expires_at > ?", code.ID, false, time.Now()).
+		Update("claimed", true)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrCodeAlreadyClaimed
+	}
+	return nil
+}
+
+// CleanExpired removes all expired or claimed authorization codes.
+func (r *AuthorizationCodeRepository) CleanExpired() error {
+	return r.db.Where("expires_at < ? OR claimed = ?", time.Now(), true).
+		Delete(&models.AuthorizationCode{}).Error
+}
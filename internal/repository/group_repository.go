@@ -0,0 +1,189 @@
+package repository
+
+import (
+	"errors"
+
+	"github.com/cachatto/master-slave-server/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrGroupNameTaken is returned by Create and Update when another group of
+// the tenant already uses the name.
+var ErrGroupNameTaken = errors.New("group name already taken")
+
+// GroupRepository handles database operations for groups, their members and
+// their app permissions.
+type GroupRepository struct {
+	db *gorm.DB
+}
+
+// NewGroupRepository creates a new GroupRepository.
+func NewGroupRepository(db *gorm.DB) *GroupRepository {
+	return &GroupRepository{db: db}
+}
+
+// Create inserts a new group.
+func (r *GroupRepository) Create(group *models.Group) error {
+	if err := r.db.Create(group).Error; err != nil {
+		if isUniqueViolation(err) {
+			return ErrGroupNameTaken
+		}
+		return err
+	}
+	return nil
+}
+
+// FindByID retrieves a group by its UUID. With a non-nil tenantID, groups
+// of other tenants are reported as gorm.ErrRecordNotFound.
+func (r *GroupRepository) FindByID(tenantID *uuid.UUID, id uuid.UUID) (*models.Group, error) {
+	var group models.Group
+	result := inTenant(r.db, tenantID).First(&group, "id = ?", id)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &group, nil
+}
+
+// List returns one page of groups ordered by name, and the total number of
+// groups. A non-nil tenantID restricts both to the groups of that tenant.
+func (r *GroupRepository) List(tenantID *uuid.UUID, offset, limit int) ([]models.Group, int64, error) {
+	query := r.db.Model(&models.Group{})
+	if tenantID != nil {
+		query = query.Where("tenant_id = ?", *tenantID)
+	}
+	query = query.Session(&gorm.Session{})
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var groups []models.Group
+	result := query.Order("name").Offset(offset).Limit(limit).Find(&groups)
+	if result.Error != nil {
+		return nil, 0, result.Error
+	}
+	return groups, total, nil
+}
+
+// Update saves all fields of an existing group.
+func (r *GroupRepository) Update(group *models.Group) error {
+	if err := r.db.Save(group).Error; err != nil {
+		if isUniqueViolation(err) {
+			return ErrGroupNameTaken
+		}
+		return err
+	}
+	return nil
+}
+
+// Delete removes a group with its memberships and app permissions, and
+// revokes the access the members had only through the group.
+// It returns gorm.ErrRecordNotFound if the group does not exist.
+func (r *GroupRepository) Delete(id uuid.UUID) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var userIDs, appIDs []uuid.UUID
+		if err := tx.Model(&models.GroupMember{}).Where("group_id = ?", id).Pluck("user_id", &userIDs).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.GroupAppPermission{}).Where("group_id = ?", id).Pluck("app_id", &appIDs).Error; err != nil {
+			return err
+		}
+
+		result := tx.Delete(&models.Group{}, "id = ?", id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		if len(userIDs) == 0 || len(appIDs) == 0 {
+			return nil
+		}
+		return revokeUngranted(tx, "user_id IN ? AND app_id IN ?", userIDs, appIDs)
+	})
+}
+
+// Members returns one page of the members of a group ordered by email,
+// together with the total number of members.
+func (r *GroupRepository) Members(groupID uuid.UUID, offset, limit int) ([]models.User, int64, error) {
+	query := r.db.Model(&models.User{}).
+		Joins("JOIN group_members ON group_members.user_id = users.id").
+		Where("group_members.group_id = ?", groupID).
+		Session(&gorm.Session{})
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var users []models.User
+	result := query.Order("users.email").Offset(offset).Limit(limit).Find(&users)
+	if result.Error != nil {
+		return nil, 0, result.Error
+	}
+	return users, total, nil
+}
+
+// AddMembers adds users to a group. Users already in the group are skipped.
+func (r *GroupRepository) AddMembers(groupID uuid.UUID, userIDs []uuid.UUID) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+	members := make([]models.GroupMember, len(userIDs))
+	for i, userID := range userIDs {
+		members[i] = models.GroupMember{GroupID: groupID, UserID: userID}
+	}
+	return r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&members).Error
+}
+
+// RemoveMembers removes users from a group and revokes the access they had
+// only through the group.
+func (r *GroupRepository) RemoveMembers(groupID uuid.UUID, userIDs []uuid.UUID) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("group_id = ? AND user_id IN ?", groupID, userIDs).Delete(&models.GroupMember{}).Error; err != nil {
+			return err
+		}
+		return revokeUngranted(tx,
+			"user_id IN ? AND app_id IN (SELECT app_id FROM group_app_permissions WHERE group_id = ?)",
+			userIDs, groupID)
+	})
+}
+
+// Permissions returns the app permissions of a group with their apps.
+func (r *GroupRepository) Permissions(groupID uuid.UUID) ([]models.GroupAppPermission, error) {
+	var perms []models.GroupAppPermission
+	result := r.db.Preload("App").Where("group_id = ?", groupID).Find(&perms)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return perms, nil
+}
+
+// GrantApps inserts group app permissions. Permissions that already exist
+// get the new scopes.
+func (r *GroupRepository) GrantApps(perms []models.GroupAppPermission) error {
+	if len(perms) == 0 {
+		return nil
+	}
+	return r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "group_id"}, {Name: "app_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"scopes"}),
+	}).Create(&perms).Error
+}
+
+// RevokeApps removes a group's permissions for appIDs and revokes the
+// access the members had to those apps only through the group.
+func (r *GroupRepository) RevokeApps(groupID uuid.UUID, appIDs []uuid.UUID) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("group_id = ? AND app_id IN ?", groupID, appIDs).Delete(&models.GroupAppPermission{}).Error; err != nil {
+			return err
+		}
+		return revokeUngranted(tx,
+			"app_id IN ? AND user_id IN (SELECT user_id FROM group_members WHERE group_id = ?)",
+			appIDs, groupID)
+	})
+}
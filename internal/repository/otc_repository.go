@@ -1,12 +1,17 @@
 package repository
 
 import (
+	"errors"
 	"time"
 
 	"github.com/cachatto/master-slave-server/internal/models"
 	"gorm.io/gorm"
 )
 
+// ErrCodeAlreadyClaimed is returned by MarkClaimed when the code was claimed
+// by a concurrent request.
+var ErrCodeAlreadyClaimed = errors.New("code already claimed")
+
 // OTCRepository handles database operations for one-time codes.
 type OTCRepository struct {
 	db *gorm.DB
@@ -22,19 +27,31 @@ func (r *OTCRepository) Create(otc *models.OneTimeCode) error {
 	return r.db.Create(otc).Error
 }
 
-// FindByCode retrieves a one-time code by its code string.
-func (r *OTCRepository) FindByCode(code string) (*models.OneTimeCode, error) {
+// FindByCode retrieves a one-time code by the keyed hash of its code string.
+func (r *OTCRepository) FindByCode(codeHash string) (*models.OneTimeCode, error) {
 	var otc models.OneTimeCode
-	result := r.db.Where("code = ?", code).First(&otc)
+	result := r.db.Where("code_hash = ?", codeHash).First(&otc)
 	if result.Error != nil {
 		return nil, result.Error
 	}
 	return &otc, nil
 }
 
-// MarkClaimed marks a one-time code as claimed.
+// MarkClaimed atomically marks an unexpired, unclaimed one-time code as claimed.
+// The check and the update are a single conditional UPDATE, so when several
+// requests race for the same code exactly one succeeds and the others receive
+// ErrCodeAlreadyClaimed.
 func (r *OTCRepository) MarkClaimed(otc *models.OneTimeCode) error {
-	return r.db.Model(otc).Update("claimed", true).Error
+	result := r.db.Model(&models.OneTimeCode{}).
+		Where("id = ? AND claimed = ? AND expires_at > ?", otc.ID, false, time.Now()).
+		Update("claimed", true)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrCodeAlreadyClaimed
+	}
+	return nil
 }
 
 // CleanExpired removes all expired one-time codes from the database.
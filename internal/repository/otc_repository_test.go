@@ -0,0 +1,125 @@
+package repository
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cachatto/master-slave-server/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// openTestDB connects to the Postgres database in TEST_DATABASE_URL and
+// migrates the models the tests use. The test is skipped when the variable
+// is unset.
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("connect to test database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Tenant{}, &models.User{}, &models.App{}, &models.OneTimeCode{}); err != nil {
+		t.Fatalf("migrate test database: %v", err)
+	}
+	return db
+}
+
+// createTestCode inserts a tenant, user and app, and an unclaimed one-time
+// code for them, all removed again when the test ends.
+func createTestCode(t *testing.T, db *gorm.DB) *models.OneTimeCode {
+	t.Helper()
+	suffix := uuid.NewString()
+
+	tenant := &models.Tenant{Name: "OTC test", Slug: "otc-test-" + suffix[:8]}
+	if err := db.Create(tenant).Error; err != nil {
+		t.Fatalf("create tenant: %v", err)
+	}
+	user := &models.User{TenantID: tenant.ID, Email: suffix + "@example.com", PasswordHash: "x"}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	app := &models.App{
+		TenantID:       tenant.ID,
+		AppName:        "OTC test",
+		PackageID:      "com.example.otctest" + suffix[:8],
+		DeepLinkScheme: "otctest://",
+	}
+	if err := db.Create(app).Error; err != nil {
+		t.Fatalf("create app: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Where("app_id = ?", app.ID).Delete(&models.OneTimeCode{})
+		db.Delete(app)
+		db.Unscoped().Delete(user)
+		db.Delete(tenant)
+	})
+
+	otc := &models.OneTimeCode{
+		UserID:    user.ID,
+		AppID:     app.ID,
+		CodeHash:  suffix,
+		ExpiresAt: time.Now().Add(time.Minute),
+	}
+	if err := NewOTCRepository(db).Create(otc); err != nil {
+		t.Fatalf("create code: %v", err)
+	}
+	return otc
+}
+
+func TestMarkClaimedConcurrently(t *testing.T) {
+	db := openTestDB(t)
+	otc := createTestCode(t, db)
+	repo := NewOTCRepository(db)
+
+	const claimers = 32
+	errs := make([]error, claimers)
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < claimers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			errs[i] = repo.MarkClaimed(&models.OneTimeCode{ID: otc.ID})
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	succeeded := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			succeeded++
+		case errors.Is(err, ErrCodeAlreadyClaimed):
+		default:
+			t.Errorf("MarkClaimed: unexpected error %v", err)
+		}
+	}
+	if succeeded != 1 {
+		t.Errorf("MarkClaimed succeeded %d times, want exactly 1", succeeded)
+	}
+}
+
+func TestMarkClaimedExpired(t *testing.T) {
+	db := openTestDB(t)
+	otc := createTestCode(t, db)
+	repo := NewOTCRepository(db)
+
+	if err := db.Model(otc).Update("expires_at", time.Now().Add(-time.Second)).Error; err != nil {
+		t.Fatalf("expire code: %v", err)
+	}
+	if err := repo.MarkClaimed(otc); !errors.Is(err, ErrCodeAlreadyClaimed) {
+		t.Errorf("MarkClaimed on an expired code = %v, want ErrCodeAlreadyClaimed", err)
+	}
+}
@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/cachatto/master-slave-server/internal/models"
+	"gorm.io/gorm"
+)
+
+// ErrResetTokenUsed is returned by ResetPassword when the token was used or
+// expired in the meantime.
+var ErrResetTokenUsed = errors.New("reset token already used")
+
+// PasswordResetRepository handles database operations for password reset tokens.
+type PasswordResetRepository struct {
+	db *gorm.DB
+}
+
+// NewPasswordResetRepository creates a new PasswordResetRepository.
+func NewPasswordResetRepository(db *gorm.DB) *PasswordResetRepository {
+	return &PasswordResetRepository{db: db}
+}
+
+// Replace deletes any outstanding reset tokens of the token's user and
+// stores the new one, so only the most recently emailed link works.
+func (r *PasswordResetRepository) Replace(token *models.PasswordResetToken) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", token.UserID).Delete(&models.PasswordResetToken{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(token).Error
+	})
+}
+
+// FindByToken retrieves a reset token by the keyed hash of its token string.
+func (r *PasswordResetRepository) FindByToken(tokenHash string) (*models.PasswordResetToken, error) {
+	var token models.PasswordResetToken
+	result := r.db.Where("token_hash = ?", tokenHash).First(&token)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &token, nil
+}
+
+// ResetPassword marks an unexpired, unused reset token as used and, in the
+// same transaction, sets the password of its user like
+// UserRepository.SetPassword, revokes every token family of the user and
+// deletes their other reset tokens. Marking the token comes first, so a
+// token can reset the password at most once even under concurrent requests.
+func (r *PasswordResetRepository) ResetPassword(token *models.PasswordResetToken, passwordHash string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.PasswordResetToken{}).
+			Where("id = ? AND used = ? AND expires_at > ?", token.ID, false, time.Now()).
+			Update("used", true)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrResetTokenUsed
+		}
+
+		if err := setPassword(tx, token.UserID, passwordHash); err != nil {
+			return err
+		}
+		err := tx.Model(&models.RefreshToken{}).
+			Where("user_id = ? AND revoked_at IS NULL", token.UserID).
+			Update("revoked_at", time.Now()).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where("user_id = ? AND id <> ?", token.UserID, token.ID).
+			Delete(&models.PasswordResetToken{}).Error
+	})
+}
+
+// CleanExpired removes all expired or used reset tokens.
+func (r *PasswordResetRepository) CleanExpired() error {
+	return r.db.Where("expires_at < ? OR used = ?", time.Now(), true).
+		Delete(&models.PasswordResetToken{}).Error
+}
@@ -0,0 +1,202 @@
+package repository
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/cachatto/master-slave-server/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// PermissionRepository handles database operations for user ↔ app permissions.
+type PermissionRepository struct {
+	db *gorm.DB
+}
+
+// NewPermissionRepository creates a new PermissionRepository.
+func NewPermissionRepository(db *gorm.DB) *PermissionRepository {
+	return &PermissionRepository{db: db}
+}
+
+// Grant inserts permissions. Permissions that already exist get the new
+// scopes and validity window. Users granted a window that has not started
+// yet lose their access to the app right away, unless still permitted
+// through a group (see revokeUngranted).
+func (r *PermissionRepository) Grant(perms []models.UserAppPermission) error {
+	if len(perms) == 0 {
+		return nil
+	}
+	userIDs := make([]uuid.UUID, len(perms))
+	appIDs := make([]uuid.UUID, len(perms))
+	for i := range perms {
+		userIDs[i], appIDs[i] = perms[i].UserID, perms[i].AppID
+	}
+
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := grant(tx, perms); err != nil {
+			return err
+		}
+		return revokeUngranted(tx, "user_id IN ? AND app_id IN ?", userIDs, appIDs)
+	})
+}
+
+// grant upserts perms, replacing the scopes and validity window of the
+// permissions that already exist.
+func grant(tx *gorm.DB, perms []models.UserAppPermission) error {
+	return tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "app_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"scopes", "valid_from", "valid_until", "expired_at"}),
+	}).Create(&perms).Error
+}
+
+// ExpireGrants marks the permissions whose validity window has ended as
+// expired and revokes the access their users had to their apps, unless
+// still permitted through a group (see revokeUngranted). A GrantEvent is
+// recorded for each in the same transaction. It returns the permissions it
+// expired; each expiry is only returned and recorded once.
+func (r *PermissionRepository) ExpireGrants() ([]models.UserAppPermission, error) {
+	var perms []models.UserAppPermission
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		// Skip the rows another instance is expiring concurrently
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("valid_until <= ? AND expired_at IS NULL", now).
+			Find(&perms).Error; err != nil {
+			return err
+		}
+		if len(perms) == 0 {
+			return nil
+		}
+
+		ids := make([]uuid.UUID, len(perms))
+		for i := range perms {
+			ids[i] = perms[i].ID
+		}
+		if err := tx.Model(&models.UserAppPermission{}).
+			Where("id IN ?", ids).
+			Update("expired_at", now).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(grantEvents(models.GrantEventExpired, perms)).Error; err != nil {
+			return err
+		}
+		return revokeUngranted(tx,
+			"(user_id, app_id) IN (SELECT user_id, app_id FROM user_app_permissions WHERE id IN ?)",
+			ids)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return perms, nil
+}
+
+// grantEvents returns an event of the given type for each of perms.
+func grantEvents(event string, perms []models.UserAppPermission) []models.GrantEvent {
+	events := make([]models.GrantEvent, len(perms))
+	for i := range perms {
+		events[i] = models.GrantEvent{
+			Event:        event,
+			PermissionID: perms[i].ID,
+			UserID:       perms[i].UserID,
+			AppID:        perms[i].AppID,
+			Scopes:       perms[i].Scopes,
+			ValidFrom:    perms[i].ValidFrom,
+			ValidUntil:   perms[i].ValidUntil,
+		}
+	}
+	return events
+}
+
+// ForApp returns the permissions of userIDs for an app.
+func (r *PermissionRepository) ForApp(appID uuid.UUID, userIDs []uuid.UUID) ([]models.UserAppPermission, error) {
+	var perms []models.UserAppPermission
+	result := r.db.Where("app_id = ? AND user_id IN ?", appID, userIDs).Find(&perms)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return perms, nil
+}
+
+// RevokeForUser removes a user's permissions for appIDs.
+// See revoke for what else is removed.
+func (r *PermissionRepository) RevokeForUser(userID uuid.UUID, appIDs []uuid.UUID) error {
+	return r.revoke("user_id = ? AND app_id IN ?", userID, appIDs)
+}
+
+// RevokeForApp removes the permissions of userIDs for an app.
+// See revoke for what else is removed.
+func (r *PermissionRepository) RevokeForApp(appID uuid.UUID, userIDs []uuid.UUID) error {
+	return r.revoke("app_id = ? AND user_id IN ?", appID, userIDs)
+}
+
+// revoke removes the permissions matching where, then revokes the access of
+// the same users to the same apps if they no longer have permission through
+// a group (see revokeUngranted). Every table involved has user_id and app_id
+// columns, so where applies to all of them.
+func (r *PermissionRepository) revoke(where string, args ...interface{}) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where(where, args...).Delete(&models.UserAppPermission{}).Error; err != nil {
+			return err
+		}
+		return revokeUngranted(tx, where, args...)
+	})
+}
+
+// revokeUngranted deletes the outstanding one-time codes and authorization
+// codes matching where and revokes the slave app sessions matching where,
+// unless the user still has a current permission for the app, directly or
+// through a group. It is called after removing or narrowing grants, so that
+// losing a permission takes effect immediately.
+func revokeUngranted(tx *gorm.DB, where string, args ...interface{}) error {
+	if err := tx.Where(where, args...).
+		Where(ungranted("one_time_codes")).
+		Delete(&models.OneTimeCode{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where(where, args...).
+		Where(ungranted("oauth_authorization_codes")).
+		Delete(&models.AuthorizationCode{}).Error; err != nil {
+		return err
+	}
+	return tx.Model(&models.RefreshToken{}).
+		Where(where, args...).
+		Where(ungranted("refresh_tokens")).
+		Where("revoked_at IS NULL").
+		Update("revoked_at", time.Now()).Error
+}
+
+// ungranted returns a condition matching the rows of table whose user has
+// no current permission for their app: direct grants outside their validity
+// window do not count.
+func ungranted(table string) string {
+	return fmt.Sprintf(`NOT EXISTS (SELECT 1 FROM user_app_permissions p
+			WHERE p.user_id = %[1]s.user_id AND p.app_id = %[1]s.app_id
+			AND (p.valid_from IS NULL OR p.valid_from <= NOW())
+			AND (p.valid_until IS NULL OR p.valid_until > NOW()))
+		AND NOT EXISTS (SELECT 1 FROM group_app_permissions gp
+			JOIN group_members gm ON gm.group_id = gp.group_id
+			WHERE gm.user_id = %[1]s.user_id AND gp.app_id = %[1]s.app_id)`, table)
+}
+
+// UsersForApp returns one page of the users permitted to use an app,
+// ordered by email, together with the total number of such users.
+func (r *PermissionRepository) UsersForApp(appID uuid.UUID, offset, limit int) ([]models.User, int64, error) {
+	query := r.db.Model(&models.User{}).
+		Joins("JOIN user_app_permissions ON user_app_permissions.user_id = users.id").
+		Where("user_app_permissions.app_id = ?", appID).
+		Session(&gorm.Session{})
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var users []models.User
+	result := query.Order("users.email").Offset(offset).Limit(limit).Find(&users)
+	if result.Error != nil {
+		return nil, 0, result.Error
+	}
+	return users, total, nil
+}
@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/cachatto/master-slave-server/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// RecoveryCodeRepository handles database operations for MFA recovery codes.
+type RecoveryCodeRepository struct {
+	db *gorm.DB
+}
+
+// NewRecoveryCodeRepository creates a new RecoveryCodeRepository.
+func NewRecoveryCodeRepository(db *gorm.DB) *RecoveryCodeRepository {
+	return &RecoveryCodeRepository{db: db}
+}
+
+// Replace deletes all recovery codes of a user and stores a new set.
+func (r *RecoveryCodeRepository) Replace(userID uuid.UUID, codeHashes []string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		if len(codeHashes) == 0 {
+			return nil
+		}
+
+		codes := make([]models.RecoveryCode, len(codeHashes))
+		for i, hash := range codeHashes {
+			codes[i] = models.RecoveryCode{UserID: userID, CodeHash: hash}
+		}
+		return tx.Create(&codes).Error
+	})
+}
+
+// Consume marks an unused recovery code of a user as used. It returns
+// gorm.ErrRecordNotFound if no matching unused code exists.
+func (r *RecoveryCodeRepository) Consume(userID uuid.UUID, codeHash string) error {
+	result := r.db.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// CountUnused returns how many unused recovery codes a user has left.
+func (r *RecoveryCodeRepository) CountUnused(userID uuid.UUID) (int64, error) {
+	var count int64
+	result := r.db.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Count(&count)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	return count, nil
+}
@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/cachatto/master-slave-server/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ErrTokenAlreadyRotated is returned by Rotate when the parent token was
+// rotated or revoked by a concurrent request.
+var ErrTokenAlreadyRotated = errors.New("refresh token already rotated")
+
+// RefreshTokenRepository handles database operations for refresh tokens.
+type RefreshTokenRepository struct {
+	db *gorm.DB
+}
+
+// NewRefreshTokenRepository creates a new RefreshTokenRepository.
+func NewRefreshTokenRepository(db *gorm.DB) *RefreshTokenRepository {
+	return &RefreshTokenRepository{db: db}
+}
+
+// Create stores a newly issued refresh token.
+func (r *RefreshTokenRepository) Create(token *models.RefreshToken) error {
+	return r.db.Create(token).Error
+}
+
+// FindByID retrieves a refresh token by its jti.
+func (r *RefreshTokenRepository) FindByID(id uuid.UUID) (*models.RefreshToken, error) {
+	var token models.RefreshToken
+	result := r.db.First(&token, "id = ?", id)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &token, nil
+}
+
+// Rotate marks parent as rotated and stores next in a single transaction.
+// The rotation only succeeds if parent is still live, so two concurrent
+// refreshes with the same token cannot both obtain a new token.
+func (r *RefreshTokenRepository) Rotate(parent, next *models.RefreshToken) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.RefreshToken{}).
+			Where("id = ? AND rotated_at IS NULL AND revoked_at IS NULL", parent.ID).
+			Update("rotated_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrTokenAlreadyRotated
+		}
+		return tx.Create(next).Error
+	})
+}
+
+// RevokeFamily revokes every token in a token family.
+func (r *RefreshTokenRepository) RevokeFamily(familyID uuid.UUID) error {
+	return r.db.Model(&models.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// RevokeAllForUser revokes every token of every family belonging to a user.
+func (r *RefreshTokenRepository) RevokeAllForUser(userID uuid.UUID) error {
+	return r.db.Model(&models.RefreshToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// IsFamilyActive reports whether a token family still has unrevoked tokens.
+func (r *RefreshTokenRepository) IsFamilyActive(familyID uuid.UUID) (bool, error) {
+	var count int64
+	result := r.db.Model(&models.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL AND expires_at > ?", familyID, time.Now()).
+		Count(&count)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return count > 0, nil
+}
+
+// CleanExpired removes all expired refresh tokens from the database.
+func (r *RefreshTokenRepository) CleanExpired() error {
+	return r.db.Where("expires_at < ?", time.Now()).
+		Delete(&models.RefreshToken{}).Error
+}
@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"errors"
+
+	"github.com/cachatto/master-slave-server/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ErrTenantSlugTaken is returned by Create and Update when another tenant
+// already uses the slug.
+var ErrTenantSlugTaken = errors.New("tenant slug already taken")
+
+// TenantRepository handles database operations for tenants.
+type TenantRepository struct {
+	db *gorm.DB
+}
+
+// NewTenantRepository creates a new TenantRepository.
+func NewTenantRepository(db *gorm.DB) *TenantRepository {
+	return &TenantRepository{db: db}
+}
+
+// Create inserts a new tenant.
+func (r *TenantRepository) Create(tenant *models.Tenant) error {
+	if err := r.db.Create(tenant).Error; err != nil {
+		if isUniqueViolation(err) {
+			return ErrTenantSlugTaken
+		}
+		return err
+	}
+	return nil
+}
+
+// FindByID retrieves a tenant by its UUID.
+func (r *TenantRepository) FindByID(id uuid.UUID) (*models.Tenant, error) {
+	var tenant models.Tenant
+	result := r.db.First(&tenant, "id = ?", id)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &tenant, nil
+}
+
+// FindBySlug retrieves a tenant by its slug.
+func (r *TenantRepository) FindBySlug(slug string) (*models.Tenant, error) {
+	var tenant models.Tenant
+	result := r.db.Where("slug = ?", slug).First(&tenant)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &tenant, nil
+}
+
+// List returns one page of tenants ordered by slug, and the total number of
+// tenants.
+func (r *TenantRepository) List(offset, limit int) ([]models.Tenant, int64, error) {
+	query := r.db.Model(&models.Tenant{}).Session(&gorm.Session{})
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var tenants []models.Tenant
+	result := query.Order("slug").Offset(offset).Limit(limit).Find(&tenants)
+	if result.Error != nil {
+		return nil, 0, result.Error
+	}
+	return tenants, total, nil
+}
+
+// Update saves all fields of an existing tenant.
+func (r *TenantRepository) Update(tenant *models.Tenant) error {
+	if err := r.db.Save(tenant).Error; err != nil {
+		if isUniqueViolation(err) {
+			return ErrTenantSlugTaken
+		}
+		return err
+	}
+	return nil
+}
+
+// inTenant restricts query to the rows of tenantID, unless it is nil. Users,
+// apps and groups are looked up through it, so that callers state which
+// tenant they may see: nil only where every tenant is allowed.
+func inTenant(query *gorm.DB, tenantID *uuid.UUID) *gorm.DB {
+	if tenantID == nil {
+		return query
+	}
+	return query.Where("tenant_id = ?", *tenantID)
+}
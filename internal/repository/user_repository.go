@@ -1,11 +1,26 @@
 package repository
 
 import (
+	"errors"
+	"strings"
+	"time"
+
 	"github.com/cachatto/master-slave-server/internal/models"
+	"github.com/cachatto/master-slave-server/internal/pwhash"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
+// Common errors returned by UserRepository.
+var (
+	// ErrTOTPStepUsed is returned by AdvanceTOTPStep when the TOTP step was
+	// already used.
+	ErrTOTPStepUsed = errors.New("totp step already used")
+	// ErrEmailTaken is returned by Create when the email is already in use
+	// in the tenant, including by a soft-deleted user.
+	ErrEmailTaken = errors.New("email already in use")
+)
+
 // UserRepository handles database operations for users.
 type UserRepository struct {
 	db *gorm.DB
@@ -16,22 +31,295 @@ func NewUserRepository(db *gorm.DB) *UserRepository {
 	return &UserRepository{db: db}
 }
 
-// FindByEmail retrieves a user by their email address.
-func (r *UserRepository) FindByEmail(email string) (*models.User, error) {
+// Create inserts a new user.
+func (r *UserRepository) Create(user *models.User) error {
+	if err := r.db.Create(user).Error; err != nil {
+		if isUniqueViolation(err) {
+			return ErrEmailTaken
+		}
+		return err
+	}
+	return nil
+}
+
+// MarkEmailVerified records that a user confirmed their email address.
+// Already verified users keep their original timestamp.
+func (r *UserRepository) MarkEmailVerified(id uuid.UUID) error {
+	return r.db.Model(&models.User{}).
+		Where("id = ? AND email_verified_at IS NULL", id).
+		Update("email_verified_at", time.Now()).Error
+}
+
+// SetPassword replaces a user's password hash. It also clears the
+// failed-login counter and lockout, and marks the email verified: setting a
+// password requires either the current password or control of the mailbox.
+func (r *UserRepository) SetPassword(id uuid.UUID, passwordHash string) error {
+	return setPassword(r.db, id, passwordHash)
+}
+
+// ChangePassword sets a user's password like SetPassword and, in the same
+// transaction, revokes every token family of the user except keepFamilyID
+// and deletes their outstanding password reset tokens.
+func (r *UserRepository) ChangePassword(id uuid.UUID, passwordHash string, keepFamilyID uuid.UUID) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := setPassword(tx, id, passwordHash); err != nil {
+			return err
+		}
+		err := tx.Model(&models.RefreshToken{}).
+			Where("user_id = ? AND family_id <> ? AND revoked_at IS NULL", id, keepFamilyID).
+			Update("revoked_at", time.Now()).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", id).Delete(&models.PasswordResetToken{}).Error
+	})
+}
+
+// setPassword implements SetPassword on db, which may be a transaction.
+func setPassword(db *gorm.DB, id uuid.UUID, passwordHash string) error {
+	return db.Model(&models.User{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"password_hash":        passwordHash,
+		"failed_login_count":   0,
+		"last_failed_login_at": nil,
+		"locked_until":         nil,
+		"email_verified_at":    gorm.Expr("COALESCE(email_verified_at, ?)", time.Now()),
+	}).Error
+}
+
+// ClearPassword replaces a user's password hash with pwhash.Unusable, so
+// the user can only sign in again after a password reset.
+func (r *UserRepository) ClearPassword(id uuid.UUID) error {
+	return r.db.Model(&models.User{}).
+		Where("id = ?", id).
+		Update("password_hash", pwhash.Unusable).Error
+}
+
+// UpdatePasswordHash replaces a user's password hash with an upgraded hash
+// of the same password. Nothing is updated if the password was changed
+// since oldHash was read.
+func (r *UserRepository) UpdatePasswordHash(id uuid.UUID, oldHash, newHash string) error {
+	return r.db.Model(&models.User{}).
+		Where("id = ? AND password_hash = ?", id, oldHash).
+		Update("password_hash", newHash).Error
+}
+
+// FindByEmail retrieves a user of a tenant by their email address.
+func (r *UserRepository) FindByEmail(tenantID uuid.UUID, email string) (*models.User, error) {
+	var user models.User
+	result := r.db.Where("tenant_id = ? AND email = ?", tenantID, email).First(&user)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &user, nil
+}
+
+// FindByID retrieves a user by their UUID. With a non-nil tenantID, users
+// of other tenants are reported as gorm.ErrRecordNotFound.
+func (r *UserRepository) FindByID(tenantID *uuid.UUID, id uuid.UUID) (*models.User, error) {
 	var user models.User
-	result := r.db.Where("email = ?", email).First(&user)
+	result := inTenant(r.db, tenantID).First(&user, "id = ?", id)
 	if result.Error != nil {
 		return nil, result.Error
 	}
 	return &user, nil
 }
 
-// FindByID retrieves a user by their UUID.
-func (r *UserRepository) FindByID(id uuid.UUID) (*models.User, error) {
+// List returns one page of users ordered by creation time, together with
+// the total number of matching users. A non-nil tenantID keeps the users of
+// that tenant. A non-empty emailQuery keeps users whose email contains it
+// (case-insensitive). With deleted set, only soft-deleted users are listed
+// instead of active ones.
+func (r *UserRepository) List(tenantID *uuid.UUID, emailQuery string, deleted bool, offset, limit int) ([]models.User, int64, error) {
+	query := r.db.Model(&models.User{})
+	if tenantID != nil {
+		query = query.Where("tenant_id = ?", *tenantID)
+	}
+	if deleted {
+		query = query.Unscoped().Where("deleted_at IS NOT NULL")
+	}
+	if emailQuery != "" {
+		query = query.Where("email ILIKE ?", "%"+likeEscaper.Replace(emailQuery)+"%")
+	}
+	query = query.Session(&gorm.Session{})
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var users []models.User
+	result := query.Order("created_at, id").Offset(offset).Limit(limit).Find(&users)
+	if result.Error != nil {
+		return nil, 0, result.Error
+	}
+	return users, total, nil
+}
+
+// likeEscaper escapes the LIKE wildcards in a search term.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// FindByIDs retrieves the users among ids that exist and are not deleted.
+// A non-nil tenantID keeps the users of that tenant.
+func (r *UserRepository) FindByIDs(tenantID *uuid.UUID, ids []uuid.UUID) ([]models.User, error) {
+	var users []models.User
+	result := inTenant(r.db, tenantID).Where("id IN ?", ids).Find(&users)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return users, nil
+}
+
+// FindByIDUnscoped retrieves a user by their UUID, including soft-deleted
+// users. A non-nil tenantID restricts it like FindByID.
+func (r *UserRepository) FindByIDUnscoped(tenantID *uuid.UUID, id uuid.UUID) (*models.User, error) {
 	var user models.User
-	result := r.db.First(&user, "id = ?", id)
+	result := inTenant(r.db.Unscoped(), tenantID).First(&user, "id = ?", id)
 	if result.Error != nil {
 		return nil, result.Error
 	}
 	return &user, nil
 }
+
+// SetDisabled disables a user (at is the time of disabling) or enables
+// them again (at is nil).
+func (r *UserRepository) SetDisabled(id uuid.UUID, at *time.Time) error {
+	result := r.db.Model(&models.User{}).Where("id = ?", id).Update("disabled_at", at)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// SetRole changes a user's role.
+func (r *UserRepository) SetRole(id uuid.UUID, role string) error {
+	result := r.db.Model(&models.User{}).Where("id = ?", id).Update("role", role)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// PromoteByEmail gives role to the users of a tenant with the given emails.
+// Emails without an account are ignored.
+func (r *UserRepository) PromoteByEmail(tenantID uuid.UUID, emails []string, role string) error {
+	if len(emails) == 0 {
+		return nil
+	}
+	return r.db.Model(&models.User{}).
+		Where("tenant_id = ? AND email IN ? AND role <> ?", tenantID, emails, role).
+		Update("role", role).Error
+}
+
+// Delete soft-deletes a user. The row is kept, and so is the email: it
+// cannot be registered again in the tenant unless the user is restored.
+func (r *UserRepository) Delete(id uuid.UUID) error {
+	result := r.db.Delete(&models.User{}, "id = ?", id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// Restore undoes the soft delete of a user.
+func (r *UserRepository) Restore(id uuid.UUID) error {
+	result := r.db.Unscoped().Model(&models.User{}).
+		Where("id = ? AND deleted_at IS NOT NULL", id).
+		Update("deleted_at", nil)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// RecordLoginFailure atomically increments the failed-login counter of a user
+// and returns the new count. A counter whose last failure is older than
+// window restarts at 1.
+func (r *UserRepository) RecordLoginFailure(id uuid.UUID, window time.Duration) (int, error) {
+	now := time.Now()
+	var failures int
+	result := r.db.Raw(`
+		UPDATE users SET
+			failed_login_count = CASE
+				WHEN last_failed_login_at IS NULL OR last_failed_login_at < ? THEN 1
+				ELSE failed_login_count + 1
+			END,
+			last_failed_login_at = ?
+		WHERE id = ?
+		RETURNING failed_login_count`,
+		now.Add(-window), now, id,
+	).Scan(&failures)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	return failures, nil
+}
+
+// Lock locks a user's account until the given time.
+func (r *UserRepository) Lock(id uuid.UUID, until time.Time) error {
+	return r.db.Model(&models.User{}).
+		Where("id = ?", id).
+		Update("locked_until", until).Error
+}
+
+// ResetLoginFailures clears a user's failed-login counter and lockout.
+func (r *UserRepository) ResetLoginFailures(id uuid.UUID) error {
+	return r.db.Model(&models.User{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"failed_login_count":   0,
+			"last_failed_login_at": nil,
+			"locked_until":         nil,
+		}).Error
+}
+
+// SetTOTPSecret stores a pending TOTP secret and disables TOTP until the
+// enrollment is confirmed.
+func (r *UserRepository) SetTOTPSecret(id uuid.UUID, secret string) error {
+	return r.db.Model(&models.User{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"totp_secret":     secret,
+			"totp_enabled_at": nil,
+			"totp_last_step":  0,
+		}).Error
+}
+
+// EnableTOTP marks the user's stored TOTP secret as confirmed.
+func (r *UserRepository) EnableTOTP(id uuid.UUID) error {
+	return r.db.Model(&models.User{}).
+		Where("id = ?", id).
+		Update("totp_enabled_at", time.Now()).Error
+}
+
+// DisableTOTP removes the user's TOTP secret.
+func (r *UserRepository) DisableTOTP(id uuid.UUID) error {
+	return r.SetTOTPSecret(id, "")
+}
+
+// AdvanceTOTPStep records step as the last accepted TOTP step. It fails with
+// ErrTOTPStepUsed if the same or a later step was already accepted, so a
+// TOTP code cannot be used twice even by concurrent requests.
+func (r *UserRepository) AdvanceTOTPStep(id uuid.UUID, step int64) error {
+	result := r.db.Model(&models.User{}).
+		Where("id = ? AND totp_last_step < ?", id, step).
+		Update("totp_last_step", step)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrTOTPStepUsed
+	}
+	return nil
+}
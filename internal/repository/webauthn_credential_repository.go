@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/cachatto/master-slave-server/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ErrSignCountRegressed is returned by RecordUse when the authenticator's
+// signature counter did not increase, which indicates a cloned authenticator.
+var ErrSignCountRegressed = errors.New("signature counter did not increase")
+
+// WebAuthnCredentialRepository handles database operations for passkeys.
+type WebAuthnCredentialRepository struct {
+	db *gorm.DB
+}
+
+// NewWebAuthnCredentialRepository creates a new WebAuthnCredentialRepository.
+func NewWebAuthnCredentialRepository(db *gorm.DB) *WebAuthnCredentialRepository {
+	return &WebAuthnCredentialRepository{db: db}
+}
+
+// Create stores a newly registered credential.
+func (r *WebAuthnCredentialRepository) Create(cred *models.WebAuthnCredential) error {
+	return r.db.Create(cred).Error
+}
+
+// FindByUserID returns all credentials registered by a user.
+func (r *WebAuthnCredentialRepository) FindByUserID(userID uuid.UUID) ([]models.WebAuthnCredential, error) {
+	var creds []models.WebAuthnCredential
+	result := r.db.Where("user_id = ?", userID).Order("created_at").Find(&creds)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return creds, nil
+}
+
+// RecordUse stores the signature counter and backup state reported by a
+// successful assertion. The counter must be greater than the stored one,
+// unless both are zero (authenticators that do not implement a counter);
+// otherwise ErrSignCountRegressed is returned and nothing is updated.
+func (r *WebAuthnCredentialRepository) RecordUse(id uuid.UUID, signCount int64, backupState bool) error {
+	result := r.db.Model(&models.WebAuthnCredential{}).
+		Where("id = ? AND (sign_count < ? OR (sign_count = 0 AND ? = 0))", id, signCount, signCount).
+		Updates(map[string]interface{}{
+			"sign_count":   signCount,
+			"backup_state": backupState,
+			"last_used_at": time.Now(),
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrSignCountRegressed
+	}
+	return nil
+}
+
+// Delete removes a credential owned by userID. It returns
+// gorm.ErrRecordNotFound if the user has no such credential.
+func (r *WebAuthnCredentialRepository) Delete(userID, id uuid.UUID) error {
+	result := r.db.Where("id = ? AND user_id = ?", id, userID).Delete(&models.WebAuthnCredential{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/cachatto/master-slave-server/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// WebAuthnSessionRepository handles database operations for WebAuthn
+// ceremony sessions.
+type WebAuthnSessionRepository struct {
+	db *gorm.DB
+}
+
+// NewWebAuthnSessionRepository creates a new WebAuthnSessionRepository.
+func NewWebAuthnSessionRepository(db *gorm.DB) *WebAuthnSessionRepository {
+	return &WebAuthnSessionRepository{db: db}
+}
+
+// Create stores a new ceremony session.
+func (r *WebAuthnSessionRepository) Create(session *models.WebAuthnSession) error {
+	return r.db.Create(session).Error
+}
+
+// Take deletes and returns an unexpired session of the given ceremony, so
+// that each challenge can be answered at most once. It returns
+// gorm.ErrRecordNotFound if no such session exists.
+func (r *WebAuthnSessionRepository) Take(id uuid.UUID, ceremony string) (*models.WebAuthnSession, error) {
+	var session models.WebAuthnSession
+	result := r.db.Raw(`
+		DELETE FROM webauthn_sessions
+		WHERE id = ? AND ceremony = ? AND expires_at > ?
+		RETURNING *`,
+		id, ceremony, time.Now(),
+	).Scan(&session)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &session, nil
+}
+
+// CleanExpired removes all expired ceremony sessions.
+func (r *WebAuthnSessionRepository) CleanExpired() error {
+	return r.db.Where("expires_at < ?", time.Now()).Delete(&models.WebAuthnSession{}).Error
+}
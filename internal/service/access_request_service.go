@@ -0,0 +1,211 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/cachatto/master-slave-server/internal/models"
+	"github.com/cachatto/master-slave-server/internal/repository"
+	"github.com/google/uuid"
+)
+
+// Common errors returned by AccessRequestService.
+var (
+	ErrAccessRequestNotFound = errors.New("access request not found")
+	ErrAccessRequestPending  = errors.New("an access request for this app is already pending")
+	ErrAccessRequestDecided  = errors.New("access request has already been approved or denied")
+	ErrAlreadyPermitted      = errors.New("already permitted to use this app with the requested scopes")
+	ErrInvalidRequestStatus  = errors.New("status must be pending, approved or denied")
+)
+
+// AccessRequestPage is one page of the access requests for an app.
+type AccessRequestPage struct {
+	Requests []models.AccessRequest `json:"requests"`
+	Page     int                    `json:"page"`
+	PageSize int                    `json:"page_size"`
+	Total    int64                  `json:"total"`
+}
+
+// AccessRequestService lets users ask for permission to use a slave app and
+// the admins who may manage the app approve or deny them. Approving a
+// request grants the app to the user directly, adding to the user's
+// existing direct grant if they have one.
+//
+// Requests are never deleted once decided, so the requests for an app are
+// the history of who asked for access and who decided. Deleting the app
+// keeps its requests, which still name the app by package ID.
+type AccessRequestService struct {
+	requestRepo *repository.AccessRequestRepository
+	appRepo     *repository.AppRepository
+	userRepo    *repository.UserRepository
+	permRepo    *repository.PermissionRepository
+}
+
+// NewAccessRequestService creates a new AccessRequestService.
+func NewAccessRequestService(
+	requestRepo *repository.AccessRequestRepository,
+	appRepo *repository.AppRepository,
+	userRepo *repository.UserRepository,
+	permRepo *repository.PermissionRepository,
+) *AccessRequestService {
+	return &AccessRequestService{requestRepo: requestRepo, appRepo: appRepo, userRepo: userRepo, permRepo: permRepo}
+}
+
+// RequestAccess files a request by a user to use an app of their tenant
+// with the given scopes, which the app must declare. A user can only have
+// one pending request per app, and cannot ask for what they already have.
+func (s *AccessRequestService) RequestAccess(userID, appID uuid.UUID, scopes []string, reason string) (*models.AccessRequest, error) {
+	user, err := s.userRepo.FindByID(nil, userID)
+	if err != nil {
+		return nil, notFound(err, ErrUserNotFound)
+	}
+	app, err := s.appRepo.FindByID(&user.TenantID, appID)
+	if err != nil {
+		return nil, notFound(err, ErrAppNotFound)
+	}
+	if !isSubset(scopes, app.ScopeList()) {
+		return nil, ErrUnknownScope
+	}
+	if perm, err := s.appRepo.FindPermission(userID, appID); err == nil && isSubset(scopes, perm.ScopeList()) {
+		return nil, ErrAlreadyPermitted
+	}
+
+	request := &models.AccessRequest{
+		UserID:    userID,
+		AppID:     &app.ID,
+		PackageID: app.PackageID,
+		Scopes:    joinScopes(scopes),
+		Reason:    strings.TrimSpace(reason),
+		Status:    models.AccessRequestPending,
+	}
+	if err := s.requestRepo.Create(request); err != nil {
+		if errors.Is(err, repository.ErrAccessRequestPending) {
+			return nil, ErrAccessRequestPending
+		}
+		return nil, err
+	}
+	return request, nil
+}
+
+// ListAppRequests returns one page of the access requests for an app,
+// newest first; page is 1-based. A non-empty status only lists the requests
+// with that status.
+func (s *AccessRequestService) ListAppRequests(actor Actor, appID uuid.UUID, status string, page, pageSize int) (*AccessRequestPage, error) {
+	switch status {
+	case "", models.AccessRequestPending, models.AccessRequestApproved, models.AccessRequestDenied:
+	default:
+		return nil, ErrInvalidRequestStatus
+	}
+	app, err := s.appRepo.FindByID(actor.tenantScope(), appID)
+	if err != nil {
+		return nil, notFound(err, ErrAppNotFound)
+	}
+	if !actor.CanManageApp(app) {
+		return nil, ErrAppNotFound
+	}
+
+	requests, total, err := s.requestRepo.ListForApp(appID, status, (page-1)*pageSize, pageSize)
+	if err != nil {
+		return nil, err
+	}
+	return &AccessRequestPage{Requests: requests, Page: page, PageSize: pageSize, Total: total}, nil
+}
+
+// ApproveRequest grants a pending request's app to its user with the
+// requested scopes or, if scopes is non-nil, with scopes instead. If the
+// user already has a direct grant for the app that has not ended, the
+// scopes are added to it and, unless window is non-nil, its validity window
+// is kept. Otherwise the grant is limited to window, or permanent if window
+// is nil.
+func (s *AccessRequestService) ApproveRequest(actor Actor, requestID uuid.UUID, scopes []string, window *GrantWindow, note string) (*models.AccessRequest, error) {
+	request, err := s.pendingRequest(actor, requestID)
+	if err != nil {
+		return nil, err
+	}
+	if scopes == nil {
+		scopes = request.ScopeList()
+	}
+	if !isSubset(scopes, request.App.ScopeList()) {
+		return nil, ErrUnknownScope
+	}
+	if window != nil {
+		if err := window.validate(); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := s.userRepo.FindByID(&request.App.TenantID, request.UserID); err != nil {
+		return nil, notFound(err, ErrUserNotFound)
+	}
+
+	existing, err := s.permRepo.ForApp(request.App.ID, []uuid.UUID{request.UserID})
+	if err != nil {
+		return nil, err
+	}
+	if len(existing) > 0 && !grantEnded(&existing[0]) {
+		scopes = append(existing[0].ScopeList(), scopes...)
+		if window == nil {
+			window = &GrantWindow{ValidFrom: existing[0].ValidFrom, ValidUntil: existing[0].ValidUntil}
+		}
+	}
+	if window == nil {
+		window = &GrantWindow{}
+	}
+
+	perm := &models.UserAppPermission{
+		UserID:     request.UserID,
+		AppID:      request.App.ID,
+		Scopes:     joinScopes(scopes),
+		ValidFrom:  window.ValidFrom,
+		ValidUntil: window.ValidUntil,
+	}
+	return s.decide(actor, request, models.AccessRequestApproved, note, perm)
+}
+
+// grantEnded reports whether the validity window of perm has ended.
+func grantEnded(perm *models.UserAppPermission) bool {
+	return perm.ValidUntil != nil && !perm.ValidUntil.After(time.Now())
+}
+
+// DenyRequest rejects a pending request.
+func (s *AccessRequestService) DenyRequest(actor Actor, requestID uuid.UUID, note string) (*models.AccessRequest, error) {
+	request, err := s.pendingRequest(actor, requestID)
+	if err != nil {
+		return nil, err
+	}
+	return s.decide(actor, request, models.AccessRequestDenied, note, nil)
+}
+
+// pendingRequest returns a request with its app, or ErrAccessRequestNotFound
+// unless it exists, its app has not been deleted and actor may manage the
+// app, or ErrAccessRequestDecided if it is no longer pending.
+func (s *AccessRequestService) pendingRequest(actor Actor, requestID uuid.UUID) (*models.AccessRequest, error) {
+	request, err := s.requestRepo.FindByID(requestID)
+	if err != nil {
+		return nil, notFound(err, ErrAccessRequestNotFound)
+	}
+	if request.App == nil || !actor.CanManageApp(request.App) {
+		return nil, ErrAccessRequestNotFound
+	}
+	if request.Status != models.AccessRequestPending {
+		return nil, ErrAccessRequestDecided
+	}
+	return request, nil
+}
+
+// decide records actor's decision on request, granting perm if non-nil.
+func (s *AccessRequestService) decide(actor Actor, request *models.AccessRequest, status, note string, perm *models.UserAppPermission) (*models.AccessRequest, error) {
+	now := time.Now()
+	request.Status = status
+	request.DecidedBy = &actor.UserID
+	request.DecidedAt = &now
+	request.Note = strings.TrimSpace(note)
+
+	if err := s.requestRepo.Decide(request, perm); err != nil {
+		if errors.Is(err, repository.ErrAccessRequestDecided) {
+			return nil, ErrAccessRequestDecided
+		}
+		return nil, err
+	}
+	return request, nil
+}
@@ -0,0 +1,234 @@
+package service
+
+import (
+	"errors"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/cachatto/master-slave-server/internal/models"
+	"github.com/cachatto/master-slave-server/internal/repository"
+	"github.com/google/uuid"
+)
+
+// Common errors returned by AppService.
+var (
+	ErrPackageIDTaken        = errors.New("an app with this package_id is already registered")
+	ErrInvalidAppName        = errors.New("app_name must be between 1 and 255 characters")
+	ErrInvalidPackageID      = errors.New("package_id must be in reverse-DNS format, e.g. com.example.app")
+	ErrInvalidDeepLinkScheme = errors.New("deep_link_scheme must be a custom URI scheme followed by ://, e.g. exampleapp://")
+	ErrInvalidRedirectURIs   = errors.New("redirect_uris must be absolute URIs without fragments")
+	ErrInvalidOwner          = errors.New("owner_id must be an app-admin or admin of the app's tenant")
+)
+
+var (
+	// packageIDPattern matches reverse-DNS identifiers with at least two labels.
+	packageIDPattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_-]*(\.[A-Za-z][A-Za-z0-9_-]*)+$`)
+	// deepLinkSchemePattern matches an RFC 3986 scheme followed by "://".
+	deepLinkSchemePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9+.-]*://$`)
+)
+
+// reservedSchemes cannot be used as deep link schemes: codes would be sent
+// to the web or to script URLs instead of the slave app, and any URI with
+// the app's scheme is accepted as an OIDC redirect URI.
+var reservedSchemes = map[string]bool{
+	"http":       true,
+	"https":      true,
+	"javascript": true,
+	"data":       true,
+	"file":       true,
+	"vbscript":   true,
+}
+
+// AppInput holds the fields of a slave app that admins can set. Nil fields
+// are left unchanged on update; an OwnerID of uuid.Nil removes the owner.
+// TenantID is only read on create.
+type AppInput struct {
+	TenantID       *uuid.UUID
+	AppName        *string
+	PackageID      *string
+	DeepLinkScheme *string
+	RedirectURIs   []string
+	RequirePKCE    *bool
+	OwnerID        *uuid.UUID
+	Scopes         []string
+}
+
+// AppPage is one page of the app registry.
+type AppPage struct {
+	Apps     []models.App `json:"apps"`
+	Page     int          `json:"page"`
+	PageSize int          `json:"page_size"`
+	Total    int64        `json:"total"`
+}
+
+// AppService manages the slave app registry.
+//
+// Superadmins manage every app and tenant-admins the apps of their tenant.
+// App-admins only see and edit the apps they own; other apps are reported
+// as not found.
+type AppService struct {
+	appRepo       *repository.AppRepository
+	userRepo      *repository.UserRepository
+	tenantService *TenantService
+}
+
+// NewAppService creates a new AppService.
+func NewAppService(appRepo *repository.AppRepository, userRepo *repository.UserRepository, tenantService *TenantService) *AppService {
+	return &AppService{appRepo: appRepo, userRepo: userRepo, tenantService: tenantService}
+}
+
+// CreateApp registers a new slave app in the actor's tenant, or in
+// input.TenantID for superadmins. AppName, PackageID and DeepLinkScheme are
+// required.
+func (s *AppService) CreateApp(actor Actor, input *AppInput) (*models.App, error) {
+	tenantID, err := s.tenantService.targetTenant(actor, input.TenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	app := &models.App{TenantID: tenantID}
+	if err := applyAppInput(app, input); err != nil {
+		return nil, err
+	}
+	if err := s.applyOwner(app, input.OwnerID); err != nil {
+		return nil, err
+	}
+
+	if err := s.appRepo.Create(app); err != nil {
+		if errors.Is(err, repository.ErrPackageIDTaken) {
+			return nil, ErrPackageIDTaken
+		}
+		return nil, err
+	}
+	return app, nil
+}
+
+// ListApps returns one page of the apps actor may manage; page is 1-based.
+func (s *AppService) ListApps(actor Actor, page, pageSize int) (*AppPage, error) {
+	apps, total, err := s.appRepo.List(actor.tenantScope(), actor.ownerScope(), (page-1)*pageSize, pageSize)
+	if err != nil {
+		return nil, err
+	}
+	return &AppPage{Apps: apps, Page: page, PageSize: pageSize, Total: total}, nil
+}
+
+// GetApp returns a single app.
+func (s *AppService) GetApp(actor Actor, appID uuid.UUID) (*models.App, error) {
+	app, err := s.appRepo.FindByID(actor.tenantScope(), appID)
+	if err != nil {
+		return nil, notFound(err, ErrAppNotFound)
+	}
+	if !actor.CanManageApp(app) {
+		return nil, ErrAppNotFound
+	}
+	return app, nil
+}
+
+// UpdateApp changes the given fields of an app. Only actors allowed to
+// create apps may change the owner.
+func (s *AppService) UpdateApp(actor Actor, appID uuid.UUID, input *AppInput) (*models.App, error) {
+	app, err := s.GetApp(actor, appID)
+	if err != nil {
+		return nil, err
+	}
+	if input.OwnerID != nil && !actor.Can(PermCreateApps) {
+		return nil, ErrForbidden
+	}
+	if err := applyAppInput(app, input); err != nil {
+		return nil, err
+	}
+	if err := s.applyOwner(app, input.OwnerID); err != nil {
+		return nil, err
+	}
+
+	if err := s.appRepo.Update(app); err != nil {
+		if errors.Is(err, repository.ErrPackageIDTaken) {
+			return nil, ErrPackageIDTaken
+		}
+		return nil, err
+	}
+	return app, nil
+}
+
+// DeleteApp removes an app together with its permissions, outstanding codes
+// and sessions.
+func (s *AppService) DeleteApp(actor Actor, appID uuid.UUID) error {
+	if _, err := s.GetApp(actor, appID); err != nil {
+		return err
+	}
+	if err := s.appRepo.Delete(appID); err != nil {
+		return notFound(err, ErrAppNotFound)
+	}
+	return nil
+}
+
+// applyOwner validates and sets the owner of app if ownerID is not nil. The
+// owner must be an admin of the app's tenant, or a superadmin.
+func (s *AppService) applyOwner(app *models.App, ownerID *uuid.UUID) error {
+	if ownerID == nil {
+		return nil
+	}
+	if *ownerID == uuid.Nil {
+		app.OwnerID = nil
+		return nil
+	}
+
+	// Superadmins may own apps of any tenant, so the owner is looked up in
+	// every tenant and checked below
+	owner, err := s.userRepo.FindByID(nil, *ownerID)
+	if err != nil {
+		return notFound(err, ErrInvalidOwner)
+	}
+	tenantAdmin := (owner.Role == RoleAppAdmin || owner.Role == RoleTenantAdmin) && owner.TenantID == app.TenantID
+	if owner.Role != RoleSuperadmin && !tenantAdmin {
+		return ErrInvalidOwner
+	}
+	app.OwnerID = &owner.ID
+	return nil
+}
+
+// applyAppInput validates input and copies the set fields onto app.
+func applyAppInput(app *models.App, input *AppInput) error {
+	if input.AppName != nil {
+		app.AppName = strings.TrimSpace(*input.AppName)
+	}
+	if input.PackageID != nil {
+		app.PackageID = strings.TrimSpace(*input.PackageID)
+	}
+	if input.DeepLinkScheme != nil {
+		app.DeepLinkScheme = strings.TrimSpace(*input.DeepLinkScheme)
+	}
+	if input.RedirectURIs != nil {
+		for _, uri := range input.RedirectURIs {
+			u, err := url.Parse(uri)
+			if err != nil || !u.IsAbs() || u.Fragment != "" || strings.ContainsAny(uri, " \t\r\n") {
+				return ErrInvalidRedirectURIs
+			}
+		}
+		app.RedirectURIs = strings.Join(input.RedirectURIs, " ")
+	}
+	if input.RequirePKCE != nil {
+		app.RequirePKCE = *input.RequirePKCE
+	}
+	if input.Scopes != nil {
+		if err := validateScopes(input.Scopes); err != nil {
+			return err
+		}
+		app.Scopes = joinScopes(input.Scopes)
+	}
+
+	if app.AppName == "" || len(app.AppName) > 255 {
+		return ErrInvalidAppName
+	}
+	if !packageIDPattern.MatchString(app.PackageID) || len(app.PackageID) > 255 {
+		return ErrInvalidPackageID
+	}
+	if !deepLinkSchemePattern.MatchString(app.DeepLinkScheme) || len(app.DeepLinkScheme) > 255 {
+		return ErrInvalidDeepLinkScheme
+	}
+	if scheme, _, _ := strings.Cut(app.DeepLinkScheme, ":"); reservedSchemes[strings.ToLower(scheme)] {
+		return ErrInvalidDeepLinkScheme
+	}
+	return nil
+}
@@ -2,14 +2,18 @@ package service
 
 import (
 	"errors"
+	"log"
+	"strings"
 	"time"
 
 	"github.com/cachatto/master-slave-server/internal/config"
+	"github.com/cachatto/master-slave-server/internal/limiter"
 	"github.com/cachatto/master-slave-server/internal/models"
+	"github.com/cachatto/master-slave-server/internal/pwhash"
 	"github.com/cachatto/master-slave-server/internal/repository"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
-	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 )
 
 // Common errors returned by AuthService.
@@ -18,62 +22,386 @@ var (
 	ErrUserNotFound       = errors.New("user not found")
 	ErrInvalidToken       = errors.New("invalid or expired token")
 	ErrInvalidTokenType   = errors.New("invalid token type")
+	ErrTokenReused        = errors.New("refresh token has already been used; session revoked")
+	ErrSessionRevoked     = errors.New("session has been revoked")
+	ErrMFANotPending      = errors.New("no two-factor authentication is pending for this token")
+	ErrEmailNotVerified   = errors.New("email address has not been verified")
+	ErrUserDisabled       = errors.New("account has been disabled")
 )
 
+// MasterAudience is the "aud" claim of tokens issued to the Master app.
+// Tokens claimed by a slave app carry that app's package ID instead.
+const MasterAudience = "master-slave-server"
+
 // TokenPair holds an access token and a refresh token.
 type TokenPair struct {
 	AccessToken  string `json:"access_token"`
 	RefreshToken string `json:"refresh_token"`
 }
 
+// LoginResult is returned by Login. Either Tokens is set, or the account
+// has two-factor authentication enabled and MFAToken must be exchanged at
+// /auth/login/mfa together with a TOTP or recovery code.
+type LoginResult struct {
+	Tokens   *TokenPair
+	MFAToken string
+}
+
 // UserProfile is the public profile returned by verify.
 type UserProfile struct {
-	ID    uuid.UUID   `json:"id"`
-	Email string      `json:"email"`
-	Apps  []uuid.UUID `json:"authorized_apps"`
+	ID       uuid.UUID   `json:"id"`
+	TenantID uuid.UUID   `json:"tenant_id"`
+	Email    string      `json:"email"`
+	Role     string      `json:"role"`
+	Apps     []uuid.UUID `json:"authorized_apps"`
 }
 
 // JWTClaims are the custom claims embedded in each token.
 type JWTClaims struct {
-	UserID uuid.UUID `json:"user_id"`
-	Email  string    `json:"email"`
-	Type   string    `json:"type"` // "access" or "refresh"
+	UserID    uuid.UUID  `json:"user_id"`
+	TenantID  uuid.UUID  `json:"tid"` // tenant of the user
+	Email     string     `json:"email"`
+	Type      string     `json:"type"` // "access", "refresh" or "mfa"
+	SessionID uuid.UUID  `json:"sid"`  // refresh token family the token belongs to
+	AppID     *uuid.UUID `json:"app_id,omitempty"`
+	AuthParty string     `json:"azp,omitempty"`   // package ID of the slave app the token was issued to
+	Role      string     `json:"role,omitempty"`  // user's role; only in Master app access tokens
+	Scope     string     `json:"scope,omitempty"` // space-separated app scopes granted to the user; only in slave app access tokens
+	jwt.RegisteredClaims
+}
+
+// IDTokenClaims are the claims of an OpenID Connect ID token.
+type IDTokenClaims struct {
+	TenantID  uuid.UUID        `json:"tid"`
+	Email     string           `json:"email"`
+	Nonce     string           `json:"nonce,omitempty"`
+	AuthTime  *jwt.NumericDate `json:"auth_time"`
+	AuthParty string           `json:"azp"`
 	jwt.RegisteredClaims
 }
 
 // AuthService handles login, token verification, and token refresh.
+// Failed logins are counted per client IP (ipLimiter) and per account (on
+// the user record, following accountPolicy). Logins for emails without an
+// account are counted per email in unknownLimiter under the same policy, so
+// they are locked out exactly like real accounts.
 type AuthService struct {
-	userRepo *repository.UserRepository
-	appRepo  *repository.AppRepository
-	cfg      *config.Config
+	userRepo       *repository.UserRepository
+	appRepo        *repository.AppRepository
+	refreshRepo    *repository.RefreshTokenRepository
+	tenantService  *TenantService
+	keys           *KeySet
+	hasher         *pwhash.Hasher
+	mfaService     *MFAService
+	ipLimiter      limiter.Limiter
+	unknownLimiter limiter.Limiter
+	accountPolicy  limiter.Policy
+	cfg            *config.Config
 }
 
 // NewAuthService creates a new AuthService.
-func NewAuthService(userRepo *repository.UserRepository, appRepo *repository.AppRepository, cfg *config.Config) *AuthService {
+func NewAuthService(
+	userRepo *repository.UserRepository,
+	appRepo *repository.AppRepository,
+	refreshRepo *repository.RefreshTokenRepository,
+	tenantService *TenantService,
+	keys *KeySet,
+	hasher *pwhash.Hasher,
+	mfaService *MFAService,
+	ipLimiter limiter.Limiter,
+	unknownLimiter limiter.Limiter,
+	cfg *config.Config,
+) *AuthService {
 	return &AuthService{
-		userRepo: userRepo,
-		appRepo:  appRepo,
-		cfg:      cfg,
+		userRepo:       userRepo,
+		appRepo:        appRepo,
+		refreshRepo:    refreshRepo,
+		tenantService:  tenantService,
+		keys:           keys,
+		hasher:         hasher,
+		mfaService:     mfaService,
+		ipLimiter:      ipLimiter,
+		unknownLimiter: unknownLimiter,
+		accountPolicy: limiter.Policy{
+			MaxFailures: cfg.LoginMaxFailuresPerAccount,
+			BaseLockout: cfg.LoginLockoutBase,
+			MaxLockout:  cfg.LoginLockoutMax,
+			Window:      cfg.LoginFailureWindow,
+		},
+		cfg: cfg,
 	}
 }
 
-// Login validates credentials and returns a token pair.
-func (s *AuthService) Login(email, password string) (*TokenPair, error) {
-	user, err := s.userRepo.FindByEmail(email)
+// Login validates the credentials of a user of the tenant with the given
+// slug (the default tenant if empty) and returns a token pair, or an MFA
+// challenge token if the user has two-factor authentication enabled.
+func (s *AuthService) Login(tenant, email, password, clientIP string) (*LoginResult, error) {
+	t, err := s.tenantService.tenantBySlug(tenant)
 	if err != nil {
-		return nil, ErrInvalidCredentials
+		if !errors.Is(err, ErrTenantNotFound) {
+			return nil, err
+		}
+		// Unknown tenants look like unknown emails
+		t = &models.Tenant{}
+	}
+	user, err := s.Authenticate(t.ID, email, password, clientIP)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.TOTPEnabledAt != nil {
+		mfaToken, err := s.generateMFAChallenge(user)
+		if err != nil {
+			return nil, err
+		}
+		return &LoginResult{MFAToken: mfaToken}, nil
+	}
+
+	tokens, err := s.generateTokenPair(user, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &LoginResult{Tokens: tokens}, nil
+}
+
+// LoginMFA completes a two-step login: it validates the MFA challenge token
+// issued by Login and the second factor, then returns a token pair.
+func (s *AuthService) LoginMFA(mfaToken, code, clientIP string) (*TokenPair, error) {
+	claims, err := s.parseToken(mfaToken, MasterAudience)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Type != "mfa" {
+		return nil, ErrInvalidTokenType
+	}
+
+	user, err := s.userRepo.FindByID(&claims.TenantID, claims.UserID)
+	if err != nil {
+		return nil, notFound(err, ErrUserNotFound)
+	}
+	if user.TOTPEnabledAt == nil {
+		return nil, ErrMFANotPending
+	}
+
+	if err := s.VerifySecondFactor(user, code, clientIP); err != nil {
+		return nil, err
+	}
+
+	return s.generateTokenPair(user, nil, nil, nil)
+}
+
+// IssueTokenPair creates a Master app token pair for a user who has already
+// been authenticated without a password (e.g. with a passkey).
+func (s *AuthService) IssueTokenPair(user *models.User) (*TokenPair, error) {
+	return s.generateTokenPair(user, nil, nil, nil)
+}
+
+// VerifySecondFactor checks a TOTP or recovery code for a user who already
+// passed the password check. Failures count towards the same IP and account
+// lockouts as wrong passwords.
+func (s *AuthService) VerifySecondFactor(user *models.User, code, clientIP string) error {
+	if err := s.checkLockout(user, clientIP); err != nil {
+		return err
+	}
+
+	if err := s.mfaService.verifySecondFactor(user, code); err != nil {
+		if errors.Is(err, ErrInvalidMFACode) {
+			if err := s.recordLoginFailure(user, clientIP); err != nil {
+				return err
+			}
+		}
+		return err
+	}
+
+	return s.resetLoginFailures(user)
+}
+
+// DisableTOTP turns off a user's two-factor authentication after verifying
+// a current TOTP or recovery code with VerifySecondFactor, so wrong codes
+// count towards the lockouts.
+func (s *AuthService) DisableTOTP(userID uuid.UUID, code, clientIP string) error {
+	user, err := s.mfaService.enabledUser(userID)
+	if err != nil {
+		return err
+	}
+	if err := s.VerifySecondFactor(user, code, clientIP); err != nil {
+		return err
+	}
+	return s.mfaService.disableTOTP(user.ID)
+}
+
+// RegenerateRecoveryCodes replaces a user's recovery codes after verifying
+// a current TOTP or recovery code with VerifySecondFactor.
+func (s *AuthService) RegenerateRecoveryCodes(userID uuid.UUID, code, clientIP string) ([]string, error) {
+	user, err := s.mfaService.enabledUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.VerifySecondFactor(user, code, clientIP); err != nil {
+		return nil, err
+	}
+	return s.mfaService.issueRecoveryCodes(user.ID)
+}
+
+// Authenticate validates the credentials of a user of tenantID and returns
+// the user without issuing tokens.
+// While the client IP or the account is locked out after repeated failures,
+// a *limiter.LockedError is returned without checking the password.
+// Users with two-factor authentication must additionally pass
+// VerifySecondFactor; their failure counter is only reset once they do.
+// Users who have not verified their email get ErrEmailNotVerified, and
+// users disabled by an admin get ErrUserDisabled.
+// A password hash that uses an outdated algorithm or cost is re-hashed.
+func (s *AuthService) Authenticate(tenantID uuid.UUID, email, password, clientIP string) (*models.User, error) {
+	if err := s.checkLockout(nil, clientIP); err != nil {
+		return nil, err
+	}
+
+	user, err := s.userRepo.FindByEmail(tenantID, normalizeEmail(email))
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		return nil, s.rejectUnknownEmail(tenantID, normalizeEmail(email), password, clientIP)
+	}
+
+	if err := s.checkLockout(user, ""); err != nil {
+		return nil, err
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+	ok, rehash, _ := s.hasher.Verify(user.PasswordHash, password)
+	if !ok {
+		if err := s.recordLoginFailure(user, clientIP); err != nil {
+			return nil, err
+		}
 		return nil, ErrInvalidCredentials
 	}
 
-	return s.generateTokenPair(user)
+	// Upgrade hashes from a legacy algorithm or outdated cost parameters
+	// while the plaintext password is at hand. The old hash still works,
+	// so a failed upgrade is retried on the next login instead of failing
+	// this one.
+	if rehash {
+		if err := s.rehashPassword(user, password); err != nil {
+			log.Printf("⚠️  Failed to upgrade password hash of user %s: %v", user.ID, err)
+		}
+	}
+
+	if user.TOTPEnabledAt == nil {
+		if err := s.resetLoginFailures(user); err != nil {
+			return nil, err
+		}
+	}
+
+	if user.EmailVerifiedAt == nil {
+		return nil, ErrEmailNotVerified
+	}
+	if user.DisabledAt != nil {
+		return nil, ErrUserDisabled
+	}
+
+	return user, nil
+}
+
+// rejectUnknownEmail fails a login for an email without an account the way
+// a wrong password for a real account fails: after the same time spent
+// verifying, and with the same lockout once the email has failed too often.
+// It returns the error to respond with.
+func (s *AuthService) rejectUnknownEmail(tenantID uuid.UUID, email, password, clientIP string) error {
+	key := tenantID.String() + "|" + email
+	wait, err := s.unknownLimiter.Check(key)
+	if err != nil {
+		return err
+	}
+	if wait > 0 {
+		return &limiter.LockedError{RetryAfter: wait}
+	}
+
+	s.hasher.VerifyDummy(password)
+	if _, err := s.ipLimiter.Fail(clientIP); err != nil {
+		return err
+	}
+	if _, err := s.unknownLimiter.Fail(key); err != nil {
+		return err
+	}
+	return ErrInvalidCredentials
+}
+
+// rehashPassword replaces the user's password hash with a fresh hash of
+// password from the current algorithm.
+func (s *AuthService) rehashPassword(user *models.User, password string) error {
+	hash, err := s.hasher.Hash(password)
+	if err != nil {
+		return err
+	}
+	if err := s.userRepo.UpdatePasswordHash(user.ID, user.PasswordHash, hash); err != nil {
+		return err
+	}
+	user.PasswordHash = hash
+	return nil
+}
+
+// UnlockUser clears a user's failed-login counter and lockout (admin
+// action; the caller checks that the admin may manage the user).
+func (s *AuthService) UnlockUser(userID uuid.UUID) error {
+	return s.userRepo.ResetLoginFailures(userID)
+}
+
+// CleanLimiters drops expired failed-login counters (call periodically).
+func (s *AuthService) CleanLimiters() error {
+	if err := s.ipLimiter.Cleanup(); err != nil {
+		return err
+	}
+	return s.unknownLimiter.Cleanup()
+}
+
+// checkLockout returns a *limiter.LockedError if the client IP (when
+// non-empty) or the account (when non-nil) is locked out.
+func (s *AuthService) checkLockout(user *models.User, clientIP string) error {
+	if clientIP != "" {
+		ipWait, err := s.ipLimiter.Check(clientIP)
+		if err != nil {
+			return err
+		}
+		if ipWait > 0 {
+			return &limiter.LockedError{RetryAfter: ipWait}
+		}
+	}
+
+	if user != nil && user.LockedUntil != nil && time.Now().Before(*user.LockedUntil) {
+		return &limiter.LockedError{RetryAfter: time.Until(*user.LockedUntil)}
+	}
+	return nil
+}
+
+// resetLoginFailures clears the account's failure counter after a successful login.
+func (s *AuthService) resetLoginFailures(user *models.User) error {
+	if user.FailedLoginCount == 0 && user.LockedUntil == nil {
+		return nil
+	}
+	return s.userRepo.ResetLoginFailures(user.ID)
+}
+
+// recordLoginFailure counts a wrong password against the client IP and the
+// account, locking the account once it exceeds the configured threshold.
+func (s *AuthService) recordLoginFailure(user *models.User, clientIP string) error {
+	if _, err := s.ipLimiter.Fail(clientIP); err != nil {
+		return err
+	}
+
+	failures, err := s.userRepo.RecordLoginFailure(user.ID, s.accountPolicy.Window)
+	if err != nil {
+		return err
+	}
+	if lockout := s.accountPolicy.Lockout(failures); lockout > 0 {
+		return s.userRepo.Lock(user.ID, time.Now().Add(lockout))
+	}
+	return nil
 }
 
 // VerifyToken parses an access token and returns the user profile with permitted apps.
 func (s *AuthService) VerifyToken(tokenString string) (*UserProfile, error) {
-	claims, err := s.parseToken(tokenString)
+	claims, err := s.parseToken(tokenString, MasterAudience)
 	if err != nil {
 		return nil, err
 	}
@@ -82,12 +410,12 @@ func (s *AuthService) VerifyToken(tokenString string) (*UserProfile, error) {
 		return nil, ErrInvalidTokenType
 	}
 
-	user, err := s.userRepo.FindByID(claims.UserID)
+	user, err := s.userRepo.FindByID(&claims.TenantID, claims.UserID)
 	if err != nil {
-		return nil, ErrUserNotFound
+		return nil, notFound(err, ErrUserNotFound)
 	}
 
-	apps, err := s.appRepo.GetPermittedApps(user.ID)
+	apps, err := s.appRepo.GetPermittedApps(&user.TenantID, user.ID)
 	if err != nil {
 		return nil, err
 	}
@@ -98,15 +426,33 @@ func (s *AuthService) VerifyToken(tokenString string) (*UserProfile, error) {
 	}
 
 	return &UserProfile{
-		ID:    user.ID,
-		Email: user.Email,
-		Apps:  appIDs,
+		ID:       user.ID,
+		TenantID: user.TenantID,
+		Email:    user.Email,
+		Role:     user.Role,
+		Apps:     appIDs,
 	}, nil
 }
 
-// RefreshToken validates a refresh token and returns a new token pair.
+// RefreshToken validates a refresh token, rotates it, and returns a new token pair.
+// Presenting a token that was already rotated is treated as theft: the whole
+// token family is revoked and ErrTokenReused is returned.
 func (s *AuthService) RefreshToken(refreshToken string) (*TokenPair, error) {
-	claims, err := s.parseToken(refreshToken)
+	return s.refreshTokenPair(refreshToken, nil)
+}
+
+// RefreshTokenForApp is RefreshToken for an OIDC client: the refresh token
+// must have been issued to the app identified by appID.
+func (s *AuthService) RefreshTokenForApp(refreshToken string, appID uuid.UUID) (*TokenPair, error) {
+	return s.refreshTokenPair(refreshToken, &appID)
+}
+
+// refreshTokenPair implements RefreshToken. A non-nil appID restricts the
+// refresh to tokens issued to that app.
+func (s *AuthService) refreshTokenPair(refreshToken string, appID *uuid.UUID) (*TokenPair, error) {
+	// The audience is taken from the stored token rather than checked here,
+	// so Master and slave app refresh tokens share this endpoint.
+	claims, err := s.parseToken(refreshToken, "")
 	if err != nil {
 		return nil, err
 	}
@@ -115,71 +461,261 @@ func (s *AuthService) RefreshToken(refreshToken string) (*TokenPair, error) {
 		return nil, ErrInvalidTokenType
 	}
 
-	user, err := s.userRepo.FindByID(claims.UserID)
+	jti, err := uuid.Parse(claims.ID)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	stored, err := s.refreshRepo.FindByID(jti)
+	if err != nil {
+		return nil, notFound(err, ErrInvalidToken)
+	}
+	if stored.UserID != claims.UserID {
+		return nil, ErrInvalidToken
+	}
+
+	if stored.RevokedAt != nil {
+		return nil, ErrInvalidToken
+	}
+
+	if appID != nil && (stored.AppID == nil || *stored.AppID != *appID) {
+		return nil, ErrInvalidToken
+	}
+
+	if stored.RotatedAt != nil {
+		return nil, s.revokeReusedFamily(stored)
+	}
+
+	user, err := s.userRepo.FindByID(&claims.TenantID, claims.UserID)
 	if err != nil {
-		return nil, ErrUserNotFound
+		return nil, notFound(err, ErrUserNotFound)
 	}
 
-	return s.generateTokenPair(user)
+	var app *models.App
+	var scopes []string
+	if stored.AppID != nil {
+		app, err = s.appRepo.FindByID(&user.TenantID, *stored.AppID)
+		if err != nil {
+			return nil, notFound(err, ErrInvalidToken)
+		}
+		// Scopes withdrawn from the user since the last refresh are dropped
+		scopes, err = s.grantedScopes(user, app, strings.Fields(stored.Scope))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return s.generateTokenPair(user, app, scopes, stored)
+}
+
+// GenerateTokenPairForApp creates a token pair for a user that is scoped to a
+// slave app: "aud" and "azp" are set to the app's package ID (used by OTC service).
+// The "scope" claim holds the requested scopes that the user is still
+// granted; ErrNoPermission is returned if the user may not use the app.
+func (s *AuthService) GenerateTokenPairForApp(userID uuid.UUID, app *models.App, scopes []string) (*TokenPair, error) {
+	user, err := s.userRepo.FindByID(&app.TenantID, userID)
+	if err != nil {
+		return nil, notFound(err, ErrUserNotFound)
+	}
+	granted, err := s.grantedScopes(user, app, scopes)
+	if err != nil {
+		return nil, err
+	}
+	return s.generateTokenPair(user, app, granted, nil)
 }
 
-// GenerateTokenPairForUser creates a token pair for a given user (used by OTC service).
-func (s *AuthService) GenerateTokenPairForUser(userID uuid.UUID) (*TokenPair, error) {
-	user, err := s.userRepo.FindByID(userID)
+// grantedScopes narrows requested down to the scopes the user's permission
+// for app grants and the app still declares. Apps of another tenant are
+// never permitted.
+func (s *AuthService) grantedScopes(user *models.User, app *models.App, requested []string) ([]string, error) {
+	if user.TenantID != app.TenantID {
+		return nil, ErrNoPermission
+	}
+	perm, err := s.appRepo.FindPermission(user.ID, app.ID)
 	if err != nil {
-		return nil, ErrUserNotFound
+		return nil, notFound(err, ErrNoPermission)
 	}
-	return s.generateTokenPair(user)
+	return intersectScopes(requested, perm.ScopeList(), app.ScopeList()), nil
 }
 
-// ParseAccessToken parses and validates an access token, returning the claims.
-func (s *AuthService) ParseAccessToken(tokenString string) (*JWTClaims, error) {
-	claims, err := s.parseToken(tokenString)
+// CleanExpiredRefreshTokens removes all expired refresh tokens (call periodically).
+func (s *AuthService) CleanExpiredRefreshTokens() error {
+	return s.refreshRepo.CleanExpired()
+}
+
+// ParseAccessToken parses and validates an access token issued for audience,
+// returning the claims. An empty audience accepts tokens issued to any app.
+// Tokens whose session has been revoked by logout are rejected.
+func (s *AuthService) ParseAccessToken(tokenString, audience string) (*JWTClaims, error) {
+	claims, err := s.parseToken(tokenString, audience)
 	if err != nil {
 		return nil, err
 	}
 	if claims.Type != "access" {
 		return nil, ErrInvalidTokenType
 	}
+
+	active, err := s.refreshRepo.IsFamilyActive(claims.SessionID)
+	if err != nil {
+		return nil, err
+	}
+	if !active {
+		return nil, ErrSessionRevoked
+	}
 	return claims, nil
 }
 
-// generateTokenPair creates both access and refresh tokens for a user.
-func (s *AuthService) generateTokenPair(user *models.User) (*TokenPair, error) {
+// Logout revokes a single session (the refresh token family behind sessionID).
+func (s *AuthService) Logout(sessionID uuid.UUID) error {
+	return s.refreshRepo.RevokeFamily(sessionID)
+}
+
+// LogoutAll revokes every session of a user, including slave app sessions
+// created through the OTC handshake.
+func (s *AuthService) LogoutAll(userID uuid.UUID) error {
+	return s.refreshRepo.RevokeAllForUser(userID)
+}
+
+// GenerateIDToken creates an OpenID Connect ID token for a user signed in to app.
+func (s *AuthService) GenerateIDToken(user *models.User, app *models.App, nonce string, authTime time.Time) (string, error) {
+	now := time.Now()
+	claims := IDTokenClaims{
+		TenantID:  user.TenantID,
+		Email:     user.Email,
+		Nonce:     nonce,
+		AuthTime:  jwt.NewNumericDate(authTime),
+		AuthParty: app.PackageID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   user.ID.String(),
+			Audience:  jwt.ClaimStrings{app.PackageID},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.cfg.JWTAccessExpiry)),
+			Issuer:    s.cfg.OIDCIssuer,
+		},
+	}
+	return s.keys.Sign(claims)
+}
+
+// generateMFAChallenge creates the short-lived token that carries a
+// password-verified login over to the second factor step.
+func (s *AuthService) generateMFAChallenge(user *models.User) (string, error) {
+	now := time.Now()
+	claims := JWTClaims{
+		UserID:   user.ID,
+		TenantID: user.TenantID,
+		Email:    user.Email,
+		Type:     "mfa",
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			Subject:   user.ID.String(),
+			Audience:  jwt.ClaimStrings{MasterAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.cfg.MFAChallengeExpiry)),
+			Issuer:    "master-slave-server",
+		},
+	}
+	return s.keys.Sign(claims)
+}
+
+// revokeReusedFamily revokes the family of a replayed refresh token and
+// returns the error to report to the caller.
+func (s *AuthService) revokeReusedFamily(token *models.RefreshToken) error {
+	if err := s.refreshRepo.RevokeFamily(token.FamilyID); err != nil {
+		return err
+	}
+	return ErrTokenReused
+}
+
+// generateTokenPair creates both access and refresh tokens for a user and
+// persists the refresh token. A nil app issues Master app tokens; otherwise the
+// tokens are scoped to the slave app and carry the granted scopes. A nil
+// parent starts a new token family; otherwise the parent is rotated into the
+// new token. Disabled users get ErrUserDisabled, whichever way they
+// authenticated.
+func (s *AuthService) generateTokenPair(user *models.User, app *models.App, scopes []string, parent *models.RefreshToken) (*TokenPair, error) {
+	if user.DisabledAt != nil {
+		return nil, ErrUserDisabled
+	}
+
 	now := time.Now()
 
+	record := &models.RefreshToken{
+		ID:        uuid.New(),
+		FamilyID:  uuid.New(),
+		UserID:    user.ID,
+		Scope:     strings.Join(scopes, " "),
+		ExpiresAt: now.Add(s.cfg.JWTRefreshExpiry),
+	}
+	if parent != nil {
+		record.FamilyID = parent.FamilyID
+	}
+
+	audience := jwt.ClaimStrings{MasterAudience}
+	role := user.Role
+	var authParty string
+	if app != nil {
+		record.AppID = &app.ID
+		audience = jwt.ClaimStrings{app.PackageID}
+		authParty = app.PackageID
+		role = ""
+	}
+
 	// Access token
 	accessClaims := JWTClaims{
-		UserID: user.ID,
-		Email:  user.Email,
-		Type:   "access",
+		UserID:    user.ID,
+		TenantID:  user.TenantID,
+		Email:     user.Email,
+		Type:      "access",
+		SessionID: record.FamilyID,
+		AppID:     record.AppID,
+		AuthParty: authParty,
+		Role:      role,
+		Scope:     record.Scope,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
 			Subject:   user.ID.String(),
+			Audience:  audience,
 			IssuedAt:  jwt.NewNumericDate(now),
 			ExpiresAt: jwt.NewNumericDate(now.Add(s.cfg.JWTAccessExpiry)),
 			Issuer:    "master-slave-server",
 		},
 	}
-	accessToken := jwt.NewWithClaims(jwt.SigningMethodHS256, accessClaims)
-	accessStr, err := accessToken.SignedString([]byte(s.cfg.JWTSecret))
+	accessStr, err := s.keys.Sign(accessClaims)
 	if err != nil {
 		return nil, err
 	}
 
 	// Refresh token
 	refreshClaims := JWTClaims{
-		UserID: user.ID,
-		Email:  user.Email,
-		Type:   "refresh",
+		UserID:    user.ID,
+		TenantID:  user.TenantID,
+		Email:     user.Email,
+		Type:      "refresh",
+		SessionID: record.FamilyID,
+		AppID:     record.AppID,
+		AuthParty: authParty,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        record.ID.String(),
 			Subject:   user.ID.String(),
+			Audience:  audience,
 			IssuedAt:  jwt.NewNumericDate(now),
-			ExpiresAt: jwt.NewNumericDate(now.Add(s.cfg.JWTRefreshExpiry)),
+			ExpiresAt: jwt.NewNumericDate(record.ExpiresAt),
 			Issuer:    "master-slave-server",
 		},
 	}
-	refreshToken := jwt.NewWithClaims(jwt.SigningMethodHS256, refreshClaims)
-	refreshStr, err := refreshToken.SignedString([]byte(s.cfg.JWTSecret))
+	refreshStr, err := s.keys.Sign(refreshClaims)
+	if err != nil {
+		return nil, err
+	}
+
+	if parent == nil {
+		err = s.refreshRepo.Create(record)
+	} else {
+		err = s.refreshRepo.Rotate(parent, record)
+		if errors.Is(err, repository.ErrTokenAlreadyRotated) {
+			return nil, s.revokeReusedFamily(parent)
+		}
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -190,14 +726,16 @@ func (s *AuthService) generateTokenPair(user *models.User) (*TokenPair, error) {
 	}, nil
 }
 
-// parseToken parses and validates a JWT token string.
-func (s *AuthService) parseToken(tokenString string) (*JWTClaims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, ErrInvalidToken
-		}
-		return []byte(s.cfg.JWTSecret), nil
-	})
+// parseToken parses and validates a JWT token string. A non-empty audience
+// must be present in the token's "aud" claim.
+func (s *AuthService) parseToken(tokenString, audience string) (*JWTClaims, error) {
+	var opts []jwt.ParserOption
+	if audience != "" {
+		opts = append(opts, jwt.WithAudience(audience))
+	}
+
+	// The verification key is selected by the token's "kid" header.
+	token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, s.keys.Keyfunc, opts...)
 	if err != nil {
 		return nil, ErrInvalidToken
 	}
@@ -0,0 +1,16 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// hashCode returns the keyed hash under which a secret code is stored.
+// Codes are never persisted in plaintext; lookups hash the presented code
+// with the same server-side pepper.
+func hashCode(pepper, code string) string {
+	mac := hmac.New(sha256.New, []byte(pepper))
+	mac.Write([]byte(code))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,16 @@
+package service
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// notFound returns notFoundErr if err reports a missing record, and err
+// unchanged otherwise, so database failures are not mistaken for a 404.
+func notFound(err, notFoundErr error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return notFoundErr
+	}
+	return err
+}
@@ -0,0 +1,184 @@
+package service
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/cachatto/master-slave-server/internal/models"
+	"github.com/cachatto/master-slave-server/internal/repository"
+	"github.com/google/uuid"
+)
+
+// Common errors returned by GroupService.
+var (
+	ErrGroupNotFound    = errors.New("group not found")
+	ErrGroupNameTaken   = errors.New("a group with this name already exists")
+	ErrInvalidGroupName = errors.New("name must be between 1 and 255 characters")
+)
+
+// GroupInput holds the fields of a group that admins can set. Nil fields are
+// left unchanged on update. TenantID is only read on create.
+type GroupInput struct {
+	TenantID    *uuid.UUID
+	Name        *string
+	Description *string
+}
+
+// GroupPage is one page of groups.
+type GroupPage struct {
+	Groups   []models.Group `json:"groups"`
+	Page     int            `json:"page"`
+	PageSize int            `json:"page_size"`
+	Total    int64          `json:"total"`
+}
+
+// GroupService manages groups and their members. Apps are granted to groups
+// through PermissionService.
+//
+// A group and its members belong to one tenant. Admins other than
+// superadmins only see the groups of their tenant; other groups are
+// reported as not found.
+//
+// Removing a member or deleting a group takes effect immediately: the
+// members lose the codes and sessions of the apps they could only use
+// through the group.
+type GroupService struct {
+	groupRepo     *repository.GroupRepository
+	userRepo      *repository.UserRepository
+	tenantService *TenantService
+}
+
+// NewGroupService creates a new GroupService.
+func NewGroupService(groupRepo *repository.GroupRepository, userRepo *repository.UserRepository, tenantService *TenantService) *GroupService {
+	return &GroupService{groupRepo: groupRepo, userRepo: userRepo, tenantService: tenantService}
+}
+
+// CreateGroup creates a group in the actor's tenant, or in input.TenantID
+// for superadmins. Name is required.
+func (s *GroupService) CreateGroup(actor Actor, input *GroupInput) (*models.Group, error) {
+	tenantID, err := s.tenantService.targetTenant(actor, input.TenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	group := &models.Group{TenantID: tenantID}
+	if err := applyGroupInput(group, input); err != nil {
+		return nil, err
+	}
+
+	if err := s.groupRepo.Create(group); err != nil {
+		if errors.Is(err, repository.ErrGroupNameTaken) {
+			return nil, ErrGroupNameTaken
+		}
+		return nil, err
+	}
+	return group, nil
+}
+
+// ListGroups returns one page of the groups actor can see; page is 1-based.
+func (s *GroupService) ListGroups(actor Actor, page, pageSize int) (*GroupPage, error) {
+	groups, total, err := s.groupRepo.List(actor.tenantScope(), (page-1)*pageSize, pageSize)
+	if err != nil {
+		return nil, err
+	}
+	return &GroupPage{Groups: groups, Page: page, PageSize: pageSize, Total: total}, nil
+}
+
+// GetGroup returns a single group.
+func (s *GroupService) GetGroup(actor Actor, groupID uuid.UUID) (*models.Group, error) {
+	group, err := s.groupRepo.FindByID(actor.tenantScope(), groupID)
+	if err != nil {
+		return nil, notFound(err, ErrGroupNotFound)
+	}
+	return group, nil
+}
+
+// UpdateGroup changes the given fields of a group.
+func (s *GroupService) UpdateGroup(actor Actor, groupID uuid.UUID, input *GroupInput) (*models.Group, error) {
+	group, err := s.GetGroup(actor, groupID)
+	if err != nil {
+		return nil, err
+	}
+	if err := applyGroupInput(group, input); err != nil {
+		return nil, err
+	}
+
+	if err := s.groupRepo.Update(group); err != nil {
+		if errors.Is(err, repository.ErrGroupNameTaken) {
+			return nil, ErrGroupNameTaken
+		}
+		return nil, err
+	}
+	return group, nil
+}
+
+// DeleteGroup removes a group with its memberships and app permissions.
+func (s *GroupService) DeleteGroup(actor Actor, groupID uuid.UUID) error {
+	if _, err := s.GetGroup(actor, groupID); err != nil {
+		return err
+	}
+	if err := s.groupRepo.Delete(groupID); err != nil {
+		return ErrGroupNotFound
+	}
+	return nil
+}
+
+// ListMembers returns one page of the members of a group; page is 1-based.
+func (s *GroupService) ListMembers(actor Actor, groupID uuid.UUID, page, pageSize int) (*UserPage, error) {
+	if _, err := s.GetGroup(actor, groupID); err != nil {
+		return nil, err
+	}
+
+	users, total, err := s.groupRepo.Members(groupID, (page-1)*pageSize, pageSize)
+	if err != nil {
+		return nil, err
+	}
+	return &UserPage{Users: users, Page: page, PageSize: pageSize, Total: total}, nil
+}
+
+// AddMembers adds userIDs to a group. Users already in the group are
+// skipped; every user must belong to the group's tenant.
+func (s *GroupService) AddMembers(actor Actor, groupID uuid.UUID, userIDs []uuid.UUID) error {
+	group, err := s.GetGroup(actor, groupID)
+	if err != nil {
+		return err
+	}
+
+	userIDs = uniqueIDs(userIDs)
+	users, err := s.userRepo.FindByIDs(&group.TenantID, userIDs)
+	if err != nil {
+		return err
+	}
+	if len(users) != len(userIDs) {
+		return ErrUnknownUsers
+	}
+	for i := range users {
+		if users[i].TenantID != group.TenantID {
+			return ErrUnknownUsers
+		}
+	}
+	return s.groupRepo.AddMembers(groupID, userIDs)
+}
+
+// RemoveMembers removes userIDs from a group.
+func (s *GroupService) RemoveMembers(actor Actor, groupID uuid.UUID, userIDs []uuid.UUID) error {
+	if _, err := s.GetGroup(actor, groupID); err != nil {
+		return err
+	}
+	return s.groupRepo.RemoveMembers(groupID, uniqueIDs(userIDs))
+}
+
+// applyGroupInput validates input and copies the set fields onto group.
+func applyGroupInput(group *models.Group, input *GroupInput) error {
+	if input.Name != nil {
+		group.Name = strings.TrimSpace(*input.Name)
+	}
+	if input.Description != nil {
+		group.Description = strings.TrimSpace(*input.Description)
+	}
+
+	if group.Name == "" || len(group.Name) > 255 {
+		return ErrInvalidGroupName
+	}
+	return nil
+}
@@ -0,0 +1,274 @@
+package service
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/cachatto/master-slave-server/internal/config"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Common errors returned by KeySet.
+var (
+	ErrUnknownKeyID = errors.New("unknown signing key id")
+	ErrNoSigningKey = errors.New("no signing key is active")
+)
+
+// SigningKey is an asymmetric key used to sign and verify JWTs.
+type SigningKey struct {
+	ID         string
+	Method     jwt.SigningMethod
+	Private    crypto.Signer
+	ActiveFrom time.Time
+}
+
+// JWK is the public part of a signing key in JSON Web Key format (RFC 7517).
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set as served from /.well-known/jwks.json.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// KeySet holds the JWT signing keys and decides which one signs new tokens.
+//
+// Keys are ordered by activation time. The newest key whose activation time
+// has passed signs new tokens. A key that has been superseded stays published
+// and accepted for the configured overlap so tokens it signed keep verifying;
+// keys scheduled for the future are published ahead of time so verifiers can
+// cache them before they are used.
+//
+// When no asymmetric keys are configured the KeySet falls back to HS256 with
+// the shared JWT secret and publishes an empty JWKS.
+type KeySet struct {
+	keys    []*SigningKey
+	overlap time.Duration
+	secret  []byte
+}
+
+// NewKeySet loads the signing keys configured in cfg. At least one of them
+// must already be active.
+func NewKeySet(cfg *config.Config) (*KeySet, error) {
+	ks := &KeySet{
+		overlap: cfg.JWTKeyOverlap,
+		secret:  []byte(cfg.JWTSecret),
+	}
+
+	seen := make(map[string]bool)
+	for _, kc := range cfg.JWTSigningKeys {
+		if seen[kc.ID] {
+			return nil, fmt.Errorf("duplicate signing key id %q", kc.ID)
+		}
+		seen[kc.ID] = true
+
+		key, err := loadSigningKey(kc)
+		if err != nil {
+			return nil, err
+		}
+		ks.keys = append(ks.keys, key)
+	}
+
+	sort.SliceStable(ks.keys, func(i, j int) bool {
+		return ks.keys[i].ActiveFrom.Before(ks.keys[j].ActiveFrom)
+	})
+
+	// Otherwise every token request would fail until the first key activates
+	if len(ks.keys) > 0 && ks.current(time.Now()) == nil {
+		return nil, fmt.Errorf("%w: the earliest signing key %q activates at %s",
+			ErrNoSigningKey, ks.keys[0].ID, ks.keys[0].ActiveFrom.Format(time.RFC3339))
+	}
+
+	return ks, nil
+}
+
+// Sign signs claims with the currently active key and sets the "kid" header.
+func (k *KeySet) Sign(claims jwt.Claims) (string, error) {
+	if len(k.keys) == 0 {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(k.secret)
+	}
+
+	key := k.current(time.Now())
+	if key == nil {
+		return "", ErrNoSigningKey
+	}
+
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.Private)
+}
+
+// Keyfunc selects the verification key for a token by its "kid" header.
+func (k *KeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+	if len(k.keys) == 0 {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, ErrInvalidToken
+		}
+		return k.secret, nil
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	for _, key := range k.published(time.Now()) {
+		if key.ID != kid {
+			continue
+		}
+		if token.Method.Alg() != key.Method.Alg() {
+			return nil, ErrInvalidToken
+		}
+		return key.Private.Public(), nil
+	}
+	return nil, ErrUnknownKeyID
+}
+
+// JWKS returns the public keys that verifiers should currently trust.
+func (k *KeySet) JWKS() JWKS {
+	set := JWKS{Keys: []JWK{}}
+	for _, key := range k.published(time.Now()) {
+		set.Keys = append(set.Keys, publicJWK(key))
+	}
+	return set
+}
+
+// Algorithms returns the JWS algorithms of the published keys.
+func (k *KeySet) Algorithms() []string {
+	if len(k.keys) == 0 {
+		return []string{jwt.SigningMethodHS256.Alg()}
+	}
+
+	var algs []string
+	seen := make(map[string]bool)
+	for _, key := range k.published(time.Now()) {
+		if alg := key.Method.Alg(); !seen[alg] {
+			seen[alg] = true
+			algs = append(algs, alg)
+		}
+	}
+	return algs
+}
+
+// current returns the key that signs tokens at time now.
+func (k *KeySet) current(now time.Time) *SigningKey {
+	var active *SigningKey
+	for _, key := range k.keys {
+		if key.ActiveFrom.After(now) {
+			break
+		}
+		active = key
+	}
+	return active
+}
+
+// published returns every key that is scheduled, active, or still within
+// its overlap window after being superseded.
+func (k *KeySet) published(now time.Time) []*SigningKey {
+	var keys []*SigningKey
+	for i, key := range k.keys {
+		if i+1 < len(k.keys) {
+			successor := k.keys[i+1]
+			if now.After(successor.ActiveFrom.Add(k.overlap)) {
+				continue
+			}
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// loadSigningKey reads a PEM-encoded private key and picks its JWT algorithm.
+func loadSigningKey(kc config.SigningKeyConfig) (*SigningKey, error) {
+	data, err := os.ReadFile(kc.Path)
+	if err != nil {
+		return nil, fmt.Errorf("read signing key %q: %w", kc.ID, err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("signing key %q: no PEM block found", kc.ID)
+	}
+
+	var parsed interface{}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		parsed, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse signing key %q: %w", kc.ID, err)
+	}
+
+	key := &SigningKey{ID: kc.ID, ActiveFrom: kc.ActiveFrom}
+	switch priv := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.Method = jwt.SigningMethodRS256
+		key.Private = priv
+	case *ecdsa.PrivateKey:
+		switch priv.Curve {
+		case elliptic.P256():
+			key.Method = jwt.SigningMethodES256
+		case elliptic.P384():
+			key.Method = jwt.SigningMethodES384
+		case elliptic.P521():
+			key.Method = jwt.SigningMethodES512
+		default:
+			return nil, fmt.Errorf("signing key %q: unsupported curve", kc.ID)
+		}
+		key.Private = priv
+	case ed25519.PrivateKey:
+		key.Method = jwt.SigningMethodEdDSA
+		key.Private = priv
+	default:
+		return nil, fmt.Errorf("signing key %q: unsupported key type %T", kc.ID, parsed)
+	}
+
+	return key, nil
+}
+
+// publicJWK encodes the public half of a signing key as a JWK.
+func publicJWK(key *SigningKey) JWK {
+	jwk := JWK{Use: "sig", Kid: key.ID, Alg: key.Method.Alg()}
+	b64 := base64.RawURLEncoding.EncodeToString
+
+	switch pub := key.Private.Public().(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = b64(pub.N.Bytes())
+		jwk.E = b64(big.NewInt(int64(pub.E)).Bytes())
+	case *ecdsa.PublicKey:
+		// Uncompressed point encoding: 0x04 || X || Y
+		point, _ := pub.ECDH()
+		raw := point.Bytes()[1:]
+		jwk.Kty = "EC"
+		jwk.Crv = pub.Curve.Params().Name
+		jwk.X = b64(raw[:len(raw)/2])
+		jwk.Y = b64(raw[len(raw)/2:])
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = b64(pub)
+	}
+	return jwk
+}
@@ -0,0 +1,204 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/cachatto/master-slave-server/internal/config"
+	"github.com/cachatto/master-slave-server/internal/models"
+	"github.com/cachatto/master-slave-server/internal/repository"
+	"github.com/google/uuid"
+)
+
+// Common errors returned by MFAService.
+var (
+	ErrInvalidMFACode     = errors.New("invalid authentication code")
+	ErrTOTPNotEnrolling   = errors.New("no pending two-factor enrollment; start one first")
+	ErrTOTPAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrTOTPNotEnabled     = errors.New("two-factor authentication is not enabled")
+)
+
+// recoveryCodeCount is the number of recovery codes issued per set.
+const recoveryCodeCount = 10
+
+// TOTPEnrollment is returned when a user starts enrolling an authenticator.
+type TOTPEnrollment struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+// MFAStatus describes the second factors of a user.
+type MFAStatus struct {
+	TOTPEnabled            bool  `json:"totp_enabled"`
+	RecoveryCodesRemaining int64 `json:"recovery_codes_remaining"`
+}
+
+// MFAService handles TOTP enrollment and second-factor verification.
+type MFAService struct {
+	userRepo     *repository.UserRepository
+	recoveryRepo *repository.RecoveryCodeRepository
+	cfg          *config.Config
+}
+
+// NewMFAService creates a new MFAService.
+func NewMFAService(
+	userRepo *repository.UserRepository,
+	recoveryRepo *repository.RecoveryCodeRepository,
+	cfg *config.Config,
+) *MFAService {
+	return &MFAService{
+		userRepo:     userRepo,
+		recoveryRepo: recoveryRepo,
+		cfg:          cfg,
+	}
+}
+
+// Status reports whether a user has TOTP enabled and how many unused
+// recovery codes they have left.
+func (s *MFAService) Status(userID uuid.UUID) (*MFAStatus, error) {
+	user, err := s.userRepo.FindByID(nil, userID)
+	if err != nil {
+		return nil, notFound(err, ErrUserNotFound)
+	}
+	if user.TOTPEnabledAt == nil {
+		return &MFAStatus{}, nil
+	}
+
+	remaining, err := s.recoveryRepo.CountUnused(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &MFAStatus{TOTPEnabled: true, RecoveryCodesRemaining: remaining}, nil
+}
+
+// BeginTOTPEnrollment generates a new TOTP secret for a user. TOTP stays
+// disabled until the user confirms a code from their authenticator.
+func (s *MFAService) BeginTOTPEnrollment(userID uuid.UUID) (*TOTPEnrollment, error) {
+	user, err := s.userRepo.FindByID(nil, userID)
+	if err != nil {
+		return nil, notFound(err, ErrUserNotFound)
+	}
+	if user.TOTPEnabledAt != nil {
+		return nil, ErrTOTPAlreadyEnabled
+	}
+
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.userRepo.SetTOTPSecret(user.ID, secret); err != nil {
+		return nil, err
+	}
+
+	return &TOTPEnrollment{
+		Secret:          secret,
+		ProvisioningURI: totpProvisioningURI(s.cfg.MFAIssuer, user.Email, secret),
+	}, nil
+}
+
+// ConfirmTOTPEnrollment enables TOTP once the user proves their authenticator
+// works, and returns a fresh set of recovery codes (shown only once).
+func (s *MFAService) ConfirmTOTPEnrollment(userID uuid.UUID, code string) ([]string, error) {
+	user, err := s.userRepo.FindByID(nil, userID)
+	if err != nil {
+		return nil, notFound(err, ErrUserNotFound)
+	}
+	if user.TOTPEnabledAt != nil {
+		return nil, ErrTOTPAlreadyEnabled
+	}
+	if user.TOTPSecret == "" {
+		return nil, ErrTOTPNotEnrolling
+	}
+
+	if err := s.verifyTOTP(user, code); err != nil {
+		return nil, err
+	}
+	if err := s.userRepo.EnableTOTP(user.ID); err != nil {
+		return nil, err
+	}
+
+	return s.issueRecoveryCodes(user.ID)
+}
+
+// enabledUser returns the user with userID if they have TOTP enabled.
+func (s *MFAService) enabledUser(userID uuid.UUID) (*models.User, error) {
+	user, err := s.userRepo.FindByID(nil, userID)
+	if err != nil {
+		return nil, notFound(err, ErrUserNotFound)
+	}
+	if user.TOTPEnabledAt == nil {
+		return nil, ErrTOTPNotEnabled
+	}
+	return user, nil
+}
+
+// disableTOTP turns off TOTP and drops the user's recovery codes. Callers
+// verify a second factor first (see AuthService.DisableTOTP).
+func (s *MFAService) disableTOTP(userID uuid.UUID) error {
+	if err := s.userRepo.DisableTOTP(userID); err != nil {
+		return err
+	}
+	return s.recoveryRepo.Replace(userID, nil)
+}
+
+// verifySecondFactor accepts either a current TOTP code or an unused
+// recovery code (which is consumed). It does no failure accounting; callers
+// go through AuthService.VerifySecondFactor.
+func (s *MFAService) verifySecondFactor(user *models.User, code string) error {
+	code = strings.TrimSpace(code)
+	if len(code) == totpDigits {
+		return s.verifyTOTP(user, code)
+	}
+
+	err := s.recoveryRepo.Consume(user.ID, hashCode(s.cfg.OTCPepper, normalizeRecoveryCode(code)))
+	if err != nil {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+// verifyTOTP checks a TOTP code and records its time step so it cannot be reused.
+func (s *MFAService) verifyTOTP(user *models.User, code string) error {
+	step, ok := matchTOTP(user.TOTPSecret, code, time.Now(), user.TOTPLastStep)
+	if !ok {
+		return ErrInvalidMFACode
+	}
+	if err := s.userRepo.AdvanceTOTPStep(user.ID, step); err != nil {
+		if errors.Is(err, repository.ErrTOTPStepUsed) {
+			return ErrInvalidMFACode
+		}
+		return err
+	}
+	return nil
+}
+
+// issueRecoveryCodes replaces a user's recovery codes with a new random set
+// and returns them in plaintext; only their hashes are stored.
+func (s *MFAService) issueRecoveryCodes(userID uuid.UUID) ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		raw := make([]byte, 5)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, ErrCodeGeneration
+		}
+		code := hex.EncodeToString(raw)
+		codes[i] = code[:5] + "-" + code[5:]
+		hashes[i] = hashCode(s.cfg.OTCPepper, code)
+	}
+
+	if err := s.recoveryRepo.Replace(userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// normalizeRecoveryCode strips the formatting users may type around a recovery code.
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
@@ -0,0 +1,389 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/cachatto/master-slave-server/internal/config"
+	"github.com/cachatto/master-slave-server/internal/models"
+	"github.com/cachatto/master-slave-server/internal/repository"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// OAuth 2.0 / OpenID Connect error codes (RFC 6749 §4.1.2.1, §5.2).
+const (
+	OAuthInvalidRequest          = "invalid_request"
+	OAuthInvalidClient           = "invalid_client"
+	OAuthInvalidGrant            = "invalid_grant"
+	OAuthInvalidScope            = "invalid_scope"
+	OAuthUnsupportedGrantType    = "unsupported_grant_type"
+	OAuthUnsupportedResponseType = "unsupported_response_type"
+	OAuthAccessDenied            = "access_denied"
+	OAuthServerError             = "server_error"
+)
+
+// OIDC scopes understood by the provider.
+const (
+	ScopeOpenID = "openid"
+	ScopeEmail  = "email"
+)
+
+// OAuthError is an error reported to OIDC clients in the standard format.
+type OAuthError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func (e *OAuthError) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+func oauthError(code, description string) *OAuthError {
+	return &OAuthError{Code: code, Description: description}
+}
+
+// ErrInvalidRedirect is returned when the client or redirect URI of an
+// authorization request cannot be trusted, so the error must not be sent
+// back to the redirect URI.
+var ErrInvalidRedirect = errors.New("unknown client_id or unregistered redirect_uri")
+
+// AuthorizeRequest holds the parameters of an /oauth2/authorize request.
+type AuthorizeRequest struct {
+	ClientID            string `form:"client_id"`
+	RedirectURI         string `form:"redirect_uri"`
+	ResponseType        string `form:"response_type"`
+	Scope               string `form:"scope"`
+	State               string `form:"state"`
+	Nonce               string `form:"nonce"`
+	CodeChallenge       string `form:"code_challenge"`
+	CodeChallengeMethod string `form:"code_challenge_method"`
+}
+
+// TokenRequest holds the parameters of an /oauth2/token request.
+type TokenRequest struct {
+	GrantType    string `form:"grant_type"`
+	ClientID     string `form:"client_id"`
+	Code         string `form:"code"`
+	RedirectURI  string `form:"redirect_uri"`
+	CodeVerifier string `form:"code_verifier"`
+	RefreshToken string `form:"refresh_token"`
+}
+
+// TokenResponse is the successful response of /oauth2/token.
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+	IDToken      string `json:"id_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+}
+
+// UserInfo is the response of /oauth2/userinfo.
+type UserInfo struct {
+	Subject string `json:"sub"`
+	Email   string `json:"email"`
+}
+
+// DiscoveryDocument is served from /.well-known/openid-configuration.
+type DiscoveryDocument struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserinfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+}
+
+// OIDCService implements an OpenID Connect provider (authorization code flow
+// with PKCE) on top of the app registry. Each app is a public client whose
+// client_id is its package ID.
+type OIDCService struct {
+	codeRepo    *repository.AuthorizationCodeRepository
+	appRepo     *repository.AppRepository
+	userRepo    *repository.UserRepository
+	authService *AuthService
+	keys        *KeySet
+	cfg         *config.Config
+}
+
+// NewOIDCService creates a new OIDCService.
+func NewOIDCService(
+	codeRepo *repository.AuthorizationCodeRepository,
+	appRepo *repository.AppRepository,
+	userRepo *repository.UserRepository,
+	authService *AuthService,
+	keys *KeySet,
+	cfg *config.Config,
+) *OIDCService {
+	return &OIDCService{
+		codeRepo:    codeRepo,
+		appRepo:     appRepo,
+		userRepo:    userRepo,
+		authService: authService,
+		keys:        keys,
+		cfg:         cfg,
+	}
+}
+
+// Discovery returns the OpenID provider metadata.
+func (s *OIDCService) Discovery() *DiscoveryDocument {
+	issuer := s.cfg.OIDCIssuer
+	return &DiscoveryDocument{
+		Issuer:                            issuer,
+		AuthorizationEndpoint:             issuer + "/oauth2/authorize",
+		TokenEndpoint:                     issuer + "/oauth2/token",
+		UserinfoEndpoint:                  issuer + "/oauth2/userinfo",
+		JWKSURI:                           issuer + "/.well-known/jwks.json",
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{"authorization_code", "refresh_token"},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  s.keys.Algorithms(),
+		ScopesSupported:                   []string{ScopeOpenID, ScopeEmail},
+		TokenEndpointAuthMethodsSupported: []string{"none"},
+		CodeChallengeMethodsSupported:     []string{PKCEMethodS256},
+		ClaimsSupported:                   []string{"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce", "azp", "email"},
+	}
+}
+
+// ValidateAuthorizeRequest checks an authorization request. It returns
+// ErrInvalidRedirect if the client or redirect URI is unknown; any other
+// error is an *OAuthError that may be sent to the redirect URI.
+func (s *OIDCService) ValidateAuthorizeRequest(req *AuthorizeRequest) (*models.App, error) {
+	app, err := s.appRepo.FindByPackageID(req.ClientID)
+	if err != nil {
+		return nil, ErrInvalidRedirect
+	}
+	if !redirectURIAllowed(app, req.RedirectURI) {
+		return nil, ErrInvalidRedirect
+	}
+
+	if req.ResponseType != "code" {
+		return app, oauthError(OAuthUnsupportedResponseType, "only response_type=code is supported")
+	}
+	if !slices.Contains(strings.Fields(req.Scope), ScopeOpenID) {
+		return app, oauthError(OAuthInvalidScope, "scope must include openid")
+	}
+	if !validCodeChallenge(req.CodeChallenge, req.CodeChallengeMethod) {
+		return app, oauthError(OAuthInvalidRequest, "a S256 code_challenge is required")
+	}
+
+	return app, nil
+}
+
+// Authorize issues an authorization code for an authenticated user and
+// returns the URL to redirect the user agent to.
+func (s *OIDCService) Authorize(userID uuid.UUID, req *AuthorizeRequest) (string, error) {
+	app, err := s.ValidateAuthorizeRequest(req)
+	if err != nil {
+		return "", err
+	}
+
+	perm, err := s.appRepo.FindPermission(userID, app.ID)
+	if err != nil {
+		return s.ErrorRedirect(req, oauthError(OAuthAccessDenied, ErrNoPermission.Error())), nil
+	}
+
+	codeBytes := make([]byte, 32)
+	if _, err := rand.Read(codeBytes); err != nil {
+		return "", ErrCodeGeneration
+	}
+	code := hex.EncodeToString(codeBytes)
+
+	now := time.Now()
+	authCode := &models.AuthorizationCode{
+		CodeHash:      hashCode(s.cfg.OTCPepper, code),
+		UserID:        userID,
+		AppID:         app.ID,
+		RedirectURI:   req.RedirectURI,
+		Scope:         supportedScopes(req.Scope, intersectScopes(perm.ScopeList(), app.ScopeList())),
+		Nonce:         req.Nonce,
+		CodeChallenge: req.CodeChallenge,
+		AuthTime:      now,
+		ExpiresAt:     now.Add(s.cfg.OIDCCodeExpiry),
+	}
+	if err := s.codeRepo.Create(authCode); err != nil {
+		return "", err
+	}
+
+	params := url.Values{}
+	params.Set("code", code)
+	return s.redirectWith(req, params), nil
+}
+
+// ErrorRedirect returns the redirect URL that reports err to the client.
+func (s *OIDCService) ErrorRedirect(req *AuthorizeRequest, err *OAuthError) string {
+	params := url.Values{}
+	params.Set("error", err.Code)
+	if err.Description != "" {
+		params.Set("error_description", err.Description)
+	}
+	return s.redirectWith(req, params)
+}
+
+// Token handles the authorization_code and refresh_token grants.
+func (s *OIDCService) Token(req *TokenRequest) (*TokenResponse, error) {
+	app, err := s.appRepo.FindByPackageID(req.ClientID)
+	if err != nil {
+		return nil, oauthError(OAuthInvalidClient, "unknown client_id")
+	}
+
+	switch req.GrantType {
+	case "authorization_code":
+		return s.exchangeAuthorizationCode(app, req)
+	case "refresh_token":
+		tokens, err := s.authService.RefreshTokenForApp(req.RefreshToken, app.ID)
+		switch err {
+		case nil:
+		case ErrInvalidToken, ErrInvalidTokenType, ErrTokenReused, ErrUserNotFound, ErrUserDisabled, ErrNoPermission:
+			return nil, oauthError(OAuthInvalidGrant, err.Error())
+		default:
+			// Not a rejected token: the client must keep it and retry
+			return nil, err
+		}
+		return s.tokenResponse(tokens, "", ""), nil
+	default:
+		return nil, oauthError(OAuthUnsupportedGrantType, "grant_type must be authorization_code or refresh_token")
+	}
+}
+
+// UserInfo returns the claims about the user behind an access token.
+func (s *OIDCService) UserInfo(accessToken string) (*UserInfo, error) {
+	claims, err := s.authService.ParseAccessToken(accessToken, "")
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.userRepo.FindByID(&claims.TenantID, claims.UserID)
+	if err != nil {
+		return nil, notFound(err, ErrUserNotFound)
+	}
+
+	return &UserInfo{
+		Subject: user.ID.String(),
+		Email:   user.Email,
+	}, nil
+}
+
+// CleanExpiredCodes removes all expired or claimed authorization codes (call periodically).
+func (s *OIDCService) CleanExpiredCodes() error {
+	return s.codeRepo.CleanExpired()
+}
+
+// exchangeAuthorizationCode redeems an authorization code for tokens.
+func (s *OIDCService) exchangeAuthorizationCode(app *models.App, req *TokenRequest) (*TokenResponse, error) {
+	authCode, err := s.codeRepo.FindByCode(hashCode(s.cfg.OTCPepper, req.Code))
+	if err != nil || authCode.Claimed || time.Now().After(authCode.ExpiresAt) {
+		return nil, oauthError(OAuthInvalidGrant, ErrCodeExpired.Error())
+	}
+	if authCode.AppID != app.ID {
+		return nil, oauthError(OAuthInvalidGrant, ErrAppMismatch.Error())
+	}
+	if authCode.RedirectURI != req.RedirectURI {
+		return nil, oauthError(OAuthInvalidGrant, "redirect_uri does not match the authorization request")
+	}
+	if !verifyPKCE(authCode.CodeChallenge, req.CodeVerifier) {
+		return nil, oauthError(OAuthInvalidGrant, "code_verifier does not match code_challenge")
+	}
+
+	if err := s.codeRepo.MarkClaimed(authCode); err != nil {
+		if errors.Is(err, repository.ErrCodeAlreadyClaimed) {
+			return nil, oauthError(OAuthInvalidGrant, ErrCodeExpired.Error())
+		}
+		return nil, err
+	}
+
+	user, err := s.userRepo.FindByID(&app.TenantID, authCode.UserID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, oauthError(OAuthInvalidGrant, ErrUserNotFound.Error())
+		}
+		return nil, err
+	}
+
+	tokens, err := s.authService.GenerateTokenPairForApp(user.ID, app, strings.Fields(authCode.Scope))
+	if err != nil {
+		if errors.Is(err, ErrUserDisabled) || errors.Is(err, ErrNoPermission) {
+			return nil, oauthError(OAuthInvalidGrant, err.Error())
+		}
+		return nil, err
+	}
+
+	idToken, err := s.authService.GenerateIDToken(user, app, authCode.Nonce, authCode.AuthTime)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.tokenResponse(tokens, idToken, authCode.Scope), nil
+}
+
+func (s *OIDCService) tokenResponse(tokens *TokenPair, idToken, scope string) *TokenResponse {
+	return &TokenResponse{
+		AccessToken:  tokens.AccessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(s.cfg.JWTAccessExpiry.Seconds()),
+		RefreshToken: tokens.RefreshToken,
+		IDToken:      idToken,
+		Scope:        scope,
+	}
+}
+
+// redirectWith appends params (plus state and iss) to the request's redirect URI.
+func (s *OIDCService) redirectWith(req *AuthorizeRequest, params url.Values) string {
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+	// RFC 9207 issuer identification
+	params.Set("iss", s.cfg.OIDCIssuer)
+
+	u, _ := url.Parse(req.RedirectURI)
+	query := u.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// redirectURIAllowed reports whether uri may receive authorization responses
+// for app: either it is registered explicitly, or it uses the app's private
+// deep link scheme (RFC 8252 §7.1).
+func redirectURIAllowed(app *models.App, uri string) bool {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme == "" || u.Fragment != "" {
+		return false
+	}
+
+	if slices.Contains(app.RedirectURIList(), uri) {
+		return true
+	}
+
+	scheme, _, ok := strings.Cut(app.DeepLinkScheme, ":")
+	return ok && scheme != "" && strings.EqualFold(u.Scheme, scheme)
+}
+
+// supportedScopes filters a requested scope string down to the OIDC scopes
+// and the app scopes in appScopes (those granted to the user).
+func supportedScopes(scope string, appScopes []string) string {
+	var granted []string
+	for _, sc := range strings.Fields(scope) {
+		supported := sc == ScopeOpenID || sc == ScopeEmail || slices.Contains(appScopes, sc)
+		if supported && !slices.Contains(granted, sc) {
+			granted = append(granted, sc)
+		}
+	}
+	return strings.Join(granted, " ")
+}
@@ -4,9 +4,11 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"errors"
+	"strings"
 	"time"
 
 	"github.com/cachatto/master-slave-server/internal/config"
+	"github.com/cachatto/master-slave-server/internal/limiter"
 	"github.com/cachatto/master-slave-server/internal/models"
 	"github.com/cachatto/master-slave-server/internal/repository"
 	"github.com/google/uuid"
@@ -15,24 +17,41 @@ import (
 // Common errors returned by OTCService.
 var (
 	ErrCodeExpired    = errors.New("code expired or already claimed")
+	ErrCodeClaimed    = errors.New("code was claimed by another request")
 	ErrAppNotFound    = errors.New("application not found")
 	ErrAppMismatch    = errors.New("code does not match the requested application")
 	ErrNoPermission   = errors.New("user does not have permission for this application")
 	ErrCodeGeneration = errors.New("failed to generate one-time code")
+
+	ErrInvalidCodeChallenge = errors.New("code_challenge must be a S256 PKCE challenge")
+	ErrPKCERequired         = errors.New("this application requires PKCE")
+	ErrInvalidCodeVerifier  = errors.New("code_verifier does not match code_challenge")
+
+	ErrUnknownScope = errors.New("requested scopes are not declared by this application")
 )
 
-// OTCResult is returned when an OTC is successfully created.
+// OTCResult is returned when an OTC is successfully created. Scopes are
+// the scopes the claimed token will carry.
 type OTCResult struct {
 	Code      string    `json:"code"`
 	ExpiresAt time.Time `json:"expires_at"`
+	Scopes    []string  `json:"scopes"`
 }
 
 // OTCService handles the one-time-code handshake between Master and Slave apps.
+// Failed claims are counted per client IP, per package ID and client IP,
+// and per package ID; any counter can lock further claims out. Package IDs
+// are public and a package lockout stops every user of the app, so the
+// package limiter only catches guessing spread over many client IPs: its
+// threshold is much higher and its lockouts much shorter.
 type OTCService struct {
-	otcRepo     *repository.OTCRepository
-	appRepo     *repository.AppRepository
-	authService *AuthService
-	cfg         *config.Config
+	otcRepo        *repository.OTCRepository
+	appRepo        *repository.AppRepository
+	authService    *AuthService
+	ipLimiter      limiter.Limiter
+	appLimiter     limiter.Limiter
+	packageLimiter limiter.Limiter
+	cfg            *config.Config
 }
 
 // NewOTCService creates a new OTCService.
@@ -40,32 +59,60 @@ func NewOTCService(
 	otcRepo *repository.OTCRepository,
 	appRepo *repository.AppRepository,
 	authService *AuthService,
+	ipLimiter limiter.Limiter,
+	appLimiter limiter.Limiter,
+	packageLimiter limiter.Limiter,
 	cfg *config.Config,
 ) *OTCService {
 	return &OTCService{
-		otcRepo:     otcRepo,
-		appRepo:     appRepo,
-		authService: authService,
-		cfg:         cfg,
+		otcRepo:        otcRepo,
+		appRepo:        appRepo,
+		authService:    authService,
+		ipLimiter:      ipLimiter,
+		appLimiter:     appLimiter,
+		packageLimiter: packageLimiter,
+		cfg:            cfg,
 	}
 }
 
 // ExchangeCode generates a short-lived one-time code for a specific slave app.
-func (s *OTCService) ExchangeCode(userID, appID uuid.UUID) (*OTCResult, error) {
-	// Verify the app exists
-	_, err := s.appRepo.FindByID(appID)
+// An optional S256 codeChallenge (received by the Master app through the slave
+// app's deep link) binds the code to the slave app instance that created it.
+// Requested scopes must be declared by the app; those not granted to the
+// user are dropped. Without requested scopes, all granted scopes are used.
+// Apps of other tenants than the user's are not found.
+func (s *OTCService) ExchangeCode(userID, tenantID, appID uuid.UUID, codeChallenge, codeChallengeMethod string, scopes []string) (*OTCResult, error) {
+	// Verify the app exists in the user's tenant
+	app, err := s.appRepo.FindByID(&tenantID, appID)
 	if err != nil {
-		return nil, ErrAppNotFound
+		return nil, notFound(err, ErrAppNotFound)
+	}
+
+	// Validate the PKCE challenge
+	if codeChallenge != "" {
+		if codeChallengeMethod == "" {
+			codeChallengeMethod = PKCEMethodS256
+		}
+		if !validCodeChallenge(codeChallenge, codeChallengeMethod) {
+			return nil, ErrInvalidCodeChallenge
+		}
+	} else if app.RequirePKCE {
+		return nil, ErrPKCERequired
+	}
+
+	if !isSubset(scopes, app.ScopeList()) {
+		return nil, ErrUnknownScope
 	}
 
 	// Verify user has permission for this app
-	hasPermission, err := s.appRepo.HasPermission(userID, appID)
+	perm, err := s.appRepo.FindPermission(userID, appID)
 	if err != nil {
-		return nil, err
+		return nil, notFound(err, ErrNoPermission)
 	}
-	if !hasPermission {
-		return nil, ErrNoPermission
+	if len(scopes) == 0 {
+		scopes = perm.ScopeList()
 	}
+	scopes = intersectScopes(scopes, perm.ScopeList(), app.ScopeList())
 
 	// Generate a cryptographically random code (6 bytes → 12 hex chars)
 	codeBytes := make([]byte, 6)
@@ -77,29 +124,121 @@ func (s *OTCService) ExchangeCode(userID, appID uuid.UUID) (*OTCResult, error) {
 	expiresAt := time.Now().Add(s.cfg.OTCExpiry)
 
 	otc := &models.OneTimeCode{
-		UserID:    userID,
-		AppID:     appID,
-		Code:      code,
-		ExpiresAt: expiresAt,
-		Claimed:   false,
+		UserID:        userID,
+		AppID:         appID,
+		CodeHash:      hashCode(s.cfg.OTCPepper, code),
+		CodeChallenge: codeChallenge,
+		Scopes:        strings.Join(scopes, " "),
+		ExpiresAt:     expiresAt,
+		Claimed:       false,
 	}
 
 	if err := s.otcRepo.Create(otc); err != nil {
 		return nil, err
 	}
 
+	// The plaintext code is only ever returned here
 	return &OTCResult{
 		Code:      code,
 		ExpiresAt: expiresAt,
+		Scopes:    scopes,
 	}, nil
 }
 
 // ClaimToken validates a one-time code and returns a JWT token pair.
-func (s *OTCService) ClaimToken(code, packageID string) (*TokenPair, error) {
-	// Find the code
-	otc, err := s.otcRepo.FindByCode(code)
+// If the code was bound to a PKCE challenge, codeVerifier must match it.
+// While clientIP or packageID is locked out after repeated failures, a
+// *limiter.LockedError is returned without looking at the code.
+func (s *OTCService) ClaimToken(code, packageID, codeVerifier, clientIP string) (*TokenPair, error) {
+	if err := s.checkClaimLockout(clientIP, packageID); err != nil {
+		return nil, err
+	}
+
+	tokens, err := s.claimToken(code, packageID, codeVerifier)
 	if err != nil {
-		return nil, ErrCodeExpired
+		if recordErr := s.recordClaimFailure(clientIP, packageID, err); recordErr != nil {
+			return nil, recordErr
+		}
+		return nil, err
+	}
+
+	// The per-IP and per-package counters are left alone so a client cannot
+	// clear them by interleaving claims of its own valid codes.
+	if err := s.appLimiter.Reset(appLimiterKey(packageID, clientIP)); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// CleanExpiredCodes removes all expired or claimed codes (call periodically).
+func (s *OTCService) CleanExpiredCodes() error {
+	return s.otcRepo.CleanExpired()
+}
+
+// CleanLimiters drops expired failed-claim counters (call periodically).
+func (s *OTCService) CleanLimiters() error {
+	if err := s.ipLimiter.Cleanup(); err != nil {
+		return err
+	}
+	if err := s.appLimiter.Cleanup(); err != nil {
+		return err
+	}
+	return s.packageLimiter.Cleanup()
+}
+
+// checkClaimLockout returns a *limiter.LockedError carrying the longest
+// remaining lockout if the client IP, the client IP for the package ID, or
+// the package ID is locked out.
+func (s *OTCService) checkClaimLockout(clientIP, packageID string) error {
+	ipWait, err := s.ipLimiter.Check(clientIP)
+	if err != nil {
+		return err
+	}
+	appWait, err := s.appLimiter.Check(appLimiterKey(packageID, clientIP))
+	if err != nil {
+		return err
+	}
+	packageWait, err := s.packageLimiter.Check(packageID)
+	if err != nil {
+		return err
+	}
+	if wait := max(ipWait, appWait, packageWait); wait > 0 {
+		return &limiter.LockedError{RetryAfter: wait}
+	}
+	return nil
+}
+
+// recordClaimFailure counts a failed claim that could be a guessing attempt.
+func (s *OTCService) recordClaimFailure(clientIP, packageID string, claimErr error) error {
+	switch claimErr {
+	case ErrCodeExpired, ErrAppMismatch, ErrInvalidCodeVerifier:
+		if _, err := s.appLimiter.Fail(appLimiterKey(packageID, clientIP)); err != nil {
+			return err
+		}
+		if _, err := s.packageLimiter.Fail(packageID); err != nil {
+			return err
+		}
+	case ErrAppNotFound:
+		// Unknown package IDs are only counted against the client IP
+	default:
+		return nil
+	}
+
+	_, err := s.ipLimiter.Fail(clientIP)
+	return err
+}
+
+// appLimiterKey is the app limiter key for claims of packageID from clientIP.
+func appLimiterKey(packageID, clientIP string) string {
+	return packageID + "|" + clientIP
+}
+
+// claimToken implements ClaimToken without brute-force accounting.
+func (s *OTCService) claimToken(code, packageID, codeVerifier string) (*TokenPair, error) {
+	// Find the code by its keyed hash
+	otc, err := s.otcRepo.FindByCode(hashCode(s.cfg.OTCPepper, code))
+	if err != nil {
+		return nil, notFound(err, ErrCodeExpired)
 	}
 
 	// Check if already claimed or expired
@@ -110,23 +249,30 @@ func (s *OTCService) ClaimToken(code, packageID string) (*TokenPair, error) {
 	// Verify the package ID matches the app associated with the code
 	app, err := s.appRepo.FindByPackageID(packageID)
 	if err != nil {
-		return nil, ErrAppNotFound
+		return nil, notFound(err, ErrAppNotFound)
 	}
 
 	if app.ID != otc.AppID {
 		return nil, ErrAppMismatch
 	}
 
-	// Mark the code as claimed
+	// Verify proof of possession of the PKCE verifier
+	if otc.CodeChallenge != "" {
+		if !verifyPKCE(otc.CodeChallenge, codeVerifier) {
+			return nil, ErrInvalidCodeVerifier
+		}
+	} else if app.RequirePKCE {
+		return nil, ErrPKCERequired
+	}
+
+	// Mark the code as claimed; a concurrent claim of the same code loses here
 	if err := s.otcRepo.MarkClaimed(otc); err != nil {
+		if errors.Is(err, repository.ErrCodeAlreadyClaimed) {
+			return nil, ErrCodeClaimed
+		}
 		return nil, err
 	}
 
-	// Generate a token pair for the user
-	return s.authService.GenerateTokenPairForUser(otc.UserID)
-}
-
-// CleanExpiredCodes removes all expired or claimed codes (call periodically).
-func (s *OTCService) CleanExpiredCodes() error {
-	return s.otcRepo.CleanExpired()
+	// Generate a token pair scoped to the claiming app
+	return s.authService.GenerateTokenPairForApp(otc.UserID, app, strings.Fields(otc.Scopes))
 }
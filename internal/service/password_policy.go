@@ -0,0 +1,79 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/cachatto/master-slave-server/internal/config"
+)
+
+// Longest accepted passwords. bcrypt silently truncates input after 72
+// bytes; for Argon2id the limit only bounds request size.
+const (
+	maxBcryptPasswordBytes = 72
+	maxPasswordBytes       = 256
+)
+
+// commonPasswords are rejected regardless of length. Compared lowercased.
+var commonPasswords = map[string]bool{
+	"0123456789":    true,
+	"0987654321":    true,
+	"1111111111":    true,
+	"1234567890":    true,
+	"12345678910":   true,
+	"123123123123":  true,
+	"1q2w3e4r5t":    true,
+	"abcdefghij":    true,
+	"administrator": true,
+	"iloveyou123":   true,
+	"letmein123":    true,
+	"passw0rd123":   true,
+	"password1":     true,
+	"password12":    true,
+	"password123":   true,
+	"password1234":  true,
+	"qwerty123456":  true,
+	"qwertyuiop":    true,
+	"sunshine123":   true,
+	"welcome123":    true,
+}
+
+// PasswordPolicyError is returned when a new password does not meet the
+// password policy. Reason is safe to show to the user.
+type PasswordPolicyError struct {
+	Reason string
+}
+
+func (e *PasswordPolicyError) Error() string {
+	return "password " + e.Reason
+}
+
+// validatePassword checks a new password for the account with the given
+// email against the password policy.
+func validatePassword(cfg *config.Config, email, password string) error {
+	if utf8.RuneCountInString(password) < cfg.PasswordMinLength {
+		return &PasswordPolicyError{Reason: fmt.Sprintf("must be at least %d characters long", cfg.PasswordMinLength)}
+	}
+	maxBytes := maxPasswordBytes
+	if cfg.PasswordHashAlgorithm == "bcrypt" {
+		maxBytes = maxBcryptPasswordBytes
+	}
+	if len(password) > maxBytes {
+		return &PasswordPolicyError{Reason: fmt.Sprintf("must be at most %d bytes long", maxBytes)}
+	}
+
+	lower := strings.ToLower(password)
+	if commonPasswords[lower] {
+		return &PasswordPolicyError{Reason: "is too common"}
+	}
+	if local, _, _ := strings.Cut(strings.ToLower(email), "@"); len(local) >= 3 && strings.Contains(lower, local) {
+		return &PasswordPolicyError{Reason: "must not contain your email address"}
+	}
+	return nil
+}
+
+// normalizeEmail trims and lowercases an email address for storage and lookup.
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
@@ -0,0 +1,296 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/cachatto/master-slave-server/internal/config"
+	"github.com/cachatto/master-slave-server/internal/limiter"
+	"github.com/cachatto/master-slave-server/internal/mail"
+	"github.com/cachatto/master-slave-server/internal/models"
+	"github.com/cachatto/master-slave-server/internal/pwhash"
+	"github.com/cachatto/master-slave-server/internal/repository"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ErrResetTokenInvalid is returned when a password reset token is unknown,
+// expired or already used.
+var ErrResetTokenInvalid = errors.New("password reset token is invalid or expired")
+
+// PasswordService handles password changes and recovery.
+// Reset link requests are rate-limited per client IP (forgotIPLimiter) and
+// per tenant and email (forgotEmailLimiter).
+type PasswordService struct {
+	userRepo           *repository.UserRepository
+	resetRepo          *repository.PasswordResetRepository
+	tenantService      *TenantService
+	hasher             *pwhash.Hasher
+	authService        *AuthService
+	mailer             mail.Sender
+	forgotIPLimiter    limiter.Limiter
+	forgotEmailLimiter limiter.Limiter
+	cfg                *config.Config
+}
+
+// NewPasswordService creates a new PasswordService.
+func NewPasswordService(
+	userRepo *repository.UserRepository,
+	resetRepo *repository.PasswordResetRepository,
+	tenantService *TenantService,
+	hasher *pwhash.Hasher,
+	authService *AuthService,
+	mailer mail.Sender,
+	forgotIPLimiter limiter.Limiter,
+	forgotEmailLimiter limiter.Limiter,
+	cfg *config.Config,
+) *PasswordService {
+	return &PasswordService{
+		userRepo:           userRepo,
+		resetRepo:          resetRepo,
+		tenantService:      tenantService,
+		hasher:             hasher,
+		authService:        authService,
+		mailer:             mailer,
+		forgotIPLimiter:    forgotIPLimiter,
+		forgotEmailLimiter: forgotEmailLimiter,
+		cfg:                cfg,
+	}
+}
+
+// ForgotPassword emails a password reset link if email belongs to an
+// account of the tenant with the given slug (the default tenant if empty),
+// and does nothing otherwise. Requesting a new link invalidates any earlier
+// one.
+// The lookup and the email happen in the background, so the result and the
+// response time are the same whether or not the account exists; failures
+// are logged. Once the client IP or the email has made too many requests, a
+// *limiter.LockedError is returned for any email.
+func (s *PasswordService) ForgotPassword(tenant, email, clientIP string) error {
+	email = normalizeEmail(email)
+	tenant = s.tenantService.normalizeSlug(tenant)
+	if err := throttleMail(s.forgotIPLimiter, s.forgotEmailLimiter, clientIP, tenant+"|"+email); err != nil {
+		return err
+	}
+
+	go func() {
+		if err := s.sendForgotPasswordLink(tenant, email); err != nil {
+			log.Printf("⚠️  Failed to send password reset link: %v", err)
+		}
+	}()
+	return nil
+}
+
+// throttleMail counts a request that emails emailKey's address against the
+// client IP and the email, returning a *limiter.LockedError once either is
+// over its budget.
+func throttleMail(ipLimiter, emailLimiter limiter.Limiter, clientIP, emailKey string) error {
+	ipWait, err := ipLimiter.Check(clientIP)
+	if err != nil {
+		return err
+	}
+	emailWait, err := emailLimiter.Check(emailKey)
+	if err != nil {
+		return err
+	}
+	if wait := max(ipWait, emailWait); wait > 0 {
+		return &limiter.LockedError{RetryAfter: wait}
+	}
+
+	ipLockout, err := ipLimiter.Fail(clientIP)
+	if err != nil {
+		return err
+	}
+	emailLockout, err := emailLimiter.Fail(emailKey)
+	if err != nil {
+		return err
+	}
+	if wait := max(ipLockout, emailLockout); wait > 0 {
+		return &limiter.LockedError{RetryAfter: wait}
+	}
+	return nil
+}
+
+// sendForgotPasswordLink implements ForgotPassword once the request has
+// passed the rate limits. Unknown tenants and emails are not an error.
+func (s *PasswordService) sendForgotPasswordLink(tenant, email string) error {
+	t, err := s.tenantService.tenantBySlug(tenant)
+	if err != nil {
+		if errors.Is(err, ErrTenantNotFound) {
+			return nil
+		}
+		return err
+	}
+	user, err := s.userRepo.FindByEmail(t.ID, email)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	return s.sendResetLink(user, s.cfg.PasswordResetExpiry, "Reset your password",
+		"Use this link to choose a new password:",
+		"If you did not ask to reset your password, you can ignore this email.")
+}
+
+// SendInvite emails a user created by an admin without a password a link to
+// choose one. The link is a password reset link valid for cfg.InviteExpiry.
+func (s *PasswordService) SendInvite(user *models.User) error {
+	return s.sendResetLink(user, s.cfg.InviteExpiry, "You have been invited",
+		"An account was created for you. Use this link to choose your password:",
+		"")
+}
+
+// SendForcedReset emails a user whose password was cleared by an admin a
+// link to choose a new one.
+func (s *PasswordService) SendForcedReset(user *models.User) error {
+	return s.sendResetLink(user, s.cfg.PasswordResetExpiry, "Choose a new password",
+		"An administrator has required you to choose a new password and signed out all your devices. "+
+			"Use this link to choose one:",
+		"")
+}
+
+// ResetPassword sets a new password using a token from ForgotPassword and
+// revokes every session of the user, including slave app sessions. Other
+// reset links of the user stop working. The token, the new password, the
+// revocation and the reset links change in one transaction.
+func (s *PasswordService) ResetPassword(token, newPassword string) error {
+	reset, err := s.resetRepo.FindByToken(hashCode(s.cfg.OTCPepper, token))
+	if err != nil {
+		return notFound(err, ErrResetTokenInvalid)
+	}
+	if reset.Used || time.Now().After(reset.ExpiresAt) {
+		return ErrResetTokenInvalid
+	}
+
+	user, err := s.userRepo.FindByID(nil, reset.UserID)
+	if err != nil {
+		return notFound(err, ErrResetTokenInvalid)
+	}
+	if err := validatePassword(s.cfg, user.Email, newPassword); err != nil {
+		return err
+	}
+
+	hash, err := s.hasher.Hash(newPassword)
+	if err != nil {
+		return err
+	}
+
+	// The token, the password and the revocation change in one transaction;
+	// a concurrent reset with the same token loses there
+	if err := s.resetRepo.ResetPassword(reset, hash); err != nil {
+		if errors.Is(err, repository.ErrResetTokenUsed) {
+			return ErrResetTokenInvalid
+		}
+		return err
+	}
+
+	s.notifyPasswordChanged(user, "The password of your account was just reset and all devices were signed out.\n\n"+
+		"If you did not do this, reset your password again immediately and contact support.\n")
+	return nil
+}
+
+// ChangePassword replaces the password of a signed-in user after checking
+// the current one, and revokes every other session of the user (including
+// slave app sessions) while keeping sessionID signed in. Outstanding reset
+// links stop working. The new password, the revocation and the reset links
+// change in one transaction. Wrong current passwords count towards the same
+// lockouts as failed logins.
+func (s *PasswordService) ChangePassword(userID, sessionID uuid.UUID, currentPassword, newPassword, clientIP string) error {
+	user, err := s.userRepo.FindByID(nil, userID)
+	if err != nil {
+		return ErrUserNotFound
+	}
+
+	if err := s.authService.checkLockout(user, clientIP); err != nil {
+		return err
+	}
+	if ok, _, _ := s.hasher.Verify(user.PasswordHash, currentPassword); !ok {
+		if err := s.authService.recordLoginFailure(user, clientIP); err != nil {
+			return err
+		}
+		return ErrInvalidCredentials
+	}
+
+	if newPassword == currentPassword {
+		return &PasswordPolicyError{Reason: "must differ from the current password"}
+	}
+	if err := validatePassword(s.cfg, user.Email, newPassword); err != nil {
+		return err
+	}
+
+	hash, err := s.hasher.Hash(newPassword)
+	if err != nil {
+		return err
+	}
+	if err := s.userRepo.ChangePassword(user.ID, hash, sessionID); err != nil {
+		return err
+	}
+
+	s.notifyPasswordChanged(user, "The password of your account was just changed and all other devices were signed out.\n\n"+
+		"If you did not do this, reset your password immediately and contact support.\n")
+	return nil
+}
+
+// notifyPasswordChanged emails the user that their password changed. The
+// change is already committed, so a mail failure is logged, not returned.
+func (s *PasswordService) notifyPasswordChanged(user *models.User, body string) {
+	err := s.mailer.Send(&mail.Message{
+		To:      user.Email,
+		Subject: "Your password was changed",
+		Body:    body,
+	})
+	if err != nil {
+		log.Printf("⚠️  Failed to send password change notice to user %s: %v", user.ID, err)
+	}
+}
+
+// sendResetLink issues a single-use reset token for user, invalidating any
+// earlier one, and emails the link between intro and outro.
+func (s *PasswordService) sendResetLink(user *models.User, expiry time.Duration, subject, intro, outro string) error {
+	// 32 random bytes → 64 hex chars
+	tokenBytes := make([]byte, 32)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return ErrCodeGeneration
+	}
+	token := hex.EncodeToString(tokenBytes)
+
+	err := s.resetRepo.Replace(&models.PasswordResetToken{
+		UserID:    user.ID,
+		TokenHash: hashCode(s.cfg.OTCPepper, token),
+		ExpiresAt: time.Now().Add(expiry),
+	})
+	if err != nil {
+		return err
+	}
+
+	link := s.cfg.PasswordResetURL + "?token=" + url.QueryEscape(token)
+	body := fmt.Sprintf("%s\n\n%s\n\nThe link expires in %s and can be used once.", intro, link, expiry)
+	if outro != "" {
+		body += " " + outro
+	}
+	return s.mailer.Send(&mail.Message{
+		To:      user.Email,
+		Subject: subject,
+		Body:    body + "\n",
+	})
+}
+
+// CleanExpiredResetTokens removes expired and used reset tokens (call periodically).
+func (s *PasswordService) CleanExpiredResetTokens() error {
+	return s.resetRepo.CleanExpired()
+}
+
+// CleanLimiters drops expired reset link request counters (call periodically).
+func (s *PasswordService) CleanLimiters() error {
+	if err := s.forgotIPLimiter.Cleanup(); err != nil {
+		return err
+	}
+	return s.forgotEmailLimiter.Cleanup()
+}
@@ -0,0 +1,401 @@
+package service
+
+import (
+	"errors"
+	"time"
+
+	"github.com/cachatto/master-slave-server/internal/models"
+	"github.com/cachatto/master-slave-server/internal/repository"
+	"github.com/google/uuid"
+)
+
+// Common errors returned by PermissionService.
+var (
+	ErrUnknownApps      = errors.New("one or more app_ids do not exist")
+	ErrUnknownUsers     = errors.New("one or more user_ids do not exist")
+	ErrScopeNotDeclared = errors.New("scopes must be declared by every app being granted")
+	ErrInvalidWindow    = errors.New("valid_until must be in the future and after valid_from")
+)
+
+// GrantWindow limits a user's permission to the time from ValidFrom
+// (inclusive) until ValidUntil (exclusive). Nil leaves that side unbounded.
+type GrantWindow struct {
+	ValidFrom  *time.Time
+	ValidUntil *time.Time
+}
+
+// validate returns ErrInvalidWindow if the window ends before it starts or
+// has already ended.
+func (w GrantWindow) validate() error {
+	if w.ValidUntil == nil {
+		return nil
+	}
+	if !w.ValidUntil.After(time.Now()) || (w.ValidFrom != nil && !w.ValidUntil.After(*w.ValidFrom)) {
+		return ErrInvalidWindow
+	}
+	return nil
+}
+
+// AppGrant is an app a user is permitted to use, with the granted scopes.
+type AppGrant struct {
+	App    models.App `json:"app"`
+	Scopes []string   `json:"scopes"`
+}
+
+// UserGrant is a user permitted to use an app, with the granted scopes and
+// the validity window of the grant.
+type UserGrant struct {
+	User       models.User `json:"user"`
+	Scopes     []string    `json:"scopes"`
+	ValidFrom  *time.Time  `json:"valid_from,omitempty"`
+	ValidUntil *time.Time  `json:"valid_until,omitempty"`
+}
+
+// UserGrantPage is one page of the users permitted to use an app.
+type UserGrantPage struct {
+	Users    []UserGrant `json:"users"`
+	Page     int         `json:"page"`
+	PageSize int         `json:"page_size"`
+	Total    int64       `json:"total"`
+}
+
+// PermissionService manages which users and groups may use which slave
+// apps. A user may use an app granted to them directly or to one of their
+// groups, with the union of the granted scopes.
+//
+// App-admins can only grant and revoke the apps they own, and tenant-admins
+// the apps of their tenant; other apps are reported as unknown. Apps are
+// only granted to users and groups of the app's tenant.
+//
+// Revoking a permission takes effect immediately: unless the user is still
+// permitted through another grant, their outstanding one-time codes and
+// authorization codes for the app are deleted and their sessions with the
+// app are revoked, which also rejects the app's access tokens.
+//
+// Direct grants can be limited to a GrantWindow. Outside it the grant
+// permits nothing: tokens cannot be issued or refreshed for the app, and
+// ExpireGrants revokes the access of grants that have ended.
+type PermissionService struct {
+	permRepo  *repository.PermissionRepository
+	appRepo   *repository.AppRepository
+	userRepo  *repository.UserRepository
+	groupRepo *repository.GroupRepository
+}
+
+// NewPermissionService creates a new PermissionService.
+func NewPermissionService(
+	permRepo *repository.PermissionRepository,
+	appRepo *repository.AppRepository,
+	userRepo *repository.UserRepository,
+	groupRepo *repository.GroupRepository,
+) *PermissionService {
+	return &PermissionService{permRepo: permRepo, appRepo: appRepo, userRepo: userRepo, groupRepo: groupRepo}
+}
+
+// ListUserApps returns the apps a user is permitted to use, directly or
+// through a group, with the effective scopes, limited to the apps actor may
+// manage.
+func (s *PermissionService) ListUserApps(actor Actor, userID uuid.UUID) ([]AppGrant, error) {
+	if _, err := s.accessibleUser(actor, userID); err != nil {
+		return nil, err
+	}
+
+	apps, err := s.appRepo.GetPermittedApps(actor.tenantScope(), userID)
+	if err != nil {
+		return nil, err
+	}
+	perms, err := s.appRepo.FindPermissions(userID)
+	if err != nil {
+		return nil, err
+	}
+	scopes := make(map[uuid.UUID][]string, len(perms))
+	for i := range perms {
+		scopes[perms[i].AppID] = perms[i].ScopeList()
+	}
+
+	grants := make([]AppGrant, 0, len(apps))
+	for i := range apps {
+		if actor.CanManageApp(&apps[i]) {
+			grants = append(grants, AppGrant{App: apps[i], Scopes: nonNil(scopes[apps[i].ID])})
+		}
+	}
+	return grants, nil
+}
+
+// GrantApps permits a user to use appIDs with the given scopes, which every
+// app must declare, within window. Existing permissions are replaced with
+// the new scopes and window.
+func (s *PermissionService) GrantApps(actor Actor, userID uuid.UUID, appIDs []uuid.UUID, scopes []string, window GrantWindow) error {
+	if err := window.validate(); err != nil {
+		return err
+	}
+	user, err := s.accessibleUser(actor, userID)
+	if err != nil {
+		return err
+	}
+
+	apps, err := s.manageableApps(actor, appIDs)
+	if err != nil {
+		return err
+	}
+
+	perms := make([]models.UserAppPermission, len(apps))
+	for i := range apps {
+		if apps[i].TenantID != user.TenantID {
+			return ErrUnknownApps
+		}
+		if !isSubset(scopes, apps[i].ScopeList()) {
+			return ErrScopeNotDeclared
+		}
+		perms[i] = models.UserAppPermission{
+			UserID:     userID,
+			AppID:      apps[i].ID,
+			Scopes:     joinScopes(scopes),
+			ValidFrom:  window.ValidFrom,
+			ValidUntil: window.ValidUntil,
+		}
+	}
+	return s.permRepo.Grant(perms)
+}
+
+// RevokeApps withdraws a user's permission to use appIDs.
+func (s *PermissionService) RevokeApps(actor Actor, userID uuid.UUID, appIDs []uuid.UUID) error {
+	if _, err := s.accessibleUser(actor, userID); err != nil {
+		return err
+	}
+
+	apps, err := s.manageableApps(actor, appIDs)
+	if err != nil {
+		return err
+	}
+	ids := make([]uuid.UUID, len(apps))
+	for i := range apps {
+		ids[i] = apps[i].ID
+	}
+	return s.permRepo.RevokeForUser(userID, ids)
+}
+
+// ListAppUsers returns one page of the users directly permitted to use an
+// app with the granted scopes and windows; page is 1-based. Grants outside
+// their window are listed too.
+func (s *PermissionService) ListAppUsers(actor Actor, appID uuid.UUID, page, pageSize int) (*UserGrantPage, error) {
+	if _, err := s.manageableApp(actor, appID); err != nil {
+		return nil, err
+	}
+
+	users, total, err := s.permRepo.UsersForApp(appID, (page-1)*pageSize, pageSize)
+	if err != nil {
+		return nil, err
+	}
+	userIDs := make([]uuid.UUID, len(users))
+	for i := range users {
+		userIDs[i] = users[i].ID
+	}
+	perms, err := s.permRepo.ForApp(appID, userIDs)
+	if err != nil {
+		return nil, err
+	}
+	byUser := make(map[uuid.UUID]*models.UserAppPermission, len(perms))
+	for i := range perms {
+		byUser[perms[i].UserID] = &perms[i]
+	}
+
+	grants := make([]UserGrant, len(users))
+	for i := range users {
+		grants[i] = UserGrant{User: users[i], Scopes: []string{}}
+		if perm := byUser[users[i].ID]; perm != nil {
+			grants[i].Scopes = perm.ScopeList()
+			grants[i].ValidFrom = perm.ValidFrom
+			grants[i].ValidUntil = perm.ValidUntil
+		}
+	}
+	return &UserGrantPage{Users: grants, Page: page, PageSize: pageSize, Total: total}, nil
+}
+
+// GrantUsers permits userIDs, who must belong to the app's tenant, to use an
+// app with the given scopes, which the app must declare, within window.
+// Existing permissions are replaced with the new scopes and window.
+func (s *PermissionService) GrantUsers(actor Actor, appID uuid.UUID, userIDs []uuid.UUID, scopes []string, window GrantWindow) error {
+	if err := window.validate(); err != nil {
+		return err
+	}
+	app, err := s.manageableApp(actor, appID)
+	if err != nil {
+		return err
+	}
+	if !isSubset(scopes, app.ScopeList()) {
+		return ErrScopeNotDeclared
+	}
+
+	userIDs = uniqueIDs(userIDs)
+	users, err := s.userRepo.FindByIDs(&app.TenantID, userIDs)
+	if err != nil {
+		return err
+	}
+	if len(users) != len(userIDs) {
+		return ErrUnknownUsers
+	}
+	for i := range users {
+		if users[i].TenantID != app.TenantID {
+			return ErrUnknownUsers
+		}
+	}
+
+	perms := make([]models.UserAppPermission, len(userIDs))
+	for i, userID := range userIDs {
+		perms[i] = models.UserAppPermission{
+			UserID:     userID,
+			AppID:      appID,
+			Scopes:     joinScopes(scopes),
+			ValidFrom:  window.ValidFrom,
+			ValidUntil: window.ValidUntil,
+		}
+	}
+	return s.permRepo.Grant(perms)
+}
+
+// RevokeUsers withdraws the permission of userIDs to use an app.
+func (s *PermissionService) RevokeUsers(actor Actor, appID uuid.UUID, userIDs []uuid.UUID) error {
+	if _, err := s.manageableApp(actor, appID); err != nil {
+		return err
+	}
+	return s.permRepo.RevokeForApp(appID, uniqueIDs(userIDs))
+}
+
+// ExpireGrants revokes the access of the direct grants whose window has
+// ended since the last run (call every GrantExpiryInterval), records a
+// grant event for each and returns them, so that each expiry is reported
+// once.
+func (s *PermissionService) ExpireGrants() ([]models.UserAppPermission, error) {
+	return s.permRepo.ExpireGrants()
+}
+
+// ListGroupApps returns the apps a group is permitted to use with the
+// granted scopes, limited to the apps actor may manage.
+func (s *PermissionService) ListGroupApps(actor Actor, groupID uuid.UUID) ([]AppGrant, error) {
+	if _, err := s.accessibleGroup(actor, groupID); err != nil {
+		return nil, err
+	}
+
+	perms, err := s.groupRepo.Permissions(groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	grants := make([]AppGrant, 0, len(perms))
+	for i := range perms {
+		if actor.CanManageApp(&perms[i].App) {
+			grants = append(grants, AppGrant{App: perms[i].App, Scopes: perms[i].ScopeList()})
+		}
+	}
+	return grants, nil
+}
+
+// GrantGroupApps permits every member of a group to use appIDs with the
+// given scopes, which every app must declare. Existing group permissions
+// are replaced with the new scopes.
+func (s *PermissionService) GrantGroupApps(actor Actor, groupID uuid.UUID, appIDs []uuid.UUID, scopes []string) error {
+	group, err := s.accessibleGroup(actor, groupID)
+	if err != nil {
+		return err
+	}
+
+	apps, err := s.manageableApps(actor, appIDs)
+	if err != nil {
+		return err
+	}
+
+	perms := make([]models.GroupAppPermission, len(apps))
+	for i := range apps {
+		if apps[i].TenantID != group.TenantID {
+			return ErrUnknownApps
+		}
+		if !isSubset(scopes, apps[i].ScopeList()) {
+			return ErrScopeNotDeclared
+		}
+		perms[i] = models.GroupAppPermission{GroupID: groupID, AppID: apps[i].ID, Scopes: joinScopes(scopes)}
+	}
+	return s.groupRepo.GrantApps(perms)
+}
+
+// RevokeGroupApps withdraws a group's permission to use appIDs.
+func (s *PermissionService) RevokeGroupApps(actor Actor, groupID uuid.UUID, appIDs []uuid.UUID) error {
+	if _, err := s.accessibleGroup(actor, groupID); err != nil {
+		return err
+	}
+
+	apps, err := s.manageableApps(actor, appIDs)
+	if err != nil {
+		return err
+	}
+	ids := make([]uuid.UUID, len(apps))
+	for i := range apps {
+		ids[i] = apps[i].ID
+	}
+	return s.groupRepo.RevokeApps(groupID, ids)
+}
+
+// accessibleUser returns a user, or ErrUserNotFound unless the user exists
+// in a tenant actor can access.
+func (s *PermissionService) accessibleUser(actor Actor, userID uuid.UUID) (*models.User, error) {
+	user, err := s.userRepo.FindByID(actor.tenantScope(), userID)
+	if err != nil {
+		return nil, notFound(err, ErrUserNotFound)
+	}
+	return user, nil
+}
+
+// accessibleGroup returns a group, or ErrGroupNotFound unless the group
+// exists in a tenant actor can access.
+func (s *PermissionService) accessibleGroup(actor Actor, groupID uuid.UUID) (*models.Group, error) {
+	group, err := s.groupRepo.FindByID(actor.tenantScope(), groupID)
+	if err != nil {
+		return nil, notFound(err, ErrGroupNotFound)
+	}
+	return group, nil
+}
+
+// manageableApp returns an app, or ErrAppNotFound unless it exists and
+// actor may manage it.
+func (s *PermissionService) manageableApp(actor Actor, appID uuid.UUID) (*models.App, error) {
+	app, err := s.appRepo.FindByID(actor.tenantScope(), appID)
+	if err != nil {
+		return nil, notFound(err, ErrAppNotFound)
+	}
+	if !actor.CanManageApp(app) {
+		return nil, ErrAppNotFound
+	}
+	return app, nil
+}
+
+// manageableApps returns the apps in appIDs, or ErrUnknownApps unless every
+// app exists and actor may manage it.
+func (s *PermissionService) manageableApps(actor Actor, appIDs []uuid.UUID) ([]models.App, error) {
+	appIDs = uniqueIDs(appIDs)
+	apps, err := s.appRepo.FindByIDs(actor.tenantScope(), appIDs)
+	if err != nil {
+		return nil, err
+	}
+	if len(apps) != len(appIDs) {
+		return nil, ErrUnknownApps
+	}
+	for i := range apps {
+		if !actor.CanManageApp(&apps[i]) {
+			return nil, ErrUnknownApps
+		}
+	}
+	return apps, nil
+}
+
+// uniqueIDs returns ids without duplicates, keeping the first occurrence.
+func uniqueIDs(ids []uuid.UUID) []uuid.UUID {
+	seen := make(map[uuid.UUID]bool, len(ids))
+	unique := make([]uuid.UUID, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
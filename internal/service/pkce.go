@@ -0,0 +1,30 @@
+package service
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"regexp"
+)
+
+// PKCEMethodS256 is the only supported PKCE code challenge method (RFC 7636).
+const PKCEMethodS256 = "S256"
+
+// pkceValuePattern matches a code verifier or S256 challenge: 43-128 characters
+// from the unreserved URI character set.
+var pkceValuePattern = regexp.MustCompile(`^[A-Za-z0-9\-._~]{43,128}$`)
+
+// validCodeChallenge reports whether challenge is a well-formed S256 challenge.
+func validCodeChallenge(challenge, method string) bool {
+	return method == PKCEMethodS256 && pkceValuePattern.MatchString(challenge)
+}
+
+// verifyPKCE checks that verifier hashes to the stored S256 challenge.
+func verifyPKCE(challenge, verifier string) bool {
+	if !pkceValuePattern.MatchString(verifier) {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	computed := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
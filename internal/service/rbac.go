@@ -0,0 +1,114 @@
+package service
+
+import (
+	"errors"
+	"slices"
+
+	"github.com/cachatto/master-slave-server/internal/models"
+	"github.com/google/uuid"
+)
+
+// ErrForbidden is returned when an actor's role does not allow an action.
+var ErrForbidden = errors.New("your role does not allow this action")
+
+// Roles a user can have. The role is stored on the user and carried in the
+// "role" claim of Master app access tokens. Superadmins act on every
+// tenant; the other roles only act within their own tenant.
+const (
+	RoleSuperadmin  = "superadmin"
+	RoleTenantAdmin = "tenant-admin"
+	RoleAppAdmin    = "app-admin"
+	RoleUser        = "user"
+)
+
+// Permission is a capability granted to roles.
+type Permission string
+
+// Permissions checked by the admin API.
+const (
+	// PermManageUsers allows creating, disabling, deleting and restoring
+	// users, resetting their passwords and changing their roles.
+	PermManageUsers Permission = "users:manage"
+	// PermReadUsers allows looking users up, e.g. to grant them an app.
+	PermReadUsers Permission = "users:read"
+	// PermCreateApps allows registering and deleting slave apps and
+	// assigning their owners.
+	PermCreateApps Permission = "apps:create"
+	// PermManageApps allows editing slave apps and granting and revoking
+	// their permissions. App-admins may only manage the apps they own.
+	PermManageApps Permission = "apps:manage"
+	// PermManageGroups allows creating, editing and deleting groups and
+	// changing their members. Granting apps to groups is PermManageApps.
+	PermManageGroups Permission = "groups:manage"
+	// PermManageTenants allows creating and editing tenants.
+	PermManageTenants Permission = "tenants:manage"
+)
+
+// rolePermissions lists the permissions of each role.
+var rolePermissions = map[string][]Permission{
+	RoleSuperadmin:  {PermManageUsers, PermReadUsers, PermCreateApps, PermManageApps, PermManageGroups, PermManageTenants},
+	RoleTenantAdmin: {PermManageUsers, PermReadUsers, PermCreateApps, PermManageApps, PermManageGroups},
+	RoleAppAdmin:    {PermReadUsers, PermManageApps},
+	RoleUser:        {},
+}
+
+// ValidRole reports whether role is one of the known roles.
+func ValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// RoleHasPermission reports whether role grants perm.
+func RoleHasPermission(role string, perm Permission) bool {
+	return slices.Contains(rolePermissions[role], perm)
+}
+
+// Actor is the signed-in user on whose behalf an admin action runs.
+type Actor struct {
+	UserID   uuid.UUID
+	Role     string
+	TenantID uuid.UUID
+}
+
+// Can reports whether the actor's role grants perm.
+func (a Actor) Can(perm Permission) bool {
+	return RoleHasPermission(a.Role, perm)
+}
+
+// CanAccessTenant reports whether the actor may act on the users, apps and
+// groups of tenantID: superadmins act on every tenant, other roles only on
+// their own.
+func (a Actor) CanAccessTenant(tenantID uuid.UUID) bool {
+	return a.Role == RoleSuperadmin || tenantID == a.TenantID
+}
+
+// CanManageApp reports whether the actor may manage app: superadmins manage
+// every app, tenant-admins the apps of their tenant and app-admins only the
+// apps they own.
+func (a Actor) CanManageApp(app *models.App) bool {
+	if !a.CanAccessTenant(app.TenantID) {
+		return false
+	}
+	if a.Can(PermCreateApps) {
+		return true
+	}
+	return a.Can(PermManageApps) && app.OwnerID != nil && *app.OwnerID == a.UserID
+}
+
+// tenantScope returns the tenant that listings must be restricted to, or nil
+// if the actor may see every tenant.
+func (a Actor) tenantScope() *uuid.UUID {
+	if a.Role == RoleSuperadmin {
+		return nil
+	}
+	return &a.TenantID
+}
+
+// ownerScope returns the owner that app listings must be restricted to, or
+// nil if the actor may see every app of the tenants it can access.
+func (a Actor) ownerScope() *uuid.UUID {
+	if a.Can(PermCreateApps) {
+		return nil
+	}
+	return &a.UserID
+}
@@ -0,0 +1,203 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/cachatto/master-slave-server/internal/config"
+	"github.com/cachatto/master-slave-server/internal/limiter"
+	"github.com/cachatto/master-slave-server/internal/mail"
+	"github.com/cachatto/master-slave-server/internal/models"
+	"github.com/cachatto/master-slave-server/internal/pwhash"
+	"github.com/cachatto/master-slave-server/internal/repository"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// RegistrationService handles self-service sign-up and email verification.
+//
+// Responses never reveal whether an email already has an account: signing
+// up with a registered email sends that address a notice (or a new
+// verification link if it is still unverified) instead of failing.
+// Sign-ups and verification resends both send mail, so they are
+// rate-limited together per client IP (signupIPLimiter) and per tenant and
+// email (signupEmailLimiter).
+type RegistrationService struct {
+	userRepo           *repository.UserRepository
+	tenantService      *TenantService
+	authService        *AuthService
+	keys               *KeySet
+	hasher             *pwhash.Hasher
+	mailer             mail.Sender
+	signupIPLimiter    limiter.Limiter
+	signupEmailLimiter limiter.Limiter
+	cfg                *config.Config
+}
+
+// NewRegistrationService creates a new RegistrationService.
+func NewRegistrationService(
+	userRepo *repository.UserRepository,
+	tenantService *TenantService,
+	authService *AuthService,
+	keys *KeySet,
+	hasher *pwhash.Hasher,
+	mailer mail.Sender,
+	signupIPLimiter limiter.Limiter,
+	signupEmailLimiter limiter.Limiter,
+	cfg *config.Config,
+) *RegistrationService {
+	return &RegistrationService{
+		userRepo:           userRepo,
+		tenantService:      tenantService,
+		authService:        authService,
+		keys:               keys,
+		hasher:             hasher,
+		mailer:             mailer,
+		signupIPLimiter:    signupIPLimiter,
+		signupEmailLimiter: signupEmailLimiter,
+		cfg:                cfg,
+	}
+}
+
+// Register creates an unverified account in the tenant with the given slug
+// (the default tenant if empty) and emails a verification link. The user
+// cannot log in until the link has been followed. Once the client IP or the
+// email has made too many requests, a *limiter.LockedError is returned.
+func (s *RegistrationService) Register(tenant, email, password, clientIP string) error {
+	t, err := s.tenantService.tenantBySlug(tenant)
+	if err != nil {
+		return err
+	}
+
+	email = normalizeEmail(email)
+	if err := validatePassword(s.cfg, email, password); err != nil {
+		return err
+	}
+	if err := throttleMail(s.signupIPLimiter, s.signupEmailLimiter, clientIP, t.ID.String()+"|"+email); err != nil {
+		return err
+	}
+
+	if existing, err := s.userRepo.FindByEmail(t.ID, email); err == nil {
+		if existing.EmailVerifiedAt == nil {
+			return s.sendVerification(existing)
+		}
+		return s.mailer.Send(&mail.Message{
+			To:      existing.Email,
+			Subject: "You already have an account",
+			Body: "Someone tried to create an account with this email address, but you already have one.\n\n" +
+				"If this was you, sign in or reset your password instead. Otherwise you can ignore this email.\n",
+		})
+	}
+
+	hash, err := s.hasher.Hash(password)
+	if err != nil {
+		return err
+	}
+
+	user := &models.User{TenantID: t.ID, Email: email, PasswordHash: hash, Role: RoleUser}
+	if err := s.userRepo.Create(user); err != nil {
+		if errors.Is(err, repository.ErrEmailTaken) {
+			// Lost a race with a concurrent sign-up, or the email belongs to a deleted account
+			return nil
+		}
+		return err
+	}
+
+	return s.sendVerification(user)
+}
+
+// ResendVerification emails a new verification link if email belongs to an
+// unverified account of the tenant with the given slug (the default tenant
+// if empty), and does nothing otherwise. It counts towards the same limits
+// as Register, for every email.
+func (s *RegistrationService) ResendVerification(tenant, email, clientIP string) error {
+	email = normalizeEmail(email)
+	t, err := s.tenantService.tenantBySlug(tenant)
+	if err != nil {
+		if errors.Is(err, ErrTenantNotFound) {
+			// Unknown tenants are throttled like unknown emails
+			return throttleMail(s.signupIPLimiter, s.signupEmailLimiter, clientIP, s.tenantService.normalizeSlug(tenant)+"|"+email)
+		}
+		return err
+	}
+	if err := throttleMail(s.signupIPLimiter, s.signupEmailLimiter, clientIP, t.ID.String()+"|"+email); err != nil {
+		return err
+	}
+
+	user, err := s.userRepo.FindByEmail(t.ID, email)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	if user.EmailVerifiedAt != nil {
+		return nil
+	}
+	return s.sendVerification(user)
+}
+
+// CleanLimiters drops expired sign-up counters (call periodically).
+func (s *RegistrationService) CleanLimiters() error {
+	if err := s.signupIPLimiter.Cleanup(); err != nil {
+		return err
+	}
+	return s.signupEmailLimiter.Cleanup()
+}
+
+// VerifyEmail confirms the email address of the user a verification token
+// was issued to. Following a link again after verifying is harmless.
+func (s *RegistrationService) VerifyEmail(token string) error {
+	claims, err := s.authService.parseToken(token, MasterAudience)
+	if err != nil {
+		return err
+	}
+	if claims.Type != "email_verify" {
+		return ErrInvalidTokenType
+	}
+
+	user, err := s.userRepo.FindByID(&claims.TenantID, claims.UserID)
+	if err != nil {
+		return ErrUserNotFound
+	}
+	// The link is only valid for the address it was sent to
+	if user.Email != claims.Email {
+		return ErrInvalidToken
+	}
+
+	return s.userRepo.MarkEmailVerified(user.ID)
+}
+
+// sendVerification emails a signed verification link to a user.
+func (s *RegistrationService) sendVerification(user *models.User) error {
+	now := time.Now()
+	claims := JWTClaims{
+		UserID: user.ID,
+		Email:  user.Email,
+		Type:   "email_verify",
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			Subject:   user.ID.String(),
+			Audience:  jwt.ClaimStrings{MasterAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.cfg.EmailVerificationExpiry)),
+			Issuer:    "master-slave-server",
+		},
+	}
+	token, err := s.keys.Sign(claims)
+	if err != nil {
+		return err
+	}
+
+	link := s.cfg.OIDCIssuer + "/auth/verify-email?token=" + url.QueryEscape(token)
+	return s.mailer.Send(&mail.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Confirm your email address to finish creating your account:\n\n%s\n\n"+
+			"The link expires in %s. If you did not sign up, you can ignore this email.\n",
+			link, s.cfg.EmailVerificationExpiry),
+	})
+}
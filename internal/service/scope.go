@@ -0,0 +1,72 @@
+package service
+
+import (
+	"errors"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// ErrInvalidScopes is returned when a scope list contains malformed or
+// reserved scope names.
+var ErrInvalidScopes = errors.New("scopes must be 1-64 characters of a-z, 0-9, '_', '-', '.' or ':', starting with a letter, and must not be openid or email")
+
+// scopePattern matches a single app scope name.
+var scopePattern = regexp.MustCompile(`^[a-z][a-z0-9_.:-]{0,63}$`)
+
+// validateScopes checks that every scope is well-formed and not one of the
+// OIDC scopes, which have a fixed meaning.
+func validateScopes(scopes []string) error {
+	for _, sc := range scopes {
+		if !scopePattern.MatchString(sc) || sc == ScopeOpenID || sc == ScopeEmail {
+			return ErrInvalidScopes
+		}
+	}
+	return nil
+}
+
+// intersectScopes returns the scopes of requested that are also in every
+// one of allowed, without duplicates and in the order requested.
+func intersectScopes(requested []string, allowed ...[]string) []string {
+	result := []string{}
+	for _, sc := range requested {
+		if slices.Contains(result, sc) {
+			continue
+		}
+		ok := true
+		for _, set := range allowed {
+			if !slices.Contains(set, sc) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			result = append(result, sc)
+		}
+	}
+	return result
+}
+
+// isSubset reports whether every scope in scopes is in allowed.
+func isSubset(scopes, allowed []string) bool {
+	for _, sc := range scopes {
+		if !slices.Contains(allowed, sc) {
+			return false
+		}
+	}
+	return true
+}
+
+// joinScopes returns scopes without duplicates as a space-separated list.
+func joinScopes(scopes []string) string {
+	return strings.Join(intersectScopes(scopes), " ")
+}
+
+// nonNil returns scopes, or an empty list if scopes is nil, so that it is
+// encoded as [] rather than null.
+func nonNil(scopes []string) []string {
+	if scopes == nil {
+		return []string{}
+	}
+	return scopes
+}
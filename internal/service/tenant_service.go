@@ -0,0 +1,211 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/cachatto/master-slave-server/internal/config"
+	"github.com/cachatto/master-slave-server/internal/models"
+	"github.com/cachatto/master-slave-server/internal/repository"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Common errors returned by TenantService.
+var (
+	ErrTenantNotFound    = errors.New("tenant not found")
+	ErrTenantSlugTaken   = errors.New("a tenant with this slug already exists")
+	ErrInvalidTenantName = errors.New("name must be between 1 and 255 characters")
+	ErrInvalidTenantSlug = errors.New("slug must be 1-63 characters of a-z, 0-9 and '-', starting with a letter or digit")
+	ErrDefaultTenantSlug = errors.New("the slug of the default tenant cannot be changed while DEFAULT_TENANT names it")
+)
+
+// tenantSlugPattern matches a tenant slug.
+var tenantSlugPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+
+// TenantInput holds the fields of a tenant that superadmins can set. Nil
+// fields are left unchanged on update.
+type TenantInput struct {
+	Name *string
+	Slug *string
+}
+
+// TenantPage is one page of tenants.
+type TenantPage struct {
+	Tenants  []models.Tenant `json:"tenants"`
+	Page     int             `json:"page"`
+	PageSize int             `json:"page_size"`
+	Total    int64           `json:"total"`
+}
+
+// TenantService manages tenants and resolves the tenant of each request.
+//
+// Clients name a tenant by its slug when signing in or signing up; without
+// one they use the default tenant (cfg.DefaultTenant).
+type TenantService struct {
+	tenantRepo *repository.TenantRepository
+	cfg        *config.Config
+}
+
+// NewTenantService creates a new TenantService.
+func NewTenantService(tenantRepo *repository.TenantRepository, cfg *config.Config) *TenantService {
+	return &TenantService{tenantRepo: tenantRepo, cfg: cfg}
+}
+
+// migratedTenantSlug is the slug of the tenant that migration
+// 017_tenants.sql moves existing users, apps and groups to.
+const migratedTenantSlug = "default"
+
+// EnsureDefaultTenant returns the default tenant (called at startup). If no
+// tenant has the configured slug but the tenant created by the tenants
+// migration exists, that tenant is renamed, so existing accounts stay in
+// the tenant sign-in uses. Otherwise the default tenant is created.
+func (s *TenantService) EnsureDefaultTenant() (*models.Tenant, error) {
+	tenant, err := s.tenantRepo.FindBySlug(s.cfg.DefaultTenant)
+	if err == nil {
+		return tenant, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	if s.cfg.DefaultTenant != migratedTenantSlug {
+		tenant, err := s.tenantRepo.FindBySlug(migratedTenantSlug)
+		switch {
+		case err == nil:
+			log.Printf("🏢 Renaming tenant %q to DEFAULT_TENANT=%q", migratedTenantSlug, s.cfg.DefaultTenant)
+			tenant.Slug = s.cfg.DefaultTenant
+			if err := s.tenantRepo.Update(tenant); err != nil {
+				return nil, err
+			}
+			return tenant, nil
+		case !errors.Is(err, gorm.ErrRecordNotFound):
+			return nil, err
+		}
+	}
+
+	tenant = &models.Tenant{Name: "Default", Slug: s.cfg.DefaultTenant}
+	if err := s.tenantRepo.Create(tenant); err != nil {
+		if errors.Is(err, repository.ErrTenantSlugTaken) {
+			// Created concurrently by another instance
+			return s.tenantRepo.FindBySlug(s.cfg.DefaultTenant)
+		}
+		return nil, err
+	}
+	return tenant, nil
+}
+
+// CreateTenant creates a tenant. Name and Slug are required.
+func (s *TenantService) CreateTenant(input *TenantInput) (*models.Tenant, error) {
+	tenant := &models.Tenant{}
+	if err := applyTenantInput(tenant, input); err != nil {
+		return nil, err
+	}
+
+	if err := s.tenantRepo.Create(tenant); err != nil {
+		if errors.Is(err, repository.ErrTenantSlugTaken) {
+			return nil, ErrTenantSlugTaken
+		}
+		return nil, err
+	}
+	return tenant, nil
+}
+
+// ListTenants returns one page of tenants; page is 1-based.
+func (s *TenantService) ListTenants(page, pageSize int) (*TenantPage, error) {
+	tenants, total, err := s.tenantRepo.List((page-1)*pageSize, pageSize)
+	if err != nil {
+		return nil, err
+	}
+	return &TenantPage{Tenants: tenants, Page: page, PageSize: pageSize, Total: total}, nil
+}
+
+// GetTenant returns a single tenant.
+func (s *TenantService) GetTenant(tenantID uuid.UUID) (*models.Tenant, error) {
+	tenant, err := s.tenantRepo.FindByID(tenantID)
+	if err != nil {
+		return nil, notFound(err, ErrTenantNotFound)
+	}
+	return tenant, nil
+}
+
+// UpdateTenant changes the given fields of a tenant. Changing the slug
+// changes the name clients must sign in with. The slug of the default
+// tenant cannot be changed: requests naming no tenant would no longer find
+// it, and the next startup would create a new, empty default tenant.
+func (s *TenantService) UpdateTenant(tenantID uuid.UUID, input *TenantInput) (*models.Tenant, error) {
+	tenant, err := s.GetTenant(tenantID)
+	if err != nil {
+		return nil, err
+	}
+	slug := tenant.Slug
+	if err := applyTenantInput(tenant, input); err != nil {
+		return nil, err
+	}
+	if slug == s.cfg.DefaultTenant && tenant.Slug != slug {
+		return nil, ErrDefaultTenantSlug
+	}
+
+	if err := s.tenantRepo.Update(tenant); err != nil {
+		if errors.Is(err, repository.ErrTenantSlugTaken) {
+			return nil, ErrTenantSlugTaken
+		}
+		return nil, err
+	}
+	return tenant, nil
+}
+
+// tenantBySlug returns the tenant with slug, or the default tenant if slug
+// is empty.
+func (s *TenantService) tenantBySlug(slug string) (*models.Tenant, error) {
+	tenant, err := s.tenantRepo.FindBySlug(s.normalizeSlug(slug))
+	if err != nil {
+		return nil, notFound(err, ErrTenantNotFound)
+	}
+	return tenant, nil
+}
+
+// normalizeSlug returns the slug tenantBySlug looks up for slug, so every
+// spelling of one tenant shares one limiter key.
+func (s *TenantService) normalizeSlug(slug string) string {
+	if slug == "" {
+		slug = s.cfg.DefaultTenant
+	}
+	return strings.ToLower(strings.TrimSpace(slug))
+}
+
+// targetTenant returns the tenant an admin creates a user, app or group in:
+// the actor's own tenant if tenantID is nil. Only superadmins may name
+// another tenant.
+func (s *TenantService) targetTenant(actor Actor, tenantID *uuid.UUID) (uuid.UUID, error) {
+	if tenantID == nil {
+		return actor.TenantID, nil
+	}
+	if !actor.CanAccessTenant(*tenantID) {
+		return uuid.Nil, ErrForbidden
+	}
+	if _, err := s.tenantRepo.FindByID(*tenantID); err != nil {
+		return uuid.Nil, notFound(err, ErrTenantNotFound)
+	}
+	return *tenantID, nil
+}
+
+// applyTenantInput validates input and copies the set fields onto tenant.
+func applyTenantInput(tenant *models.Tenant, input *TenantInput) error {
+	if input.Name != nil {
+		tenant.Name = strings.TrimSpace(*input.Name)
+	}
+	if input.Slug != nil {
+		tenant.Slug = strings.TrimSpace(*input.Slug)
+	}
+
+	if tenant.Name == "" || len(tenant.Name) > 255 {
+		return ErrInvalidTenantName
+	}
+	if !tenantSlugPattern.MatchString(tenant.Slug) {
+		return ErrInvalidTenantSlug
+	}
+	return nil
+}
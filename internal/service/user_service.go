@@ -0,0 +1,286 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/cachatto/master-slave-server/internal/config"
+	"github.com/cachatto/master-slave-server/internal/models"
+	"github.com/cachatto/master-slave-server/internal/pwhash"
+	"github.com/cachatto/master-slave-server/internal/repository"
+	"github.com/google/uuid"
+)
+
+// Common errors returned by UserService.
+var (
+	ErrEmailTaken       = errors.New("a user with this email already exists")
+	ErrCannotModifySelf = errors.New("admins cannot disable, delete or change the role of their own account")
+	ErrInvalidRole      = errors.New("role must be superadmin, tenant-admin, app-admin or user")
+)
+
+// UserPage is one page of users.
+type UserPage struct {
+	Users    []models.User `json:"users"`
+	Page     int           `json:"page"`
+	PageSize int           `json:"page_size"`
+	Total    int64         `json:"total"`
+}
+
+// UserService handles admin user management.
+//
+// Tenant-admins only see and manage the users of their tenant; other users
+// are reported as not found. Only superadmins manage superadmins.
+//
+// Disabling, deleting or forcing a password reset revokes every session of
+// the user, so access tokens stop working immediately rather than when they
+// expire.
+type UserService struct {
+	userRepo        *repository.UserRepository
+	hasher          *pwhash.Hasher
+	authService     *AuthService
+	passwordService *PasswordService
+	tenantService   *TenantService
+	cfg             *config.Config
+}
+
+// NewUserService creates a new UserService.
+func NewUserService(
+	userRepo *repository.UserRepository,
+	hasher *pwhash.Hasher,
+	authService *AuthService,
+	passwordService *PasswordService,
+	tenantService *TenantService,
+	cfg *config.Config,
+) *UserService {
+	return &UserService{
+		userRepo:        userRepo,
+		hasher:          hasher,
+		authService:     authService,
+		passwordService: passwordService,
+		tenantService:   tenantService,
+		cfg:             cfg,
+	}
+}
+
+// CreateUser creates a user with a verified email and the given role
+// (RoleUser if empty) in the actor's tenant, or in tenantID for
+// superadmins. With an initial password the user can sign in right away;
+// without one they are emailed an invite link to choose a password. If the
+// invite cannot be sent, the error is logged and the user is still
+// returned; ForcePasswordReset sends them a new link.
+func (s *UserService) CreateUser(actor Actor, tenantID *uuid.UUID, email, password, role string) (*models.User, error) {
+	if role == "" {
+		role = RoleUser
+	}
+	if err := checkAssignableRole(actor, role); err != nil {
+		return nil, err
+	}
+	target, err := s.tenantService.targetTenant(actor, tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	user := &models.User{
+		TenantID:        target,
+		Email:           normalizeEmail(email),
+		PasswordHash:    pwhash.Unusable,
+		Role:            role,
+		EmailVerifiedAt: &now,
+	}
+
+	if password != "" {
+		if err := validatePassword(s.cfg, user.Email, password); err != nil {
+			return nil, err
+		}
+		hash, err := s.hasher.Hash(password)
+		if err != nil {
+			return nil, err
+		}
+		user.PasswordHash = hash
+	}
+
+	if err := s.userRepo.Create(user); err != nil {
+		if errors.Is(err, repository.ErrEmailTaken) {
+			return nil, ErrEmailTaken
+		}
+		return nil, err
+	}
+
+	if password == "" {
+		if err := s.passwordService.SendInvite(user); err != nil {
+			log.Printf("⚠️  Failed to send the invite to user %s: %v", user.ID, err)
+		}
+	}
+	return user, nil
+}
+
+// ListUsers returns one page of the users actor can see whose email
+// contains emailQuery; page is 1-based. With deleted set, soft-deleted users
+// are listed instead.
+func (s *UserService) ListUsers(actor Actor, emailQuery string, deleted bool, page, pageSize int) (*UserPage, error) {
+	users, total, err := s.userRepo.List(actor.tenantScope(), normalizeEmail(emailQuery), deleted, (page-1)*pageSize, pageSize)
+	if err != nil {
+		return nil, err
+	}
+	return &UserPage{Users: users, Page: page, PageSize: pageSize, Total: total}, nil
+}
+
+// GetUser returns a single user, including soft-deleted users.
+func (s *UserService) GetUser(actor Actor, userID uuid.UUID) (*models.User, error) {
+	user, err := s.userRepo.FindByIDUnscoped(actor.tenantScope(), userID)
+	if err != nil {
+		return nil, notFound(err, ErrUserNotFound)
+	}
+	return user, nil
+}
+
+// SetRole changes a user's role. The user's sessions are revoked so that
+// access tokens carrying the old role stop working.
+func (s *UserService) SetRole(actor Actor, userID uuid.UUID, role string) error {
+	if err := checkAssignableRole(actor, role); err != nil {
+		return err
+	}
+	if actor.UserID == userID {
+		return ErrCannotModifySelf
+	}
+
+	user, err := s.manageableUser(actor, userID)
+	if err != nil {
+		return err
+	}
+	if user.Role == role {
+		return nil
+	}
+
+	if err := s.userRepo.SetRole(userID, role); err != nil {
+		return notFound(err, ErrUserNotFound)
+	}
+	return s.authService.LogoutAll(userID)
+}
+
+// PromoteSuperadmins gives the superadmin role to the users of tenantID
+// with the given emails (called at startup with ADMIN_EMAILS and the
+// default tenant).
+func (s *UserService) PromoteSuperadmins(tenantID uuid.UUID, emails []string) error {
+	normalized := make([]string, len(emails))
+	for i, email := range emails {
+		normalized[i] = normalizeEmail(email)
+	}
+	return s.userRepo.PromoteByEmail(tenantID, normalized, RoleSuperadmin)
+}
+
+// DisableUser blocks a user from signing in and from obtaining tokens, and
+// revokes all their sessions.
+func (s *UserService) DisableUser(actor Actor, userID uuid.UUID) error {
+	if actor.UserID == userID {
+		return ErrCannotModifySelf
+	}
+
+	user, err := s.manageableUser(actor, userID)
+	if err != nil {
+		return err
+	}
+	// Keep the original timestamp when disabling twice
+	if user.DisabledAt == nil {
+		now := time.Now()
+		if err := s.userRepo.SetDisabled(userID, &now); err != nil {
+			return notFound(err, ErrUserNotFound)
+		}
+	}
+	return s.authService.LogoutAll(userID)
+}
+
+// EnableUser lifts a DisableUser. Revoked sessions stay revoked.
+func (s *UserService) EnableUser(actor Actor, userID uuid.UUID) error {
+	if _, err := s.manageableUser(actor, userID); err != nil {
+		return err
+	}
+	if err := s.userRepo.SetDisabled(userID, nil); err != nil {
+		return notFound(err, ErrUserNotFound)
+	}
+	return nil
+}
+
+// DeleteUser soft-deletes a user and revokes all their sessions. The
+// account can be brought back with RestoreUser.
+func (s *UserService) DeleteUser(actor Actor, userID uuid.UUID) error {
+	if actor.UserID == userID {
+		return ErrCannotModifySelf
+	}
+
+	if _, err := s.manageableUser(actor, userID); err != nil {
+		return err
+	}
+	if err := s.userRepo.Delete(userID); err != nil {
+		return notFound(err, ErrUserNotFound)
+	}
+	return s.authService.LogoutAll(userID)
+}
+
+// RestoreUser undoes DeleteUser. Revoked sessions stay revoked.
+func (s *UserService) RestoreUser(actor Actor, userID uuid.UUID) error {
+	user, err := s.GetUser(actor, userID)
+	if err != nil {
+		return err
+	}
+	if user.Role == RoleSuperadmin && actor.Role != RoleSuperadmin {
+		return ErrForbidden
+	}
+	if err := s.userRepo.Restore(userID); err != nil {
+		return notFound(err, ErrUserNotFound)
+	}
+	return nil
+}
+
+// ForcePasswordReset clears a user's password, revokes all their sessions
+// and emails them a link to choose a new password. Passkeys keep working.
+func (s *UserService) ForcePasswordReset(actor Actor, userID uuid.UUID) error {
+	user, err := s.manageableUser(actor, userID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.userRepo.ClearPassword(user.ID); err != nil {
+		return err
+	}
+	if err := s.authService.LogoutAll(user.ID); err != nil {
+		return err
+	}
+	return s.passwordService.SendForcedReset(user)
+}
+
+// UnlockUser clears a user's failed-login counter and account lockout.
+func (s *UserService) UnlockUser(actor Actor, userID uuid.UUID) error {
+	if _, err := s.manageableUser(actor, userID); err != nil {
+		return err
+	}
+	return s.authService.UnlockUser(userID)
+}
+
+// manageableUser returns a user that actor may manage. Users of tenants the
+// actor cannot access are reported as not found, and superadmins can only
+// be managed by superadmins.
+func (s *UserService) manageableUser(actor Actor, userID uuid.UUID) (*models.User, error) {
+	user, err := s.userRepo.FindByID(actor.tenantScope(), userID)
+	if err != nil {
+		return nil, notFound(err, ErrUserNotFound)
+	}
+	if user.Role == RoleSuperadmin && actor.Role != RoleSuperadmin {
+		return nil, ErrForbidden
+	}
+	return user, nil
+}
+
+// checkAssignableRole validates role and checks that actor may give it:
+// only superadmins can make superadmins.
+func checkAssignableRole(actor Actor, role string) error {
+	if !ValidRole(role) {
+		return ErrInvalidRole
+	}
+	if role == RoleSuperadmin && actor.Role != RoleSuperadmin {
+		return ErrForbidden
+	}
+	return nil
+}
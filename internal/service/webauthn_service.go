@@ -0,0 +1,350 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/cachatto/master-slave-server/internal/config"
+	"github.com/cachatto/master-slave-server/internal/models"
+	"github.com/cachatto/master-slave-server/internal/repository"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+)
+
+// Common errors returned by WebAuthnService.
+var (
+	ErrWebAuthnSessionInvalid = errors.New("passkey ceremony not found or expired; start a new one")
+	ErrPasskeyInvalid         = errors.New("passkey verification failed")
+	ErrPasskeyCloned          = errors.New("passkey signature counter did not increase; the authenticator may be cloned")
+	ErrPasskeyNotFound        = errors.New("passkey not found")
+)
+
+// WebAuthn ceremony kinds, stored with each session so a registration
+// challenge cannot be answered at the login endpoint and vice versa.
+const (
+	ceremonyRegister = "register"
+	ceremonyLogin    = "login"
+)
+
+// WebAuthnChallenge is returned when a ceremony begins. Options is passed to
+// navigator.credentials.create() or .get(); SessionID must be sent back with
+// the authenticator's response.
+type WebAuthnChallenge struct {
+	SessionID uuid.UUID   `json:"session_id"`
+	Options   interface{} `json:"options"`
+}
+
+// WebAuthnService handles passkey registration and passwordless login.
+//
+// Passkeys are registered as discoverable credentials with user
+// verification, so a successful assertion proves both possession and a local
+// PIN or biometric check; it signs the user in without a password or TOTP.
+type WebAuthnService struct {
+	webauthn    *webauthn.WebAuthn
+	credRepo    *repository.WebAuthnCredentialRepository
+	sessionRepo *repository.WebAuthnSessionRepository
+	userRepo    *repository.UserRepository
+	authService *AuthService
+	cfg         *config.Config
+}
+
+// NewWebAuthnService creates a new WebAuthnService for the relying party
+// configured in cfg.
+func NewWebAuthnService(
+	credRepo *repository.WebAuthnCredentialRepository,
+	sessionRepo *repository.WebAuthnSessionRepository,
+	userRepo *repository.UserRepository,
+	authService *AuthService,
+	cfg *config.Config,
+) (*WebAuthnService, error) {
+	timeout := webauthn.TimeoutConfig{
+		Enforce:    true,
+		Timeout:    cfg.WebAuthnSessionExpiry,
+		TimeoutUVD: cfg.WebAuthnSessionExpiry,
+	}
+	wa, err := webauthn.New(&webauthn.Config{
+		RPID:          cfg.WebAuthnRPID,
+		RPDisplayName: cfg.WebAuthnRPName,
+		RPOrigins:     cfg.WebAuthnRPOrigins,
+		AuthenticatorSelection: protocol.AuthenticatorSelection{
+			RequireResidentKey: protocol.ResidentKeyRequired(),
+			ResidentKey:        protocol.ResidentKeyRequirementRequired,
+			UserVerification:   protocol.VerificationRequired,
+		},
+		Timeouts: webauthn.TimeoutsConfig{Login: timeout, Registration: timeout},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &WebAuthnService{
+		webauthn:    wa,
+		credRepo:    credRepo,
+		sessionRepo: sessionRepo,
+		userRepo:    userRepo,
+		authService: authService,
+		cfg:         cfg,
+	}, nil
+}
+
+// BeginRegistration starts registering a new passkey for a signed-in user.
+// Passkeys the user already has are excluded so an authenticator is not
+// registered twice.
+func (s *WebAuthnService) BeginRegistration(userID uuid.UUID) (*WebAuthnChallenge, error) {
+	user, err := s.loadUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var exclusions []protocol.CredentialDescriptor
+	for _, cred := range user.WebAuthnCredentials() {
+		exclusions = append(exclusions, cred.Descriptor())
+	}
+
+	options, session, err := s.webauthn.BeginRegistration(user, webauthn.WithExclusions(exclusions))
+	if err != nil {
+		return nil, err
+	}
+	return s.saveSession(ceremonyRegister, &userID, options, session)
+}
+
+// FinishRegistration verifies the authenticator's attestation response for a
+// registration started by the same user and stores the new passkey.
+func (s *WebAuthnService) FinishRegistration(userID, sessionID uuid.UUID, name string, response []byte) (*models.WebAuthnCredential, error) {
+	session, err := s.takeSession(sessionID, ceremonyRegister)
+	if err != nil {
+		return nil, err
+	}
+	if session.UserID == nil || *session.UserID != userID {
+		return nil, ErrWebAuthnSessionInvalid
+	}
+
+	user, err := s.loadUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(response)
+	if err != nil {
+		return nil, ErrPasskeyInvalid
+	}
+	credential, err := s.webauthn.CreateCredential(user, session.data, parsed)
+	if err != nil {
+		return nil, ErrPasskeyInvalid
+	}
+
+	transports := make([]string, len(credential.Transport))
+	for i, t := range credential.Transport {
+		transports[i] = string(t)
+	}
+
+	cred := &models.WebAuthnCredential{
+		UserID:          userID,
+		Name:            strings.TrimSpace(name),
+		CredentialID:    credential.ID,
+		PublicKey:       credential.PublicKey,
+		AttestationType: credential.AttestationType,
+		Transports:      strings.Join(transports, " "),
+		AAGUID:          credential.Authenticator.AAGUID,
+		SignCount:       int64(credential.Authenticator.SignCount),
+		BackupEligible:  credential.Flags.BackupEligible,
+		BackupState:     credential.Flags.BackupState,
+	}
+	if err := s.credRepo.Create(cred); err != nil {
+		return nil, err
+	}
+	return cred, nil
+}
+
+// BeginLogin starts a passwordless login. The user is not known yet: the
+// authenticator offers the passkeys it holds for this relying party.
+func (s *WebAuthnService) BeginLogin() (*WebAuthnChallenge, error) {
+	options, session, err := s.webauthn.BeginDiscoverableLogin(
+		webauthn.WithUserVerification(protocol.VerificationRequired),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return s.saveSession(ceremonyLogin, nil, options, session)
+}
+
+// FinishLogin verifies the authenticator's assertion and returns the same
+// token pair as a password login. An assertion whose signature counter did
+// not increase is rejected as a possible cloned authenticator.
+func (s *WebAuthnService) FinishLogin(sessionID uuid.UUID, response []byte) (*TokenPair, error) {
+	session, err := s.takeSession(sessionID, ceremonyLogin)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(response)
+	if err != nil {
+		return nil, ErrPasskeyInvalid
+	}
+	// The library reports every failure of the user lookup as an invalid
+	// assertion; keep database failures apart
+	var lookupErr error
+	discover := func(rawID, userHandle []byte) (webauthn.User, error) {
+		user, err := s.discoverUser(rawID, userHandle)
+		lookupErr = err
+		return user, err
+	}
+	found, credential, err := s.webauthn.ValidatePasskeyLogin(discover, session.data, parsed)
+	if err != nil {
+		if lookupErr != nil && lookupErr != ErrUserNotFound {
+			return nil, lookupErr
+		}
+		return nil, ErrPasskeyInvalid
+	}
+	if credential.Authenticator.CloneWarning {
+		return nil, ErrPasskeyCloned
+	}
+
+	user := found.(*webauthnUser)
+	stored := user.credential(credential.ID)
+	if stored == nil {
+		return nil, ErrPasskeyInvalid
+	}
+
+	err = s.credRepo.RecordUse(stored.ID, int64(credential.Authenticator.SignCount), credential.Flags.BackupState)
+	if err != nil {
+		if errors.Is(err, repository.ErrSignCountRegressed) {
+			return nil, ErrPasskeyCloned
+		}
+		return nil, err
+	}
+
+	return s.authService.IssueTokenPair(user.user)
+}
+
+// ListCredentials returns the passkeys registered by a user.
+func (s *WebAuthnService) ListCredentials(userID uuid.UUID) ([]models.WebAuthnCredential, error) {
+	return s.credRepo.FindByUserID(userID)
+}
+
+// DeleteCredential removes one of a user's passkeys.
+func (s *WebAuthnService) DeleteCredential(userID, credentialID uuid.UUID) error {
+	if err := s.credRepo.Delete(userID, credentialID); err != nil {
+		return notFound(err, ErrPasskeyNotFound)
+	}
+	return nil
+}
+
+// CleanExpiredSessions removes abandoned ceremony sessions (call periodically).
+func (s *WebAuthnService) CleanExpiredSessions() error {
+	return s.sessionRepo.CleanExpired()
+}
+
+// webauthnSession is a stored ceremony session with its decoded challenge.
+type webauthnSession struct {
+	*models.WebAuthnSession
+	data webauthn.SessionData
+}
+
+// saveSession stores the challenge of a ceremony that just began.
+func (s *WebAuthnService) saveSession(ceremony string, userID *uuid.UUID, options interface{}, data *webauthn.SessionData) (*WebAuthnChallenge, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	session := &models.WebAuthnSession{
+		ID:        uuid.New(),
+		Ceremony:  ceremony,
+		UserID:    userID,
+		Data:      string(raw),
+		ExpiresAt: time.Now().Add(s.cfg.WebAuthnSessionExpiry),
+	}
+	if err := s.sessionRepo.Create(session); err != nil {
+		return nil, err
+	}
+
+	return &WebAuthnChallenge{SessionID: session.ID, Options: options}, nil
+}
+
+// takeSession consumes a ceremony session so its challenge cannot be reused.
+func (s *WebAuthnService) takeSession(id uuid.UUID, ceremony string) (*webauthnSession, error) {
+	session, err := s.sessionRepo.Take(id, ceremony)
+	if err != nil {
+		return nil, notFound(err, ErrWebAuthnSessionInvalid)
+	}
+
+	var data webauthn.SessionData
+	if err := json.Unmarshal([]byte(session.Data), &data); err != nil {
+		return nil, ErrWebAuthnSessionInvalid
+	}
+	return &webauthnSession{WebAuthnSession: session, data: data}, nil
+}
+
+// discoverUser resolves the user handle returned by a discoverable login.
+func (s *WebAuthnService) discoverUser(_, userHandle []byte) (webauthn.User, error) {
+	userID, err := uuid.FromBytes(userHandle)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+	return s.loadUser(userID)
+}
+
+// loadUser loads a user together with their passkeys. The ID comes from the
+// user's own token or passkey, which already pins the tenant.
+func (s *WebAuthnService) loadUser(userID uuid.UUID) (*webauthnUser, error) {
+	user, err := s.userRepo.FindByID(nil, userID)
+	if err != nil {
+		return nil, notFound(err, ErrUserNotFound)
+	}
+	creds, err := s.credRepo.FindByUserID(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &webauthnUser{user: user, creds: creds}, nil
+}
+
+// webauthnUser adapts a user and their passkeys to webauthn.User. The user
+// handle is the 16-byte user ID.
+type webauthnUser struct {
+	user  *models.User
+	creds []models.WebAuthnCredential
+}
+
+func (u *webauthnUser) WebAuthnID() []byte          { return u.user.ID[:] }
+func (u *webauthnUser) WebAuthnName() string        { return u.user.Email }
+func (u *webauthnUser) WebAuthnDisplayName() string { return u.user.Email }
+
+func (u *webauthnUser) WebAuthnCredentials() []webauthn.Credential {
+	creds := make([]webauthn.Credential, len(u.creds))
+	for i, c := range u.creds {
+		var transports []protocol.AuthenticatorTransport
+		for _, t := range strings.Fields(c.Transports) {
+			transports = append(transports, protocol.AuthenticatorTransport(t))
+		}
+		creds[i] = webauthn.Credential{
+			ID:              c.CredentialID,
+			PublicKey:       c.PublicKey,
+			AttestationType: c.AttestationType,
+			Transport:       transports,
+			Flags: webauthn.CredentialFlags{
+				BackupEligible: c.BackupEligible,
+				BackupState:    c.BackupState,
+			},
+			Authenticator: webauthn.Authenticator{
+				AAGUID:    c.AAGUID,
+				SignCount: uint32(c.SignCount),
+			},
+		}
+	}
+	return creds
+}
+
+// credential returns the stored passkey with the given credential ID.
+func (u *webauthnUser) credential(id []byte) *models.WebAuthnCredential {
+	for i := range u.creds {
+		if bytes.Equal(u.creds[i].CredentialID, id) {
+			return &u.creds[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,393 @@
+package service
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/cachatto/master-slave-server/internal/config"
+	"github.com/cachatto/master-slave-server/internal/limiter"
+	"github.com/cachatto/master-slave-server/internal/models"
+	"github.com/cachatto/master-slave-server/internal/pwhash"
+	"github.com/cachatto/master-slave-server/internal/repository"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const (
+	testRPID   = "example.com"
+	testOrigin = "https://example.com"
+)
+
+// softAuthenticator is a software WebAuthn authenticator holding a single
+// discoverable P-256 credential. It answers ceremonies the way a platform
+// authenticator does after a successful user verification.
+type softAuthenticator struct {
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	userHandle   []byte
+	signCount    uint32
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	credentialID := make([]byte, 32)
+	if _, err := rand.Read(credentialID); err != nil {
+		t.Fatalf("generate credential id: %v", err)
+	}
+	return &softAuthenticator{key: key, credentialID: credentialID}
+}
+
+// register answers the options of navigator.credentials.create() with a
+// "none" attestation of a new credential.
+func (a *softAuthenticator) register(t *testing.T, options *protocol.CredentialCreation) []byte {
+	t.Helper()
+	a.userHandle = options.Response.User.ID.(protocol.URLEncodedBase64)
+
+	publicKey, err := webauthncbor.Marshal(webauthncose.EC2PublicKeyData{
+		PublicKeyData: webauthncose.PublicKeyData{
+			KeyType:   int64(webauthncose.EllipticKey),
+			Algorithm: int64(webauthncose.AlgES256),
+		},
+		Curve:  int64(webauthncose.P256),
+		XCoord: a.key.X.FillBytes(make([]byte, 32)),
+		YCoord: a.key.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		t.Fatalf("encode public key: %v", err)
+	}
+
+	authData := a.authenticatorData(0x40) // AT: attested credential data included
+	authData = append(authData, make([]byte, 16)...)
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(a.credentialID)))
+	authData = append(authData, a.credentialID...)
+	authData = append(authData, publicKey...)
+
+	attestation, err := webauthncbor.Marshal(struct {
+		Format   string         `cbor:"fmt"`
+		AttStmt  map[string]any `cbor:"attStmt"`
+		AuthData []byte         `cbor:"authData"`
+	}{"none", map[string]any{}, authData})
+	if err != nil {
+		t.Fatalf("encode attestation: %v", err)
+	}
+
+	return a.credential(t, map[string]any{
+		"clientDataJSON":    a.clientData(t, "webauthn.create", options.Response.Challenge),
+		"attestationObject": b64(attestation),
+		"transports":        []string{"internal"},
+	})
+}
+
+// login answers the options of navigator.credentials.get() with an
+// assertion signed at the authenticator's current signature counter.
+func (a *softAuthenticator) login(t *testing.T, options *protocol.CredentialAssertion) []byte {
+	t.Helper()
+	clientData := a.clientData(t, "webauthn.get", options.Response.Challenge)
+	authData := a.authenticatorData(0)
+
+	rawClientData, _ := base64.RawURLEncoding.DecodeString(clientData)
+	clientDataHash := sha256.Sum256(rawClientData)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		t.Fatalf("sign assertion: %v", err)
+	}
+
+	return a.credential(t, map[string]any{
+		"clientDataJSON":    clientData,
+		"authenticatorData": b64(authData),
+		"signature":         b64(signature),
+		"userHandle":        b64(a.userHandle),
+	})
+}
+
+// authenticatorData returns the RP ID hash, the UP and UV flags plus extra,
+// and the signature counter.
+func (a *softAuthenticator) authenticatorData(extraFlags byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(testRPID))
+	data := append([]byte{}, rpIDHash[:]...)
+	data = append(data, 0x01|0x04|extraFlags)
+	return binary.BigEndian.AppendUint32(data, a.signCount)
+}
+
+func (a *softAuthenticator) clientData(t *testing.T, ceremony string, challenge protocol.URLEncodedBase64) string {
+	t.Helper()
+	raw, err := json.Marshal(map[string]string{
+		"type":      ceremony,
+		"challenge": challenge.String(),
+		"origin":    testOrigin,
+	})
+	if err != nil {
+		t.Fatalf("encode client data: %v", err)
+	}
+	return b64(raw)
+}
+
+func (a *softAuthenticator) credential(t *testing.T, response map[string]any) []byte {
+	t.Helper()
+	raw, err := json.Marshal(map[string]any{
+		"id":       b64(a.credentialID),
+		"rawId":    b64(a.credentialID),
+		"type":     "public-key",
+		"response": response,
+	})
+	if err != nil {
+		t.Fatalf("encode credential: %v", err)
+	}
+	return raw
+}
+
+func b64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// testWebAuthnConfig is the relying party the software authenticator answers.
+func testWebAuthnConfig() *config.Config {
+	return &config.Config{
+		JWTSecret:                  "test-secret",
+		JWTAccessExpiry:            time.Minute,
+		JWTRefreshExpiry:           time.Hour,
+		LoginMaxFailuresPerAccount: 5,
+		LoginLockoutBase:           time.Minute,
+		LoginLockoutMax:            time.Hour,
+		LoginFailureWindow:         time.Hour,
+		WebAuthnRPID:               testRPID,
+		WebAuthnRPName:             "Test",
+		WebAuthnRPOrigins:          []string{testOrigin},
+		WebAuthnSessionExpiry:      time.Minute,
+	}
+}
+
+// staticWebAuthnUser is a webauthn.User without a database.
+type staticWebAuthnUser struct {
+	id    []byte
+	creds []webauthn.Credential
+}
+
+func (u *staticWebAuthnUser) WebAuthnID() []byte                         { return u.id }
+func (u *staticWebAuthnUser) WebAuthnName() string                       { return "user@example.com" }
+func (u *staticWebAuthnUser) WebAuthnDisplayName() string                { return "user@example.com" }
+func (u *staticWebAuthnUser) WebAuthnCredentials() []webauthn.Credential { return u.creds }
+
+// TestSoftAuthenticator checks the software authenticator against the
+// WebAuthn library alone, so it runs without a database.
+func TestSoftAuthenticator(t *testing.T) {
+	cfg := testWebAuthnConfig()
+	wa, err := webauthn.New(&webauthn.Config{
+		RPID:          cfg.WebAuthnRPID,
+		RPDisplayName: cfg.WebAuthnRPName,
+		RPOrigins:     cfg.WebAuthnRPOrigins,
+		AuthenticatorSelection: protocol.AuthenticatorSelection{
+			UserVerification: protocol.VerificationRequired,
+		},
+	})
+	if err != nil {
+		t.Fatalf("webauthn.New: %v", err)
+	}
+	id := uuid.New()
+	user := &staticWebAuthnUser{id: id[:]}
+	auth := newSoftAuthenticator(t)
+
+	creation, session, err := wa.BeginRegistration(user)
+	if err != nil {
+		t.Fatalf("BeginRegistration: %v", err)
+	}
+	parsedCreation, err := protocol.ParseCredentialCreationResponseBytes(auth.register(t, creation))
+	if err != nil {
+		t.Fatalf("parse attestation: %v", err)
+	}
+	credential, err := wa.CreateCredential(user, *session, parsedCreation)
+	if err != nil {
+		t.Fatalf("CreateCredential: %v", err)
+	}
+	user.creds = append(user.creds, *credential)
+
+	auth.signCount = 1
+	assertion, session, err := wa.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationRequired))
+	if err != nil {
+		t.Fatalf("BeginDiscoverableLogin: %v", err)
+	}
+	parsedAssertion, err := protocol.ParseCredentialRequestResponseBytes(auth.login(t, assertion))
+	if err != nil {
+		t.Fatalf("parse assertion: %v", err)
+	}
+	discover := func(_, userHandle []byte) (webauthn.User, error) {
+		if !bytes.Equal(userHandle, user.id) {
+			return nil, errors.New("unknown user handle")
+		}
+		return user, nil
+	}
+	_, validated, err := wa.ValidatePasskeyLogin(discover, *session, parsedAssertion)
+	if err != nil {
+		t.Fatalf("ValidatePasskeyLogin: %v", err)
+	}
+	if validated.Authenticator.SignCount != 1 || validated.Authenticator.CloneWarning {
+		t.Errorf("sign count = %d, clone warning = %v, want 1 and false",
+			validated.Authenticator.SignCount, validated.Authenticator.CloneWarning)
+	}
+}
+
+// openTestDB connects to the Postgres database in TEST_DATABASE_URL and
+// migrates the given models. The test is skipped when the variable is unset.
+func openTestDB(t *testing.T, tables ...interface{}) *gorm.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("connect to test database: %v", err)
+	}
+	if err := db.AutoMigrate(tables...); err != nil {
+		t.Fatalf("migrate test database: %v", err)
+	}
+	return db
+}
+
+// newTestWebAuthnService wires a WebAuthnService to the test database and
+// creates a verified user, removed again when the test ends.
+func newTestWebAuthnService(t *testing.T) (*WebAuthnService, *repository.WebAuthnCredentialRepository, *models.User) {
+	t.Helper()
+	db := openTestDB(t, &models.Tenant{}, &models.User{}, &models.App{}, &models.RefreshToken{},
+		&models.WebAuthnCredential{}, &models.WebAuthnSession{})
+	cfg := testWebAuthnConfig()
+
+	suffix := uuid.NewString()
+	tenant := &models.Tenant{Name: "WebAuthn test", Slug: "webauthn-test-" + suffix[:8]}
+	if err := db.Create(tenant).Error; err != nil {
+		t.Fatalf("create tenant: %v", err)
+	}
+	now := time.Now()
+	user := &models.User{TenantID: tenant.ID, Email: suffix + "@example.com", PasswordHash: pwhash.Unusable, EmailVerifiedAt: &now}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Where("user_id = ?", user.ID).Delete(&models.RefreshToken{})
+		db.Where("user_id = ?", user.ID).Delete(&models.WebAuthnCredential{})
+		db.Unscoped().Delete(user)
+		db.Delete(tenant)
+	})
+
+	keys, err := NewKeySet(cfg)
+	if err != nil {
+		t.Fatalf("NewKeySet: %v", err)
+	}
+	userRepo := repository.NewUserRepository(db)
+	credRepo := repository.NewWebAuthnCredentialRepository(db)
+	authService := NewAuthService(
+		userRepo,
+		repository.NewAppRepository(db),
+		repository.NewRefreshTokenRepository(db),
+		NewTenantService(repository.NewTenantRepository(db), cfg),
+		keys,
+		pwhash.NewHasher(&pwhash.Bcrypt{Cost: 4}),
+		NewMFAService(userRepo, repository.NewRecoveryCodeRepository(db), cfg),
+		limiter.NewMemoryLimiter(limiter.Policy{MaxFailures: 100, BaseLockout: time.Second, MaxLockout: time.Second, Window: time.Minute}),
+		limiter.NewMemoryLimiter(limiter.Policy{MaxFailures: 100, BaseLockout: time.Second, MaxLockout: time.Second, Window: time.Minute}),
+		cfg,
+	)
+	service, err := NewWebAuthnService(credRepo, repository.NewWebAuthnSessionRepository(db), userRepo, authService, cfg)
+	if err != nil {
+		t.Fatalf("NewWebAuthnService: %v", err)
+	}
+	return service, credRepo, user
+}
+
+func TestWebAuthnRegisterAndLogin(t *testing.T) {
+	service, credRepo, user := newTestWebAuthnService(t)
+	auth := newSoftAuthenticator(t)
+
+	// Register a passkey; the registration session can be finished only once
+	registration, err := service.BeginRegistration(user.ID)
+	if err != nil {
+		t.Fatalf("BeginRegistration: %v", err)
+	}
+	response := auth.register(t, registration.Options.(*protocol.CredentialCreation))
+	cred, err := service.FinishRegistration(user.ID, registration.SessionID, "Laptop", response)
+	if err != nil {
+		t.Fatalf("FinishRegistration: %v", err)
+	}
+	if !bytes.Equal(cred.CredentialID, auth.credentialID) || cred.Name != "Laptop" {
+		t.Errorf("stored credential %x %q, want %x %q", cred.CredentialID, cred.Name, auth.credentialID, "Laptop")
+	}
+	if _, err := service.FinishRegistration(user.ID, registration.SessionID, "Laptop", response); !errors.Is(err, ErrWebAuthnSessionInvalid) {
+		t.Errorf("finishing a registration twice = %v, want ErrWebAuthnSessionInvalid", err)
+	}
+
+	// Sign in with it; replaying the assertion fails because the session is gone
+	auth.signCount = 1
+	login, err := service.BeginLogin()
+	if err != nil {
+		t.Fatalf("BeginLogin: %v", err)
+	}
+	assertion := auth.login(t, login.Options.(*protocol.CredentialAssertion))
+	tokens, err := service.FinishLogin(login.SessionID, assertion)
+	if err != nil {
+		t.Fatalf("FinishLogin: %v", err)
+	}
+	if tokens.AccessToken == "" || tokens.RefreshToken == "" {
+		t.Errorf("FinishLogin returned an empty token pair: %+v", tokens)
+	}
+	if _, err := service.FinishLogin(login.SessionID, assertion); !errors.Is(err, ErrWebAuthnSessionInvalid) {
+		t.Errorf("replaying a login = %v, want ErrWebAuthnSessionInvalid", err)
+	}
+
+	// A login session cannot be used to finish a registration
+	login, err = service.BeginLogin()
+	if err != nil {
+		t.Fatalf("BeginLogin: %v", err)
+	}
+	if _, err := service.FinishRegistration(user.ID, login.SessionID, "", response); !errors.Is(err, ErrWebAuthnSessionInvalid) {
+		t.Errorf("finishing a registration with a login session = %v, want ErrWebAuthnSessionInvalid", err)
+	}
+
+	// An assertion that does not advance the counter looks like a clone
+	assertion = auth.login(t, login.Options.(*protocol.CredentialAssertion))
+	if _, err := service.FinishLogin(login.SessionID, assertion); !errors.Is(err, ErrPasskeyCloned) {
+		t.Errorf("login with a repeated sign count = %v, want ErrPasskeyCloned", err)
+	}
+
+	// RecordUse refuses to move the stored counter backwards, which catches
+	// two concurrent logins that both passed the library's check
+	if err := credRepo.RecordUse(cred.ID, 1, false); !errors.Is(err, repository.ErrSignCountRegressed) {
+		t.Errorf("RecordUse with the stored count = %v, want ErrSignCountRegressed", err)
+	}
+	if err := credRepo.RecordUse(cred.ID, 0, false); !errors.Is(err, repository.ErrSignCountRegressed) {
+		t.Errorf("RecordUse with a lower count = %v, want ErrSignCountRegressed", err)
+	}
+	if err := credRepo.RecordUse(cred.ID, 2, false); err != nil {
+		t.Errorf("RecordUse with a higher count: %v", err)
+	}
+
+	auth.signCount = 3
+	login, err = service.BeginLogin()
+	if err != nil {
+		t.Fatalf("BeginLogin: %v", err)
+	}
+	if _, err := service.FinishLogin(login.SessionID, auth.login(t, login.Options.(*protocol.CredentialAssertion))); err != nil {
+		t.Errorf("FinishLogin after the counter advanced: %v", err)
+	}
+}
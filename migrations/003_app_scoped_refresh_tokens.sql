@@ -0,0 +1,8 @@
+-- Master-Slave Server: App-scoped refresh tokens
+-- Refresh tokens claimed by a slave app remember the app so that rotated
+-- tokens keep the app's package ID as their audience.
+
+ALTER TABLE refresh_tokens
+    ADD COLUMN IF NOT EXISTS app_id UUID REFERENCES app_registry(id) ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_app_id ON refresh_tokens(app_id);
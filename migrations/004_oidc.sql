@@ -0,0 +1,33 @@
+-- Master-Slave Server: OpenID Connect provider
+-- Every app in the registry is a public OIDC client identified by its
+-- package_id. Redirect URIs are either listed explicitly or use the app's
+-- deep link scheme.
+
+ALTER TABLE app_registry
+    ADD COLUMN IF NOT EXISTS redirect_uris TEXT NOT NULL DEFAULT '';
+
+-- ============================================================
+-- OAUTH AUTHORIZATION CODES
+-- ============================================================
+CREATE TABLE IF NOT EXISTS oauth_authorization_codes (
+    id             UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    code           VARCHAR(64)  NOT NULL UNIQUE,
+    user_id        UUID         NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    app_id         UUID         NOT NULL REFERENCES app_registry(id) ON DELETE CASCADE,
+    redirect_uri   TEXT         NOT NULL,
+    scope          VARCHAR(255) NOT NULL,
+    nonce          VARCHAR(255),
+    code_challenge VARCHAR(128) NOT NULL,
+    auth_time      TIMESTAMPTZ  NOT NULL,
+    expires_at     TIMESTAMPTZ  NOT NULL,
+    claimed        BOOLEAN      NOT NULL DEFAULT FALSE
+);
+
+CREATE INDEX IF NOT EXISTS idx_oauth_authorization_codes_user_id    ON oauth_authorization_codes(user_id);
+CREATE INDEX IF NOT EXISTS idx_oauth_authorization_codes_expires_at ON oauth_authorization_codes(expires_at);
+
+-- Redirect URIs for the sample slave apps
+UPDATE app_registry SET redirect_uris = 'slaveapp1://oauth2redirect'
+    WHERE package_id = 'com.cachatto.slave1' AND redirect_uris = '';
+UPDATE app_registry SET redirect_uris = 'slaveapp2://oauth2redirect'
+    WHERE package_id = 'com.cachatto.slave2' AND redirect_uris = '';
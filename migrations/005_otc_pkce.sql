@@ -0,0 +1,10 @@
+-- Master-Slave Server: PKCE binding for the OTC handshake
+-- The slave app passes an S256 code_challenge through the deep link; the
+-- Master app forwards it to /auth/exchange-code and the slave app proves
+-- possession with the code_verifier at /auth/claim-token.
+
+ALTER TABLE one_time_codes
+    ADD COLUMN IF NOT EXISTS code_challenge VARCHAR(128) NOT NULL DEFAULT '';
+
+ALTER TABLE app_registry
+    ADD COLUMN IF NOT EXISTS require_pkce BOOLEAN NOT NULL DEFAULT FALSE;
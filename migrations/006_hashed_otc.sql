@@ -0,0 +1,12 @@
+-- Master-Slave Server: Hashed one-time codes
+-- Codes are stored as HMAC-SHA256(OTC_PEPPER, code) so a database read
+-- (replica, backup) does not expose live codes. Outstanding codes live for
+-- seconds, so they are simply discarded.
+
+DELETE FROM one_time_codes;
+
+-- The column keeps its UNIQUE constraint (and index) across the rename
+DROP INDEX IF EXISTS idx_one_time_codes_code;
+
+ALTER TABLE one_time_codes RENAME COLUMN code TO code_hash;
+ALTER TABLE one_time_codes ALTER COLUMN code_hash TYPE VARCHAR(64);
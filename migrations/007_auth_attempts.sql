@@ -0,0 +1,15 @@
+-- Master-Slave Server: Failed-attempt counters
+-- Used by the Postgres-backed limiter (LIMITER_BACKEND=postgres) so that
+-- brute-force lockouts are shared by every server instance.
+
+-- ============================================================
+-- AUTH ATTEMPTS
+-- ============================================================
+CREATE TABLE IF NOT EXISTS auth_attempts (
+    key             VARCHAR(255) PRIMARY KEY,
+    failures        INTEGER      NOT NULL DEFAULT 0,
+    last_failure_at TIMESTAMPTZ  NOT NULL,
+    locked_until    TIMESTAMPTZ  NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_auth_attempts_locked_until ON auth_attempts(locked_until);
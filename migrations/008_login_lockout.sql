@@ -0,0 +1,9 @@
+-- Master-Slave Server: Login throttling and account lockout
+-- Failed password attempts are counted on the user record; once the
+-- configured threshold is exceeded the account is locked with a doubling
+-- lockout until an admin unlocks it or the lockout expires.
+
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS failed_login_count   INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS last_failed_login_at TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS locked_until         TIMESTAMPTZ;
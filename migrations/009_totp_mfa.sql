@@ -0,0 +1,22 @@
+-- Master-Slave Server: TOTP two-factor authentication
+-- A user enrolls by scanning the provisioning URI and confirming a code;
+-- totp_enabled_at is only set once confirmed. Recovery codes are stored as
+-- HMAC-SHA256 hashes and can each be used once.
+
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS totp_secret     VARCHAR(64) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS totp_enabled_at TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS totp_last_step  BIGINT      NOT NULL DEFAULT 0;
+
+-- ============================================================
+-- MFA RECOVERY CODES
+-- ============================================================
+CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+    id         UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id    UUID        NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash  VARCHAR(64) NOT NULL,
+    used_at    TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_mfa_recovery_codes_user_id ON mfa_recovery_codes(user_id);
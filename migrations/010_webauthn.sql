@@ -0,0 +1,40 @@
+-- Master-Slave Server: WebAuthn / passkey login
+-- Passkeys are registered by signed-in users and can then be used to sign in
+-- without a password. The signature counter of each credential is stored to
+-- detect cloned authenticators. Ceremony challenges are kept in the database
+-- between the begin and finish requests so any instance can finish them.
+
+-- ============================================================
+-- WEBAUTHN CREDENTIALS
+-- ============================================================
+CREATE TABLE IF NOT EXISTS webauthn_credentials (
+    id               UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id          UUID         NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name             VARCHAR(255) NOT NULL DEFAULT '',
+    credential_id    BYTEA        NOT NULL UNIQUE,
+    public_key       BYTEA        NOT NULL,
+    attestation_type VARCHAR(32)  NOT NULL DEFAULT '',
+    transports       VARCHAR(255) NOT NULL DEFAULT '',
+    aaguid           BYTEA,
+    sign_count       BIGINT       NOT NULL DEFAULT 0,
+    backup_eligible  BOOLEAN      NOT NULL DEFAULT FALSE,
+    backup_state     BOOLEAN      NOT NULL DEFAULT FALSE,
+    last_used_at     TIMESTAMPTZ,
+    created_at       TIMESTAMPTZ  NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_webauthn_credentials_user_id ON webauthn_credentials(user_id);
+
+-- ============================================================
+-- WEBAUTHN CEREMONY SESSIONS
+-- ============================================================
+CREATE TABLE IF NOT EXISTS webauthn_sessions (
+    id         UUID PRIMARY KEY,
+    ceremony   VARCHAR(16) NOT NULL,
+    user_id    UUID        REFERENCES users(id) ON DELETE CASCADE,
+    data       TEXT        NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_webauthn_sessions_user_id ON webauthn_sessions(user_id);
+CREATE INDEX IF NOT EXISTS idx_webauthn_sessions_expires_at ON webauthn_sessions(expires_at);
@@ -0,0 +1,9 @@
+-- Master-Slave Server: Self-service registration with email verification
+-- Users who sign up must confirm their email before they can log in.
+-- Accounts created before self-service registration existed are treated
+-- as verified.
+
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS email_verified_at TIMESTAMPTZ;
+
+UPDATE users SET email_verified_at = created_at WHERE email_verified_at IS NULL;
@@ -0,0 +1,7 @@
+-- Master-Slave Server: Admin user management
+-- Admins can disable an account, which blocks password and passkey logins
+-- and every token issuance (refresh, OTC claims, OIDC) until it is enabled
+-- again. Deleting a user is a soft delete via the existing deleted_at column.
+
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS disabled_at TIMESTAMPTZ;
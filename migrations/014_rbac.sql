@@ -0,0 +1,13 @@
+-- Master-Slave Server: Role-based access control
+-- Every user has one role: superadmin (manages everything), app-admin
+-- (manages the slave apps they own and who may use them) or user.
+-- Users listed in ADMIN_EMAILS are promoted to superadmin at startup.
+
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS role VARCHAR(32) NOT NULL DEFAULT 'user';
+
+ALTER TABLE app_registry
+    ADD COLUMN IF NOT EXISTS owner_id UUID REFERENCES users(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_app_registry_owner_id ON app_registry(owner_id);
+
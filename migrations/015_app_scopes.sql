@@ -0,0 +1,21 @@
+-- Master-Slave Server: Per-app scopes
+-- Each slave app declares the scopes it understands (e.g. "read write
+-- admin"); a permission grants a user a subset of them. Tokens claimed by
+-- the app carry the granted scopes in their "scope" claim. All scope lists
+-- are space-separated.
+
+ALTER TABLE app_registry
+    ADD COLUMN IF NOT EXISTS scopes TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE user_app_permissions
+    ADD COLUMN IF NOT EXISTS scopes TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE one_time_codes
+    ADD COLUMN IF NOT EXISTS scopes TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE refresh_tokens
+    ADD COLUMN IF NOT EXISTS scope TEXT NOT NULL DEFAULT '';
+
+-- Authorization codes now also record granted app scopes
+ALTER TABLE oauth_authorization_codes
+    ALTER COLUMN scope TYPE TEXT;
@@ -0,0 +1,33 @@
+-- Master-Slave Server: Groups
+-- A group is a named set of users. Apps granted to a group can be used by
+-- every member with the group's scopes; a user's effective permission for
+-- an app combines their direct grant and the grants of all their groups,
+-- with the union of the scopes.
+
+CREATE TABLE IF NOT EXISTS user_groups (
+    id          UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name        VARCHAR(255) NOT NULL UNIQUE,
+    description TEXT         NOT NULL DEFAULT '',
+    created_at  TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    updated_at  TIMESTAMPTZ  NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS group_members (
+    id         UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    group_id   UUID        NOT NULL REFERENCES user_groups(id) ON DELETE CASCADE,
+    user_id    UUID        NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE(group_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_group_members_user_id ON group_members(user_id);
+
+CREATE TABLE IF NOT EXISTS group_app_permissions (
+    id       UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    group_id UUID NOT NULL REFERENCES user_groups(id) ON DELETE CASCADE,
+    app_id   UUID NOT NULL REFERENCES app_registry(id) ON DELETE CASCADE,
+    scopes   TEXT NOT NULL DEFAULT '',
+    UNIQUE(group_id, app_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_group_app_permissions_app_id ON group_app_permissions(app_id);
@@ -0,0 +1,62 @@
+-- Master-Slave Server: Multi-tenant organizations
+-- Users, slave apps and groups belong to a tenant. Emails and group names
+-- are unique within a tenant; package IDs stay unique across tenants
+-- because slave apps claim codes by package ID alone. Existing rows move to
+-- the "default" tenant (DEFAULT_TENANT).
+
+CREATE TABLE IF NOT EXISTS tenants (
+    id         UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name       VARCHAR(255) NOT NULL,
+    slug       VARCHAR(63)  NOT NULL UNIQUE,
+    created_at TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ  NOT NULL DEFAULT NOW()
+);
+
+INSERT INTO tenants (name, slug) VALUES ('Default', 'default')
+    ON CONFLICT (slug) DO NOTHING;
+
+-- ============================================================
+-- USERS
+-- ============================================================
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS tenant_id UUID REFERENCES tenants(id);
+
+UPDATE users SET tenant_id = (SELECT id FROM tenants WHERE slug = 'default')
+    WHERE tenant_id IS NULL;
+
+ALTER TABLE users
+    ALTER COLUMN tenant_id SET NOT NULL;
+
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_email_key;
+DROP INDEX IF EXISTS idx_users_email;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_tenant_email ON users(tenant_id, email);
+
+-- ============================================================
+-- APP REGISTRY
+-- ============================================================
+ALTER TABLE app_registry
+    ADD COLUMN IF NOT EXISTS tenant_id UUID REFERENCES tenants(id);
+
+UPDATE app_registry SET tenant_id = (SELECT id FROM tenants WHERE slug = 'default')
+    WHERE tenant_id IS NULL;
+
+ALTER TABLE app_registry
+    ALTER COLUMN tenant_id SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_app_registry_tenant_id ON app_registry(tenant_id);
+
+-- ============================================================
+-- GROUPS
+-- ============================================================
+ALTER TABLE user_groups
+    ADD COLUMN IF NOT EXISTS tenant_id UUID REFERENCES tenants(id);
+
+UPDATE user_groups SET tenant_id = (SELECT id FROM tenants WHERE slug = 'default')
+    WHERE tenant_id IS NULL;
+
+ALTER TABLE user_groups
+    ALTER COLUMN tenant_id SET NOT NULL;
+
+ALTER TABLE user_groups DROP CONSTRAINT IF EXISTS user_groups_name_key;
+DROP INDEX IF EXISTS idx_user_groups_name;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_user_groups_tenant_name ON user_groups(tenant_id, name);
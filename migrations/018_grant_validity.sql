@@ -0,0 +1,12 @@
+-- Master-Slave Server: Time-bounded app permissions
+-- A direct grant can be limited to a window: it only permits the app from
+-- valid_from (inclusive) until valid_until (exclusive). NULL leaves that
+-- side unbounded. expired_at is set by the expiry job once it has revoked
+-- the codes and sessions of an expired grant; granting again clears it.
+
+ALTER TABLE user_app_permissions
+    ADD COLUMN IF NOT EXISTS valid_from  TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS valid_until TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS expired_at  TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_user_app_permissions_valid_until ON user_app_permissions(valid_until);
@@ -0,0 +1,25 @@
+-- Master-Slave Server: Access requests
+-- A user without permission for a slave app can ask for it. Admins who may
+-- manage the app approve or deny the request; approving grants the app to
+-- the user. A user has at most one pending request per app, and decided
+-- requests are kept as the app's access history.
+
+CREATE TABLE IF NOT EXISTS access_requests (
+    id         UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id    UUID        NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    app_id     UUID        NOT NULL REFERENCES app_registry(id) ON DELETE CASCADE,
+    scopes     TEXT        NOT NULL DEFAULT '',
+    reason     TEXT        NOT NULL DEFAULT '',
+    status     VARCHAR(20) NOT NULL DEFAULT 'pending',
+    decided_by UUID        REFERENCES users(id) ON DELETE SET NULL,
+    decided_at TIMESTAMPTZ,
+    note       TEXT        NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_access_requests_user_id ON access_requests(user_id);
+CREATE INDEX IF NOT EXISTS idx_access_requests_app_id ON access_requests(app_id);
+CREATE INDEX IF NOT EXISTS idx_access_requests_status ON access_requests(status);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_access_requests_pending
+    ON access_requests(user_id, app_id) WHERE status = 'pending';
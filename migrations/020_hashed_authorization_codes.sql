@@ -0,0 +1,12 @@
+-- Master-Slave Server: Hashed authorization codes
+-- Like one-time codes, OIDC authorization codes are stored as
+-- HMAC-SHA256(OTC_PEPPER, code) so a database read (replica, backup) does
+-- not expose live codes. Outstanding codes live for minutes, so they are
+-- simply discarded.
+
+DELETE FROM oauth_authorization_codes;
+
+-- The column keeps its UNIQUE constraint (and index) across the rename
+DROP INDEX IF EXISTS idx_oauth_authorization_codes_code;
+
+ALTER TABLE oauth_authorization_codes RENAME COLUMN code TO code_hash;
@@ -0,0 +1,28 @@
+-- Master-Slave Server: Lowercase emails
+-- Emails are trimmed and lowercased at registration, sign-in and lookup, so
+-- rows stored with mixed case could no longer sign in. Existing emails are
+-- normalized the same way. If two accounts of one tenant (deleted ones
+-- included) differ only in case, the migration fails and changes nothing;
+-- merge or rename those accounts by hand, then run it again.
+
+DO $$
+DECLARE
+    collision RECORD;
+BEGIN
+    SELECT tenant_id, lower(btrim(email)) AS email, count(*) AS accounts
+        INTO collision
+        FROM users
+        GROUP BY tenant_id, lower(btrim(email))
+        HAVING count(*) > 1
+        LIMIT 1;
+
+    IF FOUND THEN
+        RAISE EXCEPTION 'cannot lowercase emails: % accounts of tenant % share the email %',
+            collision.accounts, collision.tenant_id, collision.email
+            USING HINT = 'Merge or rename the accounts that differ only in case, then rerun this migration.';
+    END IF;
+END
+$$;
+
+UPDATE users SET email = lower(btrim(email))
+    WHERE email <> lower(btrim(email));
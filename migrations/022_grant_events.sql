@@ -0,0 +1,22 @@
+-- Master-Slave Server: Grant events
+-- The expiry job records an event for each time-bounded grant it expires,
+-- in the same transaction that revokes the grant's codes and sessions, so
+-- an expiry is recorded exactly once and only if it took effect. Events
+-- are history: they do not reference users, apps or permissions, and are
+-- kept when those are deleted.
+
+CREATE TABLE IF NOT EXISTS grant_events (
+    id            UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    event         VARCHAR(20) NOT NULL,
+    permission_id UUID        NOT NULL,
+    user_id       UUID        NOT NULL,
+    app_id        UUID        NOT NULL,
+    scopes        TEXT        NOT NULL DEFAULT '',
+    valid_from    TIMESTAMPTZ,
+    valid_until   TIMESTAMPTZ,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_grant_events_user_id ON grant_events(user_id);
+CREATE INDEX IF NOT EXISTS idx_grant_events_app_id ON grant_events(app_id);
+CREATE INDEX IF NOT EXISTS idx_grant_events_created_at ON grant_events(created_at);
@@ -0,0 +1,22 @@
+-- Master-Slave Server: Keep access requests of deleted apps
+-- Apps are hard-deleted, and deleting one used to delete its access
+-- requests with it, wiping the history of who asked for access and who
+-- decided. Requests now keep the app's package ID and only lose the
+-- reference to the app: app_id becomes NULL when the app is deleted.
+-- Pending requests of a deleted app can no longer be decided.
+
+ALTER TABLE access_requests
+    ADD COLUMN IF NOT EXISTS package_id VARCHAR(255) NOT NULL DEFAULT '';
+
+UPDATE access_requests r SET package_id = a.package_id
+    FROM app_registry a
+    WHERE a.id = r.app_id AND r.package_id = '';
+
+-- The constraint is named by Postgres when created by 019_access_requests.sql
+-- and by GORM when created by auto-migrate
+ALTER TABLE access_requests
+    DROP CONSTRAINT IF EXISTS access_requests_app_id_fkey,
+    DROP CONSTRAINT IF EXISTS fk_access_requests_app,
+    ALTER COLUMN app_id DROP NOT NULL,
+    ADD CONSTRAINT access_requests_app_id_fkey
+        FOREIGN KEY (app_id) REFERENCES app_registry(id) ON DELETE SET NULL;
@@ -0,0 +1,107 @@
+// Package migrations holds the SQL migrations of the database schema and
+// applies the ones a database has not run yet.
+package migrations
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+//go:embed *.sql
+var files embed.FS
+
+// baseline is the migration that databases created before migrations were
+// tracked are known to have run: the schema shipped with 001_init.sql, set
+// up either by the Postgres init scripts or by auto-migrate.
+const baseline = "001_init"
+
+// lockID is the key of the advisory lock that keeps several server
+// instances from migrating the same database at once.
+const lockID = 7305146259
+
+// Apply runs, in file name order, every migration the database has not run
+// yet, each in its own transaction, and records it in schema_migrations.
+// It returns the versions it applied.
+func Apply(db *gorm.DB) ([]string, error) {
+	names, err := fs.Glob(files, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+
+	if err := track(db); err != nil {
+		return nil, fmt.Errorf("track migrations: %w", err)
+	}
+
+	var applied []string
+	for _, name := range names {
+		version := strings.TrimSuffix(name, ".sql")
+		ran, err := apply(db, name, version)
+		if err != nil {
+			return applied, fmt.Errorf("migration %s: %w", version, err)
+		}
+		if ran {
+			applied = append(applied, version)
+		}
+	}
+	return applied, nil
+}
+
+// track creates the schema_migrations table. A database that already has
+// a schema but no table was set up before migrations were tracked and is
+// recorded as having run the baseline.
+func track(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", lockID).Error; err != nil {
+			return err
+		}
+		if tx.Migrator().HasTable("schema_migrations") {
+			return nil
+		}
+		existing := tx.Migrator().HasTable("users")
+		if err := tx.Exec(`CREATE TABLE schema_migrations (
+			version    VARCHAR(255) PRIMARY KEY,
+			applied_at TIMESTAMPTZ  NOT NULL DEFAULT NOW()
+		)`).Error; err != nil {
+			return err
+		}
+		if !existing {
+			return nil
+		}
+		return tx.Exec("INSERT INTO schema_migrations (version) VALUES (?)", baseline).Error
+	})
+}
+
+// apply runs the migration in file name unless the database already ran
+// it, and reports whether it did.
+func apply(db *gorm.DB, name, version string) (bool, error) {
+	script, err := files.ReadFile(name)
+	if err != nil {
+		return false, err
+	}
+
+	ran := false
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", lockID).Error; err != nil {
+			return err
+		}
+		var count int64
+		if err := tx.Table("schema_migrations").Where("version = ?", version).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return nil
+		}
+		if err := tx.Exec(string(script)).Error; err != nil {
+			return err
+		}
+		ran = true
+		return tx.Exec("INSERT INTO schema_migrations (version) VALUES (?)", version).Error
+	})
+	return ran, err
+}